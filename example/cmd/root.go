@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/q-controller/qemu-client/pkg/qemu"
-	"github.com/q-controller/qemu-client/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -15,11 +14,6 @@ var rootCmd = &cobra.Command{
 	Use:   "example",
 	Short: "Example app to start qemu VM",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		mac, macErr := utils.GenerateRandomMAC()
-		if macErr != nil {
-			return macErr
-		}
-
 		platformConfig, platformErr := getPlatformConfig()
 		if platformErr != nil {
 			return platformErr
@@ -30,7 +24,11 @@ var rootCmd = &cobra.Command{
 		if dirErr != nil {
 			return dirErr
 		}
-		defer os.RemoveAll(dir)
+		defer func() {
+			if removeErr := qemu.Remove("example", dir); removeErr != nil {
+				slog.Error("Error removing instance", "error", removeErr)
+			}
+		}()
 
 		// Copy/link image into instance dir
 		if linkErr := os.Symlink(image, qemu.ImagePath(dir)); linkErr != nil {
@@ -41,7 +39,6 @@ var rootCmd = &cobra.Command{
 			Cpus:     1,
 			Memory:   1024,      // 1 GB
 			Disk:     40 * 1024, // 40 GB
-			HwAddr:   mac,
 			Platform: platformConfig,
 			CloudInit: qemu.CloudInitConfig{
 				Userdata: `#cloud-config
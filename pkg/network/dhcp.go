@@ -0,0 +1,581 @@
+package network
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+
+	dhcpHeaderSize = 236
+)
+
+var dhcpMagicCookie = []byte{99, 130, 83, 99}
+
+// DHCP message types (option 53).
+const (
+	dhcpDiscover byte = 1
+	dhcpOffer    byte = 2
+	dhcpRequest  byte = 3
+	dhcpDecline  byte = 4
+	dhcpAck      byte = 5
+	dhcpNak      byte = 6
+	dhcpRelease  byte = 7
+)
+
+// DHCP option codes used by the server.
+const (
+	optSubnetMask  byte = 1
+	optRouter      byte = 3
+	optDNS         byte = 6
+	optHostname    byte = 12
+	optDomainName  byte = 15
+	optRequestedIP byte = 50
+	optLeaseTime   byte = 51
+	optMessageType byte = 53
+	optServerID    byte = 54
+	optEnd         byte = 255
+	optPad         byte = 0
+)
+
+const defaultLeaseTime = time.Hour
+
+// Lease is an address allocated to a NIC. Leases are keyed by MAC and kept after
+// expiry, so a restarted instance gets the same address back.
+type Lease struct {
+	InstanceID string     `json:"instanceId"`
+	Mac        string     `json:"mac"`
+	IP         netip.Addr `json:"ip"`
+	Expiry     time.Time  `json:"expiry"`             // zero until the guest has requested the lease
+	Reserved   bool       `json:"reserved,omitempty"` // registered with Register; never reclaimed
+	Primary    bool       `json:"primary,omitempty"`  // the first NIC registered for the instance
+}
+
+// Active reports whether the guest currently holds the lease.
+func (l Lease) Active() bool {
+	return !l.Expiry.IsZero() && time.Now().Before(l.Expiry)
+}
+
+// DHCPConfig holds configuration for the embedded DHCPv4 server.
+type DHCPConfig struct {
+	Interface string       // bridge interface to serve, e.g., "qbr0"
+	Subnet    netip.Prefix // e.g., 192.168.100.0/24
+	Gateway   netip.Addr   // bridge address; advertised as router and server identifier
+	DNS       []netip.Addr // advertised name servers; defaults to Gateway (see DNSForwarder)
+	Domain    string       // optional search domain
+	LeaseTime time.Duration
+	LeaseFile string // optional path where leases are persisted
+}
+
+// DHCPServer is a minimal DHCPv4 server for library-managed networks.
+type DHCPServer struct {
+	config DHCPConfig
+
+	mu     sync.Mutex
+	leases map[string]*Lease // keyed by MAC
+	conn   net.PacketConn
+}
+
+// NewDHCPServer validates config and loads persisted leases, if any.
+func NewDHCPServer(config DHCPConfig) (*DHCPServer, error) {
+	if !config.Subnet.IsValid() || !config.Subnet.Addr().Is4() {
+		return nil, fmt.Errorf("dhcp: Subnet must be a valid IPv4 prefix")
+	}
+	config.Subnet = config.Subnet.Masked()
+	if !config.Subnet.Contains(config.Gateway) {
+		return nil, fmt.Errorf("dhcp: Gateway %s is not within %s", config.Gateway, config.Subnet)
+	}
+	if len(config.DNS) == 0 {
+		config.DNS = []netip.Addr{config.Gateway}
+	}
+	if config.LeaseTime == 0 {
+		config.LeaseTime = defaultLeaseTime
+	}
+
+	server := &DHCPServer{
+		config: config,
+		leases: map[string]*Lease{},
+	}
+
+	if loadErr := server.load(); loadErr != nil {
+		return nil, loadErr
+	}
+
+	return server, nil
+}
+
+// Register associates an instance with its NIC MAC and reserves an address for it,
+// so InstanceLeases can report the address before the guest has booted. Reserved
+// addresses are kept until Unregister, even when the pool is exhausted.
+func (s *DHCPServer) Register(instanceID, mac string) (Lease, error) {
+	hwAddr, parseErr := net.ParseMAC(mac)
+	if parseErr != nil {
+		return Lease{}, fmt.Errorf("dhcp: invalid MAC %q: %w", mac, parseErr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, allocErr := s.allocate(hwAddr.String())
+	if allocErr != nil {
+		return Lease{}, allocErr
+	}
+	lease.InstanceID = instanceID
+	lease.Reserved = true
+	primary := s.primary(instanceID)
+	lease.Primary = primary == nil || primary == lease
+
+	return *lease, s.save()
+}
+
+// Unregister releases the reservations of an instance. Its leases become reclaimable
+// once inactive.
+func (s *DHCPServer) Unregister(instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, lease := range s.leases {
+		if strings.EqualFold(lease.InstanceID, instanceID) {
+			lease.Reserved = false
+			lease.Primary = false
+		}
+	}
+	return s.save()
+}
+
+// Lease returns the lease of the primary NIC of the given instance: the first one
+// registered, or the lowest address for instances only known by hostname.
+func (s *DHCPServer) Lease(instanceID string) (Lease, bool) {
+	s.mu.Lock()
+	primary := s.primary(instanceID)
+	s.mu.Unlock()
+	if primary != nil {
+		return *primary, true
+	}
+
+	leases := s.InstanceLeases(instanceID)
+	if len(leases) == 0 {
+		return Lease{}, false
+	}
+	return leases[0], true
+}
+
+func (s *DHCPServer) primary(instanceID string) *Lease {
+	for _, lease := range s.leases {
+		if lease.Primary && strings.EqualFold(lease.InstanceID, instanceID) {
+			return lease
+		}
+	}
+	return nil
+}
+
+// InstanceLeases returns the leases held by the given instance, one per NIC, ordered
+// by address.
+func (s *DHCPServer) InstanceLeases(instanceID string) []Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	leases := []Lease{}
+	for _, lease := range s.leases {
+		if strings.EqualFold(lease.InstanceID, instanceID) {
+			leases = append(leases, *lease)
+		}
+	}
+	slices.SortFunc(leases, func(a, b Lease) int {
+		return a.IP.Compare(b.IP)
+	})
+	return leases
+}
+
+// Leases returns a snapshot of all known leases.
+func (s *DHCPServer) Leases() []Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	leases := make([]Lease, 0, len(s.leases))
+	for _, lease := range s.leases {
+		leases = append(leases, *lease)
+	}
+	return leases
+}
+
+// ListenAndServe binds to the configured interface and serves requests until Close is called.
+func (s *DHCPServer) ListenAndServe() error {
+	conn, listenErr := listenDHCP(s.config.Interface)
+	if listenErr != nil {
+		return listenErr
+	}
+
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	buf := make([]byte, 1500)
+	for {
+		n, addr, readErr := conn.ReadFrom(buf)
+		if readErr != nil {
+			if errors.Is(readErr, net.ErrClosed) {
+				return nil
+			}
+			return readErr
+		}
+
+		request, parseErr := parseDHCPMessage(buf[:n])
+		if parseErr != nil {
+			slog.Debug("Ignoring malformed DHCP packet", "from", addr, "error", parseErr)
+			continue
+		}
+
+		reply := s.handle(request)
+		if reply == nil {
+			continue
+		}
+
+		dest := &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpClientPort}
+		if request.ciaddr.IsValid() && !request.ciaddr.IsUnspecified() {
+			dest.IP = net.IP(request.ciaddr.AsSlice())
+		}
+		if _, writeErr := conn.WriteTo(reply.marshal(), dest); writeErr != nil {
+			slog.Error("Failed to send DHCP reply", "to", dest, "error", writeErr)
+		}
+	}
+}
+
+// Close stops the server.
+func (s *DHCPServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *DHCPServer) handle(request *dhcpMessage) *dhcpMessage {
+	if request.op != 1 || len(request.chaddr) != 6 {
+		return nil
+	}
+
+	msgType := request.option(optMessageType)
+	if len(msgType) != 1 {
+		return nil
+	}
+
+	mac := request.chaddr.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch msgType[0] {
+	case dhcpDiscover:
+		lease, allocErr := s.allocate(mac)
+		if allocErr != nil {
+			slog.Error("Failed to allocate DHCP lease", "mac", mac, "error", allocErr)
+			return nil
+		}
+		s.adoptHostname(lease, request)
+		return s.reply(request, dhcpOffer, lease.IP)
+	case dhcpRequest:
+		if serverID := request.option(optServerID); len(serverID) == 4 {
+			if addr, _ := netip.AddrFromSlice(serverID); addr != s.config.Gateway {
+				// The client accepted an offer from another server.
+				return nil
+			}
+		}
+
+		requested := request.ciaddr
+		if opt := request.option(optRequestedIP); len(opt) == 4 {
+			requested, _ = netip.AddrFromSlice(opt)
+		}
+
+		lease, allocErr := s.allocate(mac)
+		if allocErr != nil || lease.IP != requested {
+			return s.reply(request, dhcpNak, netip.Addr{})
+		}
+
+		lease.Expiry = time.Now().Add(s.config.LeaseTime)
+		s.adoptHostname(lease, request)
+		if saveErr := s.save(); saveErr != nil {
+			slog.Error("Failed to persist DHCP leases", "error", saveErr)
+		}
+		return s.reply(request, dhcpAck, lease.IP)
+	case dhcpRelease, dhcpDecline:
+		if lease, exists := s.leases[mac]; exists {
+			// Keep the address reserved for this MAC; only mark it inactive.
+			lease.Expiry = time.Time{}
+			if saveErr := s.save(); saveErr != nil {
+				slog.Error("Failed to persist DHCP leases", "error", saveErr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// adoptHostname records the hostname sent by the client as the instance ID when the
+// lease was not registered explicitly. cloud-init sets the hostname to the instance ID.
+func (s *DHCPServer) adoptHostname(lease *Lease, request *dhcpMessage) {
+	if lease.InstanceID != "" {
+		return
+	}
+	if hostname := request.option(optHostname); len(hostname) > 0 {
+		lease.InstanceID = string(hostname)
+	}
+}
+
+// allocate returns the lease for mac, allocating the lowest free address if needed.
+// Leases that are neither active nor reserved may be reclaimed once the pool is exhausted.
+func (s *DHCPServer) allocate(mac string) (*Lease, error) {
+	if lease, exists := s.leases[mac]; exists {
+		return lease, nil
+	}
+
+	used := map[netip.Addr]*Lease{}
+	for _, lease := range s.leases {
+		used[lease.IP] = lease
+	}
+
+	var reclaim *Lease
+	for addr := range s.pool() {
+		existing, taken := used[addr]
+		if !taken {
+			lease := &Lease{Mac: mac, IP: addr}
+			s.leases[mac] = lease
+			return lease, nil
+		}
+		if !existing.Reserved && !existing.Active() && (reclaim == nil || existing.Expiry.Before(reclaim.Expiry)) {
+			reclaim = existing
+		}
+	}
+
+	if reclaim == nil {
+		return nil, fmt.Errorf("dhcp: address pool %s exhausted", s.config.Subnet)
+	}
+
+	delete(s.leases, reclaim.Mac)
+	lease := &Lease{Mac: mac, IP: reclaim.IP}
+	s.leases[mac] = lease
+	return lease, nil
+}
+
+// pool yields all assignable host addresses of the subnet, skipping the gateway.
+func (s *DHCPServer) pool() func(func(netip.Addr) bool) {
+	return func(yield func(netip.Addr) bool) {
+		network := s.config.Subnet.Addr()
+		broadcast := broadcastAddr(s.config.Subnet)
+		for addr := network.Next(); addr.IsValid() && addr.Less(broadcast); addr = addr.Next() {
+			if addr == s.config.Gateway {
+				continue
+			}
+			if !yield(addr) {
+				return
+			}
+		}
+	}
+}
+
+func (s *DHCPServer) reply(request *dhcpMessage, msgType byte, yiaddr netip.Addr) *dhcpMessage {
+	reply := &dhcpMessage{
+		op:      2,
+		xid:     request.xid,
+		flags:   request.flags,
+		ciaddr:  request.ciaddr,
+		yiaddr:  yiaddr,
+		siaddr:  s.config.Gateway,
+		chaddr:  request.chaddr,
+		options: map[byte][]byte{},
+	}
+
+	reply.options[optMessageType] = []byte{msgType}
+	reply.options[optServerID] = s.config.Gateway.AsSlice()
+	if msgType == dhcpNak {
+		return reply
+	}
+
+	mask := net.CIDRMask(s.config.Subnet.Bits(), 32)
+	leaseTime := make([]byte, 4)
+	binary.BigEndian.PutUint32(leaseTime, uint32(s.config.LeaseTime/time.Second))
+
+	dns := []byte{}
+	for _, addr := range s.config.DNS {
+		dns = append(dns, addr.AsSlice()...)
+	}
+
+	reply.options[optSubnetMask] = mask
+	reply.options[optRouter] = s.config.Gateway.AsSlice()
+	reply.options[optDNS] = dns
+	reply.options[optLeaseTime] = leaseTime
+	if s.config.Domain != "" {
+		reply.options[optDomainName] = []byte(s.config.Domain)
+	}
+
+	return reply
+}
+
+func (s *DHCPServer) load() error {
+	if s.config.LeaseFile == "" {
+		return nil
+	}
+
+	data, readErr := os.ReadFile(s.config.LeaseFile)
+	if errors.Is(readErr, os.ErrNotExist) {
+		return nil
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	var leases []*Lease
+	if unmarshalErr := json.Unmarshal(data, &leases); unmarshalErr != nil {
+		return fmt.Errorf("dhcp: invalid lease file: %w", unmarshalErr)
+	}
+
+	for _, lease := range leases {
+		if s.config.Subnet.Contains(lease.IP) {
+			s.leases[lease.Mac] = lease
+		}
+	}
+	return nil
+}
+
+func (s *DHCPServer) save() error {
+	if s.config.LeaseFile == "" {
+		return nil
+	}
+
+	leases := make([]*Lease, 0, len(s.leases))
+	for _, lease := range s.leases {
+		leases = append(leases, lease)
+	}
+
+	data, marshalErr := json.MarshalIndent(leases, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	tmpPath := s.config.LeaseFile + ".tmp"
+	if writeErr := os.WriteFile(tmpPath, data, 0644); writeErr != nil {
+		return writeErr
+	}
+	return os.Rename(tmpPath, s.config.LeaseFile)
+}
+
+func broadcastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Masked().Addr().As4()
+	hostBits := 32 - prefix.Bits()
+	value := binary.BigEndian.Uint32(addr[:]) | (1<<hostBits - 1)
+	binary.BigEndian.PutUint32(addr[:], value)
+	return netip.AddrFrom4(addr)
+}
+
+type dhcpMessage struct {
+	op      byte
+	xid     [4]byte
+	flags   [2]byte
+	ciaddr  netip.Addr
+	yiaddr  netip.Addr
+	siaddr  netip.Addr
+	chaddr  net.HardwareAddr
+	options map[byte][]byte
+}
+
+func (m *dhcpMessage) option(code byte) []byte {
+	return m.options[code]
+}
+
+func parseDHCPMessage(data []byte) (*dhcpMessage, error) {
+	if len(data) < dhcpHeaderSize+len(dhcpMagicCookie) {
+		return nil, fmt.Errorf("packet too short: %d bytes", len(data))
+	}
+	if string(data[dhcpHeaderSize:dhcpHeaderSize+4]) != string(dhcpMagicCookie) {
+		return nil, fmt.Errorf("missing DHCP magic cookie")
+	}
+
+	hlen := int(data[2])
+	if hlen > 16 {
+		return nil, fmt.Errorf("invalid hardware address length: %d", hlen)
+	}
+
+	msg := &dhcpMessage{
+		op:      data[0],
+		chaddr:  net.HardwareAddr(append([]byte{}, data[28:28+hlen]...)),
+		options: map[byte][]byte{},
+	}
+	copy(msg.xid[:], data[4:8])
+	copy(msg.flags[:], data[10:12])
+	msg.ciaddr = netip.AddrFrom4([4]byte(data[12:16]))
+	msg.yiaddr = netip.AddrFrom4([4]byte(data[16:20]))
+	msg.siaddr = netip.AddrFrom4([4]byte(data[20:24]))
+
+	opts := data[dhcpHeaderSize+4:]
+	for len(opts) > 0 {
+		code := opts[0]
+		if code == optEnd {
+			break
+		}
+		if code == optPad {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return nil, fmt.Errorf("truncated option %d", code)
+		}
+		size := int(opts[1])
+		msg.options[code] = append(msg.options[code], opts[2:2+size]...)
+		opts = opts[2+size:]
+	}
+
+	return msg, nil
+}
+
+func (m *dhcpMessage) marshal() []byte {
+	buf := make([]byte, dhcpHeaderSize, 576)
+	buf[0] = m.op
+	buf[1] = 1 // ethernet
+	buf[2] = byte(len(m.chaddr))
+	copy(buf[4:8], m.xid[:])
+	copy(buf[10:12], m.flags[:])
+	for offset, addr := range map[int]netip.Addr{12: m.ciaddr, 16: m.yiaddr, 20: m.siaddr} {
+		if addr.Is4() {
+			copy(buf[offset:offset+4], addr.AsSlice())
+		}
+	}
+	copy(buf[28:44], m.chaddr)
+
+	buf = append(buf, dhcpMagicCookie...)
+	// The message type comes first, as some clients expect.
+	buf = append(buf, optMessageType, 1, m.options[optMessageType][0])
+	for code, value := range m.options {
+		if code == optMessageType {
+			continue
+		}
+		for len(value) > 255 {
+			buf = append(buf, code, 255)
+			buf = append(buf, value[:255]...)
+			value = value[255:]
+		}
+		buf = append(buf, code, byte(len(value)))
+		buf = append(buf, value...)
+	}
+	buf = append(buf, optEnd)
+
+	// Pad to the minimum BOOTP message size.
+	for len(buf) < 300 {
+		buf = append(buf, optPad)
+	}
+
+	return buf
+}
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// listenDHCP binds the DHCP server port on the given interface only, so the server
+// never answers clients on other host networks.
+func listenDHCP(iface string) (net.PacketConn, error) {
+	if iface == "" {
+		return nil, fmt.Errorf("dhcp: Interface must be set")
+	}
+
+	config := net.ListenConfig{
+		Control: func(network, address string, conn syscall.RawConn) error {
+			var sockErr error
+			controlErr := conn.Control(func(fd uintptr) {
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); sockErr != nil {
+					return
+				}
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); sockErr != nil {
+					return
+				}
+				sockErr = syscall.BindToDevice(int(fd), iface)
+			})
+			if controlErr != nil {
+				return controlErr
+			}
+			return sockErr
+		},
+	}
+
+	return config.ListenPacket(context.Background(), "udp4", fmt.Sprintf(":%d", dhcpServerPort))
+}
@@ -0,0 +1,182 @@
+package network
+
+import (
+	"net"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDHCPServer(t *testing.T, leaseFile string) *DHCPServer {
+	server, err := NewDHCPServer(DHCPConfig{
+		Interface: "qbr0",
+		Subnet:    netip.MustParsePrefix("192.168.100.0/24"),
+		Gateway:   netip.MustParseAddr("192.168.100.1"),
+		LeaseFile: leaseFile,
+	})
+	require.NoError(t, err)
+	return server
+}
+
+func dhcpClientMessage(t *testing.T, mac string, msgType byte, options map[byte][]byte) *dhcpMessage {
+	hwAddr, err := net.ParseMAC(mac)
+	require.NoError(t, err)
+
+	msg := &dhcpMessage{
+		op:      1,
+		xid:     [4]byte{1, 2, 3, 4},
+		chaddr:  hwAddr,
+		options: map[byte][]byte{optMessageType: {msgType}},
+	}
+	for code, value := range options {
+		msg.options[code] = value
+	}
+
+	// Round-trip through the wire format to exercise parsing.
+	parsed, parseErr := parseDHCPMessage(msg.marshal())
+	require.NoError(t, parseErr)
+	parsed.op = 1
+	return parsed
+}
+
+func TestDHCPServer_DiscoverRequest(t *testing.T) {
+	server := newTestDHCPServer(t, "")
+
+	offer := server.handle(dhcpClientMessage(t, "52:54:00:00:00:01", dhcpDiscover, map[byte][]byte{
+		optHostname: []byte("vm1"),
+	}))
+	require.NotNil(t, offer)
+	assert.Equal(t, []byte{dhcpOffer}, offer.option(optMessageType))
+	assert.Equal(t, netip.MustParseAddr("192.168.100.2"), offer.yiaddr)
+	assert.Equal(t, []byte{255, 255, 255, 0}, offer.option(optSubnetMask))
+	assert.Equal(t, []byte{192, 168, 100, 1}, offer.option(optDNS))
+
+	ack := server.handle(dhcpClientMessage(t, "52:54:00:00:00:01", dhcpRequest, map[byte][]byte{
+		optRequestedIP: offer.yiaddr.AsSlice(),
+		optServerID:    []byte{192, 168, 100, 1},
+	}))
+	require.NotNil(t, ack)
+	assert.Equal(t, []byte{dhcpAck}, ack.option(optMessageType))
+
+	leases := server.InstanceLeases("vm1")
+	require.Len(t, leases, 1)
+	assert.True(t, leases[0].Active())
+	assert.Equal(t, "52:54:00:00:00:01", leases[0].Mac)
+}
+
+func TestDHCPServer_RequestForWrongAddressIsRejected(t *testing.T) {
+	server := newTestDHCPServer(t, "")
+
+	nak := server.handle(dhcpClientMessage(t, "52:54:00:00:00:01", dhcpRequest, map[byte][]byte{
+		optRequestedIP: {192, 168, 100, 77},
+	}))
+	require.NotNil(t, nak)
+	assert.Equal(t, []byte{dhcpNak}, nak.option(optMessageType))
+}
+
+func TestDHCPServer_RequestForOtherServerIsIgnored(t *testing.T) {
+	server := newTestDHCPServer(t, "")
+
+	reply := server.handle(dhcpClientMessage(t, "52:54:00:00:00:01", dhcpRequest, map[byte][]byte{
+		optServerID: {192, 168, 100, 254},
+	}))
+	assert.Nil(t, reply)
+}
+
+func TestDHCPServer_LeasesAreStableAcrossRestarts(t *testing.T) {
+	leaseFile := filepath.Join(t.TempDir(), "leases.json")
+
+	server := newTestDHCPServer(t, leaseFile)
+	first, err := server.Register("vm1", "52:54:00:00:00:01")
+	require.NoError(t, err)
+	second, err := server.Register("vm2", "52:54:00:00:00:02")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.IP, second.IP)
+
+	restarted := newTestDHCPServer(t, leaseFile)
+	leases := restarted.InstanceLeases("vm2")
+	require.Len(t, leases, 1)
+	assert.Equal(t, second.IP, leases[0].IP)
+	assert.True(t, leases[0].Reserved)
+
+	again, err := restarted.Register("vm1", "52:54:00:00:00:01")
+	require.NoError(t, err)
+	assert.Equal(t, first.IP, again.IP)
+}
+
+func TestDHCPServer_PoolExhaustionReclaimsInactiveLeases(t *testing.T) {
+	server, err := NewDHCPServer(DHCPConfig{
+		Subnet:  netip.MustParsePrefix("10.0.0.0/30"),
+		Gateway: netip.MustParseAddr("10.0.0.1"),
+	})
+	require.NoError(t, err)
+
+	// A /30 has a single assignable address besides the gateway.
+	first, err := server.Register("vm1", "52:54:00:00:00:01")
+	require.NoError(t, err)
+
+	_, err = server.Register("vm2", "52:54:00:00:00:02")
+	assert.Error(t, err, "reservations must not be reclaimed")
+	assert.Len(t, server.InstanceLeases("vm1"), 1)
+
+	require.NoError(t, server.Unregister("vm1"))
+	second, err := server.Register("vm2", "52:54:00:00:00:02")
+	require.NoError(t, err)
+	assert.Equal(t, first.IP, second.IP)
+	assert.Empty(t, server.InstanceLeases("vm1"))
+}
+
+func TestDHCPServer_InstanceLeasesAreOrdered(t *testing.T) {
+	server := newTestDHCPServer(t, "")
+
+	// Register NICs in an order whose map iteration would differ from address order.
+	macs := []string{"52:54:00:00:00:03", "52:54:00:00:00:01", "52:54:00:00:00:02"}
+	for _, mac := range macs {
+		_, err := server.Register("vm1", mac)
+		require.NoError(t, err)
+	}
+
+	leases := server.InstanceLeases("vm1")
+	require.Len(t, leases, 3)
+	for i, mac := range macs {
+		assert.Equal(t, mac, leases[i].Mac)
+	}
+	assert.True(t, leases[0].IP.Less(leases[1].IP) && leases[1].IP.Less(leases[2].IP))
+}
+
+func TestDHCPServer_LeaseReturnsPrimaryNIC(t *testing.T) {
+	server := newTestDHCPServer(t, "")
+
+	_, ok := server.Lease("vm1")
+	assert.False(t, ok)
+
+	// The primary NIC is registered first but gets the higher address.
+	primary, err := server.Register("vm1", "52:54:00:00:00:02")
+	require.NoError(t, err)
+	server.leases[primary.Mac].IP = netip.MustParseAddr("192.168.100.200")
+	_, err = server.Register("vm1", "52:54:00:00:00:01")
+	require.NoError(t, err)
+
+	lease, ok := server.Lease("VM1")
+	require.True(t, ok)
+	assert.Equal(t, primary.Mac, lease.Mac)
+	assert.True(t, lease.Primary)
+	assert.Len(t, server.InstanceLeases("vm1"), 2)
+
+	// Without a registration, the lowest address is reported.
+	require.NoError(t, server.Unregister("vm1"))
+	lease, ok = server.Lease("vm1")
+	require.True(t, ok)
+	assert.Equal(t, "52:54:00:00:00:01", lease.Mac)
+}
+
+func TestNewDHCPServer_GatewayOutsideSubnet(t *testing.T) {
+	_, err := NewDHCPServer(DHCPConfig{
+		Subnet:  netip.MustParsePrefix("192.168.100.0/24"),
+		Gateway: netip.MustParseAddr("10.0.0.1"),
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,223 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	dnsHeaderSize = 12
+	dnsTypeA      = 1
+	dnsClassIN    = 1
+	dnsAnswerTTL  = 60
+
+	upstreamTimeout = 5 * time.Second
+)
+
+// DNSForwarder answers A queries for instance IDs from the leases of a DHCPServer
+// and forwards all other queries to an upstream resolver.
+type DNSForwarder struct {
+	conn     net.PacketConn
+	leases   *DHCPServer
+	upstream string
+}
+
+// ListenDNSForwarder listens on addr (e.g., "192.168.100.1:53"). When upstream is
+// empty, the first name server from /etc/resolv.conf is used.
+func ListenDNSForwarder(addr string, leases *DHCPServer, upstream string) (*DNSForwarder, error) {
+	if upstream == "" {
+		resolvConfUpstream, upstreamErr := systemNameserver("/etc/resolv.conf")
+		if upstreamErr != nil {
+			return nil, upstreamErr
+		}
+		upstream = resolvConfUpstream
+	}
+
+	conn, listenErr := net.ListenPacket("udp", addr)
+	if listenErr != nil {
+		return nil, fmt.Errorf("dns: failed to listen on %s: %w", addr, listenErr)
+	}
+
+	return &DNSForwarder{
+		conn:     conn,
+		leases:   leases,
+		upstream: upstream,
+	}, nil
+}
+
+// Serve answers queries until Close is called.
+func (f *DNSForwarder) Serve() error {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, readErr := f.conn.ReadFrom(buf)
+		if readErr != nil {
+			if errors.Is(readErr, net.ErrClosed) {
+				return nil
+			}
+			return readErr
+		}
+
+		query := append([]byte{}, buf[:n]...)
+		if answer := f.answer(query); answer != nil {
+			if _, writeErr := f.conn.WriteTo(answer, addr); writeErr != nil {
+				slog.Debug("Failed to send DNS answer", "to", addr, "error", writeErr)
+			}
+			continue
+		}
+
+		go f.forward(query, addr)
+	}
+}
+
+// Close stops the forwarder.
+func (f *DNSForwarder) Close() error {
+	return f.conn.Close()
+}
+
+// answer builds a response for queries about instances, or returns nil if the query
+// must be forwarded.
+func (f *DNSForwarder) answer(query []byte) []byte {
+	name, qtype, questionEnd, parseErr := parseDNSQuestion(query)
+	if parseErr != nil {
+		return nil
+	}
+
+	instanceID := strings.TrimSuffix(name, ".")
+	if domain := f.leases.config.Domain; domain != "" {
+		instanceID = strings.TrimSuffix(instanceID, "."+strings.TrimSuffix(domain, "."))
+	}
+	if strings.Contains(instanceID, ".") {
+		return nil
+	}
+
+	// Inactive addresses may already be handed to another guest.
+	leases := slices.DeleteFunc(f.leases.InstanceLeases(instanceID), func(lease Lease) bool {
+		return !lease.Active()
+	})
+	if len(leases) == 0 {
+		return nil
+	}
+
+	response := make([]byte, questionEnd, questionEnd+16*len(leases))
+	copy(response, query[:questionEnd])
+	// QR and AA set, RD preserved, RA set.
+	flags := 0x8400 | binary.BigEndian.Uint16(query[2:4])&0x0100 | 0x0080
+	binary.BigEndian.PutUint16(response[2:4], flags)
+	binary.BigEndian.PutUint16(response[4:6], 1)
+	binary.BigEndian.PutUint16(response[6:8], 0)
+	binary.BigEndian.PutUint16(response[8:10], 0)
+	binary.BigEndian.PutUint16(response[10:12], 0)
+
+	// Instances only have IPv4 leases; other record types get an empty answer.
+	if qtype != dnsTypeA {
+		return response
+	}
+
+	// One record per NIC of the instance.
+	binary.BigEndian.PutUint16(response[6:8], uint16(len(leases)))
+	for _, lease := range leases {
+		response = append(response, 0xc0, dnsHeaderSize) // pointer to the question name
+		response = binary.BigEndian.AppendUint16(response, dnsTypeA)
+		response = binary.BigEndian.AppendUint16(response, dnsClassIN)
+		response = binary.BigEndian.AppendUint32(response, dnsAnswerTTL)
+		response = binary.BigEndian.AppendUint16(response, 4)
+		response = append(response, lease.IP.AsSlice()...)
+	}
+
+	return response
+}
+
+func (f *DNSForwarder) forward(query []byte, client net.Addr) {
+	upstream, dialErr := net.DialTimeout("udp", f.upstream, upstreamTimeout)
+	if dialErr != nil {
+		slog.Error("Failed to reach upstream DNS", "upstream", f.upstream, "error", dialErr)
+		return
+	}
+	defer upstream.Close()
+
+	upstream.SetDeadline(time.Now().Add(upstreamTimeout))
+	if _, writeErr := upstream.Write(query); writeErr != nil {
+		slog.Debug("Failed to forward DNS query", "error", writeErr)
+		return
+	}
+
+	buf := make([]byte, 4096)
+	n, readErr := upstream.Read(buf)
+	if readErr != nil {
+		slog.Debug("No answer from upstream DNS", "error", readErr)
+		return
+	}
+
+	if _, writeErr := f.conn.WriteTo(buf[:n], client); writeErr != nil {
+		slog.Debug("Failed to relay DNS answer", "to", client, "error", writeErr)
+	}
+}
+
+// parseDNSQuestion returns the name and type of the single question in a standard query,
+// along with the offset where the question section ends.
+func parseDNSQuestion(msg []byte) (string, uint16, int, error) {
+	if len(msg) < dnsHeaderSize {
+		return "", 0, 0, fmt.Errorf("message too short")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:4])
+	if flags&0x8000 != 0 || flags&0x7800 != 0 {
+		return "", 0, 0, fmt.Errorf("not a standard query")
+	}
+	if binary.BigEndian.Uint16(msg[4:6]) != 1 {
+		return "", 0, 0, fmt.Errorf("expected exactly one question")
+	}
+
+	labels := []string{}
+	offset := dnsHeaderSize
+	for {
+		if offset >= len(msg) {
+			return "", 0, 0, fmt.Errorf("truncated question")
+		}
+		size := int(msg[offset])
+		offset++
+		if size == 0 {
+			break
+		}
+		if size&0xc0 != 0 || offset+size > len(msg) {
+			return "", 0, 0, fmt.Errorf("invalid label")
+		}
+		labels = append(labels, string(msg[offset:offset+size]))
+		offset += size
+	}
+
+	if offset+4 > len(msg) {
+		return "", 0, 0, fmt.Errorf("truncated question")
+	}
+	qtype := binary.BigEndian.Uint16(msg[offset : offset+2])
+	qclass := binary.BigEndian.Uint16(msg[offset+2 : offset+4])
+	if qclass != dnsClassIN {
+		return "", 0, 0, fmt.Errorf("unsupported class %d", qclass)
+	}
+
+	return strings.Join(labels, ".") + ".", qtype, offset + 4, nil
+}
+
+func systemNameserver(path string) (string, error) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return "", fmt.Errorf("dns: no upstream configured: %w", openErr)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	return "", fmt.Errorf("dns: no nameserver found in %s", path)
+}
@@ -0,0 +1,95 @@
+package network
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dnsQuery(name string, qtype uint16) []byte {
+	msg := []byte{0xab, 0xcd, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	return msg
+}
+
+// registerActive registers a NIC whose guest has requested its lease.
+func registerActive(t *testing.T, leases *DHCPServer, instanceID, mac string) Lease {
+	lease, err := leases.Register(instanceID, mac)
+	require.NoError(t, err)
+	leases.leases[lease.Mac].Expiry = time.Now().Add(time.Hour)
+	return lease
+}
+
+func TestDNSForwarder_AnswersInstanceNames(t *testing.T) {
+	leases := newTestDHCPServer(t, "")
+	leases.config.Domain = "vms.internal"
+	lease := registerActive(t, leases, "vm1", "52:54:00:00:00:01")
+
+	forwarder := &DNSForwarder{leases: leases}
+
+	for _, name := range []string{"vm1.", "vm1.vms.internal.", "VM1."} {
+		query := dnsQuery(name, dnsTypeA)
+		answer := forwarder.answer(query)
+		require.NotNil(t, answer, name)
+
+		assert.Equal(t, query[:2], answer[:2], "transaction ID must be preserved")
+		assert.Equal(t, uint16(1), binary.BigEndian.Uint16(answer[6:8]), "answer count")
+		assert.Equal(t, lease.IP.AsSlice(), answer[len(answer)-4:])
+	}
+}
+
+func TestDNSForwarder_AnswersEveryNIC(t *testing.T) {
+	leases := newTestDHCPServer(t, "")
+	first := registerActive(t, leases, "vm1", "52:54:00:00:00:01")
+	second := registerActive(t, leases, "vm1", "52:54:00:00:00:02")
+
+	answer := (&DNSForwarder{leases: leases}).answer(dnsQuery("vm1.", dnsTypeA))
+	require.NotNil(t, answer)
+	assert.Equal(t, uint16(2), binary.BigEndian.Uint16(answer[6:8]), "answer count")
+	// Each record ends with its 4-byte address and is 16 bytes long.
+	assert.Equal(t, first.IP.AsSlice(), answer[len(answer)-20:len(answer)-16])
+	assert.Equal(t, second.IP.AsSlice(), answer[len(answer)-4:])
+}
+
+func TestDNSForwarder_SkipsInactiveLeases(t *testing.T) {
+	leases := newTestDHCPServer(t, "")
+	active := registerActive(t, leases, "vm1", "52:54:00:00:00:01")
+	expired := registerActive(t, leases, "vm1", "52:54:00:00:00:02")
+	leases.leases[expired.Mac].Expiry = time.Now().Add(-time.Minute)
+	_, err := leases.Register("vm2", "52:54:00:00:00:03")
+	require.NoError(t, err)
+
+	forwarder := &DNSForwarder{leases: leases}
+	answer := forwarder.answer(dnsQuery("vm1.", dnsTypeA))
+	require.NotNil(t, answer)
+	assert.Equal(t, uint16(1), binary.BigEndian.Uint16(answer[6:8]), "answer count")
+	assert.Equal(t, active.IP.AsSlice(), answer[len(answer)-4:])
+
+	assert.Nil(t, forwarder.answer(dnsQuery("vm2.", dnsTypeA)), "the guest has not requested its lease yet")
+}
+
+func TestDNSForwarder_ForwardsUnknownNames(t *testing.T) {
+	forwarder := &DNSForwarder{leases: newTestDHCPServer(t, "")}
+
+	assert.Nil(t, forwarder.answer(dnsQuery("example.com.", dnsTypeA)))
+	assert.Nil(t, forwarder.answer(dnsQuery("vm1.", dnsTypeA)))
+}
+
+func TestDNSForwarder_EmptyAnswerForOtherTypes(t *testing.T) {
+	leases := newTestDHCPServer(t, "")
+	registerActive(t, leases, "vm1", "52:54:00:00:00:01")
+
+	answer := (&DNSForwarder{leases: leases}).answer(dnsQuery("vm1.", 28))
+	require.NotNil(t, answer)
+	assert.Equal(t, uint16(0), binary.BigEndian.Uint16(answer[6:8]))
+}
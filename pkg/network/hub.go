@@ -0,0 +1,174 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+)
+
+// maxFrameSize bounds a single ethernet frame read from a port (jumbo frames included).
+const maxFrameSize = 65536
+
+// portQueueSize is the number of frames buffered for a port; frames for a port whose
+// queue is full are dropped, so a stalled peer cannot hold up the others.
+const portQueueSize = 256
+
+// Hub is a userspace L2 hub that QEMU `stream` netdevs connect to over a unix socket.
+// Every frame received from one port is flooded to all other ports, so instances
+// attached to the same hub share an isolated segment without host privileges.
+type Hub struct {
+	listener net.Listener
+	path     string
+
+	mu    sync.Mutex
+	ports map[net.Conn]chan []byte // outgoing frames of each port, see forward
+	wg    sync.WaitGroup
+}
+
+// ListenHub creates the hub socket at path and starts accepting ports in the background.
+func ListenHub(path string) (*Hub, error) {
+	// Remove a stale socket left behind by a previous hub.
+	os.Remove(path)
+
+	listener, listenErr := net.Listen("unix", path)
+	if listenErr != nil {
+		return nil, fmt.Errorf("failed to listen on hub socket: %w", listenErr)
+	}
+
+	hub := &Hub{
+		listener: listener,
+		path:     path,
+		ports:    map[net.Conn]chan []byte{},
+	}
+
+	hub.wg.Add(1)
+	go hub.accept()
+
+	return hub, nil
+}
+
+// Path returns the unix socket path instances connect to.
+func (h *Hub) Path() string {
+	return h.path
+}
+
+// Close stops accepting ports, disconnects all connected ports and removes the socket.
+func (h *Hub) Close() error {
+	closeErr := h.listener.Close()
+
+	h.mu.Lock()
+	for conn := range h.ports {
+		conn.Close()
+	}
+	h.mu.Unlock()
+
+	h.wg.Wait()
+	os.Remove(h.path)
+
+	return closeErr
+}
+
+func (h *Hub) accept() {
+	defer h.wg.Done()
+
+	for {
+		conn, acceptErr := h.listener.Accept()
+		if acceptErr != nil {
+			if !errors.Is(acceptErr, net.ErrClosed) {
+				slog.Error("Hub failed to accept port", "error", acceptErr)
+			}
+			return
+		}
+
+		queue := make(chan []byte, portQueueSize)
+		h.mu.Lock()
+		h.ports[conn] = queue
+		h.mu.Unlock()
+
+		h.wg.Add(2)
+		go h.serve(conn)
+		go h.forward(conn, queue)
+	}
+}
+
+func (h *Hub) serve(conn net.Conn) {
+	defer h.wg.Done()
+	defer func() {
+		h.mu.Lock()
+		close(h.ports[conn])
+		delete(h.ports, conn)
+		h.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		frame, readErr := readFrame(conn)
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) && !errors.Is(readErr, net.ErrClosed) {
+				slog.Debug("Hub port disconnected", "error", readErr)
+			}
+			return
+		}
+		h.flood(conn, frame)
+	}
+}
+
+// forward writes the queued frames of a port until the port disconnects.
+func (h *Hub) forward(conn net.Conn, queue <-chan []byte) {
+	defer h.wg.Done()
+
+	for frame := range queue {
+		if writeErr := writeFrame(conn, frame); writeErr != nil {
+			slog.Debug("Hub failed to forward frame", "error", writeErr)
+		}
+	}
+}
+
+func (h *Hub) flood(from net.Conn, frame []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for conn, queue := range h.ports {
+		if conn == from {
+			continue
+		}
+		select {
+		case queue <- frame:
+		default:
+			slog.Debug("Hub dropped frame for a stalled port")
+		}
+	}
+}
+
+// readFrame reads a single frame using the QEMU stream netdev framing:
+// a 4-byte big-endian length followed by the ethernet frame.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func writeFrame(w io.Writer, frame []byte) error {
+	buf := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(buf, uint32(len(frame)))
+	copy(buf[4:], frame)
+	_, err := w.Write(buf)
+	return err
+}
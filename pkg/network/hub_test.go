@@ -0,0 +1,100 @@
+package network
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialPort(t *testing.T, hub *Hub) net.Conn {
+	conn, err := net.Dial("unix", hub.Path())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestHub_FloodsFramesToOtherPorts(t *testing.T) {
+	hub, err := ListenHub(filepath.Join(t.TempDir(), "hub.sock"))
+	require.NoError(t, err)
+	defer hub.Close()
+
+	a := dialPort(t, hub)
+	b := dialPort(t, hub)
+	c := dialPort(t, hub)
+
+	// Wait until the hub has registered all ports.
+	require.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.ports) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	frame := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	require.NoError(t, writeFrame(a, frame))
+
+	for _, conn := range []net.Conn{b, c} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		got, readErr := readFrame(conn)
+		require.NoError(t, readErr)
+		assert.Equal(t, frame, got)
+	}
+
+	// The sender must not receive its own frame back.
+	a.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, readErr := readFrame(a)
+	assert.Error(t, readErr)
+}
+
+func TestHub_StalledPortDoesNotBlockOthers(t *testing.T) {
+	hub, err := ListenHub(filepath.Join(t.TempDir(), "hub.sock"))
+	require.NoError(t, err)
+	defer hub.Close()
+
+	a := dialPort(t, hub)
+	dialPort(t, hub) // never reads
+	c := dialPort(t, hub)
+
+	require.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.ports) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	go io.Copy(io.Discard, c)
+
+	// Far more than the socket buffers of the stalled port can hold.
+	sent := make(chan error, 1)
+	go func() {
+		frame := make([]byte, 1500)
+		for i := 0; i < 4096; i++ {
+			if writeErr := writeFrame(a, frame); writeErr != nil {
+				sent <- writeErr
+				return
+			}
+		}
+		sent <- nil
+	}()
+
+	select {
+	case sendErr := <-sent:
+		require.NoError(t, sendErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("a stalled port blocked the hub")
+	}
+}
+
+func TestReadFrame_RejectsOversizedFrame(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	go writeFrame(a, make([]byte, maxFrameSize+1))
+
+	_, err := readFrame(b)
+	assert.Error(t, err)
+}
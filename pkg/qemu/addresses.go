@@ -0,0 +1,266 @@
+package qemu
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/q-controller/qemu-client/pkg/network"
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+type AddressFamily string
+
+const (
+	IPv4 AddressFamily = "ipv4"
+	IPv6 AddressFamily = "ipv6"
+)
+
+// AddressSource tells where an address was learned from.
+type AddressSource string
+
+const (
+	SourceGuestAgent AddressSource = "guest-agent"
+	SourceDHCPLease  AddressSource = "dhcp-lease"
+	SourceNeighbor   AddressSource = "neighbor"
+)
+
+// Address is an IP address assigned to a guest.
+type Address struct {
+	IP     netip.Addr
+	Prefix int // prefix length; 0 when the source does not report it
+	Source AddressSource
+}
+
+func (a Address) Family() AddressFamily {
+	if a.IP.Is4() {
+		return IPv4
+	}
+	return IPv6
+}
+
+const addressPollInterval = time.Second
+
+type guestInterface struct {
+	Name            string `json:"name"`
+	HardwareAddress string `json:"hardware-address"`
+	IPAddresses     []struct {
+		Type    string `json:"ip-address-type"`
+		Address string `json:"ip-address"`
+		Prefix  int    `json:"prefix"`
+	} `json:"ip-addresses"`
+}
+
+// Addresses returns the guest's addresses, combining the guest agent, DHCP lease files
+// and the host neighbor table. Besides the platform's default lease files, additional
+// lease files (e.g., of a network.DHCPServer) can be passed in.
+func (i *Instance) Addresses(ctx context.Context, leaseFiles ...string) ([]Address, error) {
+	addresses := []Address{}
+	seen := map[netip.Addr]bool{}
+	add := func(address Address) {
+		if !seen[address.IP] && !address.IP.IsLoopback() {
+			seen[address.IP] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	agentAddresses, agentErr := i.agentAddresses(ctx)
+	if agentErr != nil {
+		slog.Debug("Guest agent addresses unavailable", "instance", i.Name, "error", agentErr)
+	}
+	for _, address := range agentAddresses {
+		add(address)
+	}
+
+	// The remaining sources can only be matched by MAC.
+	mac, _ := utils.NormalizeMAC(i.HwAddr)
+	if mac == "" {
+		if agentErr != nil {
+			return nil, fmt.Errorf("no guest agent and no MAC address to look up: %w", agentErr)
+		}
+		return addresses, nil
+	}
+
+	for _, path := range append(defaultLeaseFiles, leaseFiles...) {
+		leases, leasesErr := readLeaseFile(path)
+		if leasesErr != nil {
+			if !os.IsNotExist(leasesErr) {
+				slog.Debug("Failed to read lease file", "path", path, "error", leasesErr)
+			}
+			continue
+		}
+		for _, lease := range leases {
+			if lease.Mac == mac {
+				add(Address{IP: lease.IP, Source: SourceDHCPLease})
+			}
+		}
+	}
+
+	neighbors, neighborsErr := utils.Neighbors()
+	if neighborsErr != nil {
+		slog.Debug("Failed to read neighbor table", "error", neighborsErr)
+	}
+	for _, neighbor := range neighbors {
+		if neighbor.Mac == mac {
+			add(Address{IP: neighbor.IP, Source: SourceNeighbor})
+		}
+	}
+
+	return addresses, nil
+}
+
+// WaitForAddress polls Addresses until the guest has a global unicast address,
+// preferring IPv4, or until ctx is done.
+func (i *Instance) WaitForAddress(ctx context.Context, leaseFiles ...string) (Address, error) {
+	ticker := time.NewTicker(addressPollInterval)
+	defer ticker.Stop()
+
+	for {
+		addresses, _ := i.Addresses(ctx, leaseFiles...)
+
+		usable := []Address{}
+		for _, address := range addresses {
+			if address.IP.IsGlobalUnicast() {
+				usable = append(usable, address)
+			}
+		}
+		sort.SliceStable(usable, func(a, b int) bool {
+			return usable[a].IP.Is4() && !usable[b].IP.Is4()
+		})
+		if len(usable) > 0 {
+			return usable[0], nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return Address{}, fmt.Errorf("no address for instance %s: %w", i.Name, ctx.Err())
+		case <-i.Done:
+			return Address{}, fmt.Errorf("instance %s exited", i.Name)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (i *Instance) agentAddresses(ctx context.Context) ([]Address, error) {
+	agent, agentErr := i.agent(ctx)
+	if agentErr != nil {
+		return nil, agentErr
+	}
+	defer agent.Close()
+
+	var interfaces []guestInterface
+	if execErr := agent.Execute(ctx, "guest-network-get-interfaces", nil, &interfaces); execErr != nil {
+		return nil, execErr
+	}
+
+	mac, _ := utils.NormalizeMAC(i.HwAddr)
+
+	addresses := []Address{}
+	for _, iface := range interfaces {
+		ifaceMac, _ := utils.NormalizeMAC(iface.HardwareAddress)
+		if mac != "" && ifaceMac != mac {
+			continue
+		}
+		for _, ip := range iface.IPAddresses {
+			addr, parseErr := netip.ParseAddr(ip.Address)
+			if parseErr != nil {
+				continue
+			}
+			addresses = append(addresses, Address{IP: addr.WithZone(""), Prefix: ip.Prefix, Source: SourceGuestAgent})
+		}
+	}
+
+	return addresses, nil
+}
+
+type leaseEntry struct {
+	Mac string
+	IP  netip.Addr
+}
+
+// readLeaseFile reads DHCP leases in any of the supported formats: the JSON written by
+// network.DHCPServer, dnsmasq lease files and the macOS bootpd database.
+func readLeaseFile(path string) ([]leaseEntry, error) {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var leases []network.Lease
+		if unmarshalErr := json.Unmarshal(trimmed, &leases); unmarshalErr != nil {
+			return nil, unmarshalErr
+		}
+		entries := []leaseEntry{}
+		for _, lease := range leases {
+			if mac, macErr := utils.NormalizeMAC(lease.Mac); macErr == nil {
+				entries = append(entries, leaseEntry{Mac: mac, IP: lease.IP})
+			}
+		}
+		return entries, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return parseBootpdLeases(trimmed), nil
+	default:
+		return parseDnsmasqLeases(trimmed), nil
+	}
+}
+
+// parseDnsmasqLeases parses lines of "<expiry> <mac> <ip> <hostname> <client-id>".
+func parseDnsmasqLeases(data []byte) []leaseEntry {
+	entries := []leaseEntry{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		mac, macErr := utils.NormalizeMAC(fields[1])
+		ip, ipErr := netip.ParseAddr(fields[2])
+		if macErr == nil && ipErr == nil {
+			entries = append(entries, leaseEntry{Mac: mac, IP: ip})
+		}
+	}
+
+	return entries
+}
+
+// parseBootpdLeases parses /var/db/dhcpd_leases blocks such as
+// "{ name=vm ip_address=192.168.64.2 hw_address=1,52:54:0:12:34:56 ... }".
+func parseBootpdLeases(data []byte) []leaseEntry {
+	entries := []leaseEntry{}
+
+	var ip netip.Addr
+	var mac string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, _ := strings.Cut(line, "=")
+		switch {
+		case line == "{":
+			ip, mac = netip.Addr{}, ""
+		case line == "}":
+			if ip.IsValid() && mac != "" {
+				entries = append(entries, leaseEntry{Mac: mac, IP: ip})
+			}
+		case key == "ip_address":
+			ip, _ = netip.ParseAddr(value)
+		case key == "hw_address":
+			// The value is prefixed with the hardware type, e.g., "1,".
+			_, hwAddr, _ := strings.Cut(value, ",")
+			mac, _ = utils.NormalizeMAC(hwAddr)
+		}
+	}
+
+	return entries
+}
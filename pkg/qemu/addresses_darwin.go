@@ -0,0 +1,6 @@
+package qemu
+
+// defaultLeaseFiles lists the lease database of the vmnet DHCP server (bootpd).
+var defaultLeaseFiles = []string{
+	"/var/db/dhcpd_leases",
+}
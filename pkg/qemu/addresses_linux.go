@@ -0,0 +1,6 @@
+package qemu
+
+// defaultLeaseFiles lists lease databases of DHCP servers commonly serving tap networks.
+var defaultLeaseFiles = []string{
+	"/var/lib/misc/dnsmasq.leases",
+}
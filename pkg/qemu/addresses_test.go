@@ -0,0 +1,77 @@
+package qemu
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLeaseFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "leases")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestReadLeaseFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []leaseEntry
+	}{
+		{
+			name: "network.DHCPServer JSON",
+			content: `[
+  {"instanceId": "vm1", "mac": "52:54:00:12:34:56", "ip": "192.168.100.2", "expiry": "0001-01-01T00:00:00Z"}
+]`,
+			expected: []leaseEntry{{Mac: "52:54:00:12:34:56", IP: netip.MustParseAddr("192.168.100.2")}},
+		},
+		{
+			name: "dnsmasq",
+			content: `1700000000 52:54:00:12:34:56 192.168.122.10 vm1 01:52:54:00:12:34:56
+1700000000 52:54:00:ab:cd:ef 192.168.122.11 * *
+`,
+			expected: []leaseEntry{
+				{Mac: "52:54:00:12:34:56", IP: netip.MustParseAddr("192.168.122.10")},
+				{Mac: "52:54:00:ab:cd:ef", IP: netip.MustParseAddr("192.168.122.11")},
+			},
+		},
+		{
+			name: "macOS bootpd",
+			content: `{
+	name=vm1
+	ip_address=192.168.64.2
+	hw_address=1,52:54:0:12:34:56
+	identifier=1,52:54:0:12:34:56
+	lease=0x65a1b2c3
+}
+{
+	name=vm2
+	ip_address=192.168.64.3
+	hw_address=1,52:54:0:ab:cd:ef
+	lease=0x65a1b2c3
+}
+`,
+			expected: []leaseEntry{
+				{Mac: "52:54:00:12:34:56", IP: netip.MustParseAddr("192.168.64.2")},
+				{Mac: "52:54:00:ab:cd:ef", IP: netip.MustParseAddr("192.168.64.3")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := readLeaseFile(writeLeaseFile(t, tt.content))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, entries)
+		})
+	}
+}
+
+func TestAddress_Family(t *testing.T) {
+	assert.Equal(t, IPv4, Address{IP: netip.MustParseAddr("10.0.0.1")}.Family())
+	assert.Equal(t, IPv6, Address{IP: netip.MustParseAddr("fe80::1")}.Family())
+}
@@ -9,14 +9,20 @@ import (
 )
 
 type NetworkConfig struct {
-	Driver string
-	Mac    string
+	Driver    string
+	Mac       string
+	RateLimit *RateLimit // applied to the tap device on the host once the instance is running or the NIC attached
+	Capture   bool       // write all NIC traffic from boot or attach onwards; see nicCapturePath for the file
+
+	bootIndex int // set from BootConfig.Order for UEFI firmware
 }
 
 type Hardware struct {
-	Memory uint32 // in MB
-	Disk   uint32 // in MB
-	Cpus   int
+	Memory        uint32 // in MB
+	MemoryOptions MemoryConfig
+	Disk          uint32 // in MB
+	Cpus          int
+	Cpu           CpuConfig
 }
 
 type CloudInitConfig struct {
@@ -26,7 +32,8 @@ type CloudInitConfig struct {
 
 type QemuConfig struct {
 	Id          string
-	Machine     string
+	Arch        utils.Arch // guest architecture; defaults to the host architecture
+	Machine     string     // defaults to the machine type of Arch, see utils.GetMachineTypeForArch
 	Accelerator string
 	Network     NetworkConfig
 	Platform    *PlatformConfig
@@ -34,6 +41,23 @@ type QemuConfig struct {
 	CloudInit   CloudInitConfig
 	Hardware    Hardware
 	Bios        string
+	Firmware    *utils.FirmwareDescriptor // UEFI firmware loaded from flash; mutually exclusive with Bios
+	Tpm         *TpmConfig                // software TPM; the swtpm process is managed by Start
+	Kernel      string                    // direct kernel boot; the image becomes optional
+	Initrd      string
+	Append      string // kernel command line
+	Dtb         string
+	Cdroms      []string         // ISO images attached as CD-ROM drives; "" for an empty drive
+	Boot        *BootConfig      // boot order and menu; firmware defaults when nil
+	Shares      []Share          // host directories; virtiofsd daemons are managed by Start
+	VsockCID    uint32           // guest CID of a virtio-vsock device; 0 for none
+	Display     *DisplayConfig   // graphics device and remote display; headless when nil
+	Disks       []DiskConfig     // additional disks; see Instance.AttachDisk for hotplug
+	Nics        []NicConfig      // additional NICs; see Instance.AttachNIC for hotplug
+	PciDevices  []PciPassthrough // host PCI devices assigned through VFIO; Linux only
+	UsbDevices  []UsbPassthrough // host USB devices
+	Sysfs       utils.Sysfs      // where PciDevices are looked up; defaults to utils.HostSysfs
+	Caps        *Capabilities    // when set, options the installed QEMU cannot honour are rejected
 }
 
 type Option func(*QemuConfig)
@@ -44,6 +68,12 @@ func Id(id string) Option {
 	}
 }
 
+func Arch(arch utils.Arch) Option {
+	return func(config *QemuConfig) {
+		config.Arch = arch
+	}
+}
+
 func Machine(machine string) Option {
 	return func(config *QemuConfig) {
 		config.Machine = machine
@@ -86,6 +116,12 @@ func Memory(memory uint32) Option {
 	}
 }
 
+func MemoryOptions(memory MemoryConfig) Option {
+	return func(config *QemuConfig) {
+		config.Hardware.MemoryOptions = memory
+	}
+}
+
 func Disk(disk uint32) Option {
 	return func(config *QemuConfig) {
 		config.Hardware.Disk = disk
@@ -98,16 +134,144 @@ func Cpus(cpus int) Option {
 	}
 }
 
+func Cpu(cpu CpuConfig) Option {
+	return func(config *QemuConfig) {
+		config.Hardware.Cpu = cpu
+	}
+}
+
 func Bios(bios string) Option {
 	return func(config *QemuConfig) {
 		config.Bios = bios
 	}
 }
 
+func Firmware(firmware *utils.FirmwareDescriptor) Option {
+	return func(config *QemuConfig) {
+		config.Firmware = firmware
+	}
+}
+
+func Tpm(tpm *TpmConfig) Option {
+	return func(config *QemuConfig) {
+		config.Tpm = tpm
+	}
+}
+
+func Kernel(kernel string) Option {
+	return func(config *QemuConfig) {
+		config.Kernel = kernel
+	}
+}
+
+func Initrd(initrd string) Option {
+	return func(config *QemuConfig) {
+		config.Initrd = initrd
+	}
+}
+
+func Append(cmdline string) Option {
+	return func(config *QemuConfig) {
+		config.Append = cmdline
+	}
+}
+
+func Dtb(dtb string) Option {
+	return func(config *QemuConfig) {
+		config.Dtb = dtb
+	}
+}
+
+func Cdroms(cdroms ...string) Option {
+	return func(config *QemuConfig) {
+		config.Cdroms = cdroms
+	}
+}
+
+func Boot(boot *BootConfig) Option {
+	return func(config *QemuConfig) {
+		config.Boot = boot
+	}
+}
+
+func Shares(shares ...Share) Option {
+	return func(config *QemuConfig) {
+		config.Shares = shares
+	}
+}
+
+func VsockCID(cid uint32) Option {
+	return func(config *QemuConfig) {
+		config.VsockCID = cid
+	}
+}
+
+func Display(display *DisplayConfig) Option {
+	return func(config *QemuConfig) {
+		config.Display = display
+	}
+}
+
+func Disks(disks ...DiskConfig) Option {
+	return func(config *QemuConfig) {
+		config.Disks = disks
+	}
+}
+
+func Nics(nics ...NicConfig) Option {
+	return func(config *QemuConfig) {
+		config.Nics = nics
+	}
+}
+
+func PciDevices(devices ...PciPassthrough) Option {
+	return func(config *QemuConfig) {
+		config.PciDevices = devices
+	}
+}
+
+func UsbDevices(devices ...UsbPassthrough) Option {
+	return func(config *QemuConfig) {
+		config.UsbDevices = devices
+	}
+}
+
+func Sysfs(sysfs utils.Sysfs) Option {
+	return func(config *QemuConfig) {
+		config.Sysfs = sysfs
+	}
+}
+
+func QemuCapabilities(caps *Capabilities) Option {
+	return func(config *QemuConfig) {
+		config.Caps = caps
+	}
+}
+
+// applyArchDefaults defaults the architecture to the host's and the machine type to the
+// one matching the architecture.
+func (c *QemuConfig) applyArchDefaults() error {
+	if c.Arch == "" {
+		hostArch, hostArchErr := utils.HostArch()
+		if hostArchErr != nil {
+			return hostArchErr
+		}
+		c.Arch = hostArch
+	}
+	if c.Machine == "" {
+		machine, machineErr := utils.GetMachineTypeForArch(c.Arch)
+		if machineErr != nil {
+			return machineErr
+		}
+		c.Machine = machine
+	}
+	return nil
+}
+
 func BuildQemuArgs(opts ...Option) ([]string, error) {
 	config := &QemuConfig{
-		Machine: "q35",
 		Network: NetworkConfig{
+			// QEMU resolves virtio aliases to the PCI or CCW (s390x) variant of the machine.
 			Driver: "virtio-net",
 		},
 		Hardware: Hardware{
@@ -115,22 +279,74 @@ func BuildQemuArgs(opts ...Option) ([]string, error) {
 			Disk:   40 * 1024, // 40 GB
 			Cpus:   1,
 		},
+		Sysfs: utils.HostSysfs,
 	}
 
 	for _, opt := range opts {
 		opt(config)
 	}
 
+	if defaultsErr := config.applyArchDefaults(); defaultsErr != nil {
+		return nil, defaultsErr
+	}
+
+	if config.Firmware != nil && config.Bios != "" {
+		return nil, fmt.Errorf("firmware configuration: Bios and Firmware are mutually exclusive")
+	}
+
+	machine := config.Machine
+	if config.Firmware != nil && config.Firmware.HasFeature(utils.FirmwareRequiresSMM) {
+		machine += ",smm=on"
+	}
+
+	if sharesErr := validateShares(config.Shares); sharesErr != nil {
+		return nil, sharesErr
+	}
+
+	memoryMachine, memoryArgs, memoryErr := buildMemoryArgs(config.Hardware.Memory, config.Hardware.MemoryOptions, hasVirtiofsShare(config.Shares))
+	if memoryErr != nil {
+		return nil, memoryErr
+	}
+	for _, property := range memoryMachine {
+		machine += "," + property
+	}
+
+	if config.Caps != nil {
+		if capsErr := config.Caps.check(config); capsErr != nil {
+			return nil, capsErr
+		}
+	}
+
+	cpuArg, smpArg, cpuErr := buildCpuArgs(config.Hardware.Cpus, config.Hardware.Cpu, config.Accelerator, config.Arch)
+	if cpuErr != nil {
+		return nil, cpuErr
+	}
+
+	kernelArgs, kernelErr := buildKernelArgs(config.Kernel, config.Initrd, config.Append, config.Dtb)
+	if kernelErr != nil {
+		return nil, kernelErr
+	}
+
 	imagePath := ImagePath(config.Dir)
 	qmpPath := QmpSocketPath(config.Dir)
 	qgaPath := QgaSocketPath(config.Dir)
 	pidfilePath := PidfilePath(config.Dir)
 
+	// A directly booted kernel may run without a root disk.
+	hasImage := true
+	if config.Kernel != "" {
+		if _, statErr := os.Stat(imagePath); os.IsNotExist(statErr) {
+			hasImage = false
+		}
+	}
+
 	image := utils.Image{
 		Path: imagePath,
 	}
 
-	if info, infoErr := image.Info(); infoErr == nil {
+	if !hasImage {
+		slog.Debug("No image in instance directory, booting kernel without a root disk")
+	} else if info, infoErr := image.Info(); infoErr == nil {
 		if utils.BytesToMb(info.VirtualSizeBytes) < uint64(config.Hardware.Disk) {
 			if resizeErr := image.Resize(utils.MbToBytes(uint64(config.Hardware.Disk))); resizeErr != nil {
 				return nil, resizeErr
@@ -140,23 +356,78 @@ func BuildQemuArgs(opts ...Option) ([]string, error) {
 		slog.Error("Failed to get image info", "error", infoErr)
 	}
 
+	bootArg, bootIndexes, bootErr := config.bootArgs()
+	if bootErr != nil {
+		return nil, bootErr
+	}
+
 	args := []string{}
 
-	args = append(args, "-machine", config.Machine)
+	args = append(args, "-machine", machine)
 	args = append(args, "-accel", config.Accelerator)
-	args = append(args, "-m", utils.FormatMb(config.Hardware.Memory))
-	args = append(args, "-nographic")
+	args = append(args, memoryArgs...)
+
+	displayArgs, displayErr := buildDisplayArgs(config.Dir, config.Display, config.Arch)
+	if displayErr != nil {
+		return nil, displayErr
+	}
+	args = append(args, displayArgs...)
+	args = append(args, "-monitor", "none")
+	args = append(args, buildConsoleArgs(config.Dir)...)
 
+	mac, macErr := utils.ValidateMAC(config.Network.Mac)
+	if macErr != nil {
+		return nil, fmt.Errorf("network configuration: %w", macErr)
+	}
+	config.Network.Mac = mac
+
+	config.Network.bootIndex = bootIndexes['n']
 	netArgs, netArgsErr := buildNetwork(config.Id, config.Network, config.Platform)
 	if netArgsErr != nil {
 		return nil, netArgsErr
 	}
 	args = append(args, netArgs...)
 
+	if config.Network.Capture {
+		args = append(args, captureArgs(config.Id, CapturePath(config.Dir))...)
+	}
+
+	nicArgs, nicErr := buildNicArgs(config.Dir, config.Id, config.Nics)
+	if nicErr != nil {
+		return nil, nicErr
+	}
+	args = append(args, nicArgs...)
+
 	args = append(args, "-qmp", fmt.Sprintf("unix:%s,server,wait=off", qmpPath))
-	args = append(args, "-cpu", "host")
-	args = append(args, "-smp", fmt.Sprintf("%d", config.Hardware.Cpus))
-	args = append(args, "-hda", imagePath)
+	args = append(args, "-cpu", cpuArg)
+	args = append(args, "-smp", smpArg)
+	if hasImage {
+		args = append(args, buildRootDiskArgs(imagePath, config.Arch, bootIndexes['c'])...)
+	}
+	args = append(args, kernelArgs...)
+
+	diskArgs, diskErr := buildDiskArgs(config.Disks)
+	if diskErr != nil {
+		return nil, diskErr
+	}
+	args = append(args, diskArgs...)
+
+	passthroughArgs, passthroughErr := buildPassthroughArgs(config.Sysfs, config.PciDevices, config.UsbDevices)
+	if passthroughErr != nil {
+		return nil, passthroughErr
+	}
+	args = append(args, passthroughArgs...)
+
+	cdromArgs, cdromErr := buildCdromArgs(config.Cdroms, config.Arch, bootIndexes['d'])
+	if cdromErr != nil {
+		return nil, cdromErr
+	}
+	args = append(args, cdromArgs...)
+
+	if bootArg != "" {
+		args = append(args, "-boot", bootArg)
+	}
+
 	args = append(args, "-pidfile", pidfilePath)
 	args = append(args, "-device", "virtio-serial")
 	args = append(args, "-chardev", fmt.Sprintf("socket,path=%s,server=on,wait=off,id=charchannel0", qgaPath))
@@ -167,7 +438,14 @@ func BuildQemuArgs(opts ...Option) ([]string, error) {
 		return nil, mkdirErr
 	}
 
-	cloudInitPath, cloudInitErr := utils.CreateCloudInitISO(config.CloudInit.Userdata, config.CloudInit.NetworkConfig, cloudInitDir, config.Id)
+	args = append(args, buildShareArgs(config.Dir, config.Shares)...)
+
+	userdata, mountsErr := utils.MergeCloudInitMounts(config.CloudInit.Userdata, shareMounts(config.Shares))
+	if mountsErr != nil {
+		return nil, mountsErr
+	}
+
+	cloudInitPath, cloudInitErr := utils.CreateCloudInitISO(userdata, config.CloudInit.NetworkConfig, cloudInitDir, config.Id)
 	if cloudInitErr != nil {
 		return nil, cloudInitErr
 	}
@@ -177,7 +455,36 @@ func BuildQemuArgs(opts ...Option) ([]string, error) {
 		args = append(args, "-bios", config.Bios)
 	}
 
-	args = append(args, "-device", fmt.Sprintf("virtio-balloon,id=balloon-%s,guest-stats-polling-interval=2", config.Id))
+	if config.Firmware != nil {
+		firmwareArgs, firmwareErr := buildFirmwareArgs(config.Dir, config.Firmware)
+		if firmwareErr != nil {
+			return nil, firmwareErr
+		}
+		args = append(args, firmwareArgs...)
+
+		if config.Firmware.HasFeature(utils.FirmwareRequiresSMM) {
+			// Only code running in SMM may write to the variable store.
+			args = append(args, "-global", "driver=cfi.pflash01,property=secure,value=on")
+		}
+	}
+
+	if config.Tpm != nil {
+		tpmModel, tpmModelErr := config.Tpm.model(config.Arch)
+		if tpmModelErr != nil {
+			return nil, tpmModelErr
+		}
+		args = append(args, buildTpmArgs(config.Dir, tpmModel)...)
+	}
+
+	if config.VsockCID != 0 {
+		vsockArgs, vsockErr := buildVsockArgs(config.VsockCID, config.Arch)
+		if vsockErr != nil {
+			return nil, vsockErr
+		}
+		args = append(args, vsockArgs...)
+	}
+
+	args = append(args, "-device", fmt.Sprintf("virtio-balloon,id=%s,guest-stats-polling-interval=2", balloonId(config.Id)))
 
 	return args, nil
 }
@@ -0,0 +1,37 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQemuConfig_ApplyArchDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          QemuConfig
+		expectedMachine string
+	}{
+		{name: "x86_64", config: QemuConfig{Arch: utils.ArchX86_64}, expectedMachine: "q35"},
+		{name: "aarch64", config: QemuConfig{Arch: utils.ArchAarch64}, expectedMachine: "virt"},
+		{name: "s390x", config: QemuConfig{Arch: utils.ArchS390x}, expectedMachine: "s390-ccw-virtio"},
+		{name: "explicit machine", config: QemuConfig{Arch: utils.ArchAarch64, Machine: "sbsa-ref"}, expectedMachine: "sbsa-ref"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.config.applyArchDefaults())
+			assert.Equal(t, tt.expectedMachine, tt.config.Machine)
+		})
+	}
+
+	config := QemuConfig{}
+	require.NoError(t, config.applyArchDefaults())
+	hostArch, err := utils.HostArch()
+	require.NoError(t, err)
+	assert.Equal(t, hostArch, config.Arch)
+
+	assert.Error(t, (&QemuConfig{Arch: "mips"}).applyArchDefaults())
+}
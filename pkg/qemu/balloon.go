@@ -0,0 +1,211 @@
+package qemu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+const (
+	defaultBalloonInterval     = 10 * time.Second
+	defaultBalloonGuestReserve = 256 // MB
+	defaultBalloonGuestMinimum = 512 // MB
+	defaultBalloonGrowStep     = 256 // MB
+)
+
+func balloonId(id string) string {
+	return fmt.Sprintf("balloon-%s", id)
+}
+
+// MemoryStats reports guest memory, in MB. Values the guest does not report are 0.
+type MemoryStats struct {
+	Actual      uint64 // memory currently given to the guest by the balloon
+	Total       uint64
+	Free        uint64
+	Available   uint64 // free memory plus reclaimable caches
+	DiskCaches  uint64
+	SwapIn      uint64 // in pages
+	SwapOut     uint64 // in pages
+	MajorFaults uint64
+	MinorFaults uint64
+	LastUpdate  time.Time // when the guest last reported its statistics
+}
+
+// SetBalloon inflates or deflates the balloon so that the guest has targetMB of memory.
+func (i *Instance) SetBalloon(ctx context.Context, targetMB uint64) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return monitor.Execute(ctx, "balloon", map[string]interface{}{
+		"value": utils.MbToBytes(targetMB),
+	}, nil)
+}
+
+// MemoryStats returns the balloon size and the guest's memory statistics, which the
+// balloon driver reports every few seconds.
+func (i *Instance) MemoryStats(ctx context.Context) (*MemoryStats, error) {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return nil, monitorErr
+	}
+	defer monitor.Close()
+
+	var balloon struct {
+		Actual uint64 `json:"actual"`
+	}
+	if execErr := monitor.Execute(ctx, "query-balloon", nil, &balloon); execErr != nil {
+		return nil, execErr
+	}
+
+	var guestStats struct {
+		Stats      map[string]json.Number `json:"stats"`
+		LastUpdate int64                  `json:"last-update"`
+	}
+	if execErr := monitor.Execute(ctx, "qom-get", map[string]interface{}{
+		"path":     "/machine/peripheral/" + balloonId(i.Name),
+		"property": "guest-stats",
+	}, &guestStats); execErr != nil {
+		return nil, execErr
+	}
+
+	stat := func(name string) uint64 {
+		// Unreported statistics are -1, which some QEMU versions print as an unsigned value.
+		value, parseErr := strconv.ParseUint(guestStats.Stats[name].String(), 10, 64)
+		if parseErr != nil || value == math.MaxUint64 {
+			return 0
+		}
+		return value
+	}
+
+	stats := &MemoryStats{
+		Actual:      utils.BytesToMb(balloon.Actual),
+		Total:       utils.BytesToMb(stat("stat-total-memory")),
+		Free:        utils.BytesToMb(stat("stat-free-memory")),
+		Available:   utils.BytesToMb(stat("stat-available-memory")),
+		DiskCaches:  utils.BytesToMb(stat("stat-disk-caches")),
+		SwapIn:      stat("stat-swap-in"),
+		SwapOut:     stat("stat-swap-out"),
+		MajorFaults: stat("stat-major-faults"),
+		MinorFaults: stat("stat-minor-faults"),
+	}
+	if guestStats.LastUpdate > 0 {
+		stats.LastUpdate = time.Unix(guestStats.LastUpdate, 0)
+	}
+
+	return stats, nil
+}
+
+// BalloonPolicy reclaims idle guest memory while the host is under memory pressure, and
+// returns it to the guests once the pressure is gone. All sizes are in MB.
+type BalloonPolicy struct {
+	Interval         time.Duration // defaults to 10s
+	HostMinAvailable uint64        // the host is under pressure below this; defaults to 10% of host memory
+	GuestReserve     uint64        // available memory left to each guest; defaults to 256
+	GuestMinimum     uint64        // guests never shrink below this; defaults to 512
+	GrowStep         uint64        // memory returned per interval once pressure is gone; defaults to 256
+}
+
+// Run applies the policy every interval to the instances returned by instances, until
+// ctx is done.
+func (p *BalloonPolicy) Run(ctx context.Context, instances func() []*Instance) error {
+	interval := p.Interval
+	if interval == 0 {
+		interval = defaultBalloonInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if applyErr := p.apply(ctx, instances()); applyErr != nil {
+			slog.Warn("Failed to apply balloon policy", "error", applyErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *BalloonPolicy) apply(ctx context.Context, instances []*Instance) error {
+	host, hostErr := utils.HostMemory()
+	if hostErr != nil {
+		return hostErr
+	}
+
+	minAvailable := p.HostMinAvailable
+	if minAvailable == 0 {
+		minAvailable = host.Total / 10
+	}
+	underPressure := host.Available < minAvailable
+
+	for _, instance := range instances {
+		stats, statsErr := instance.MemoryStats(ctx)
+		if statsErr != nil {
+			slog.Debug("Memory statistics unavailable", "instance", instance.Name, "error", statsErr)
+			continue
+		}
+
+		configured := stats.Actual
+		if manifest, manifestErr := ReadManifest(instance.Dir); manifestErr == nil && manifest.Memory != 0 {
+			configured = uint64(manifest.Memory)
+		}
+
+		target := p.target(stats, configured, underPressure)
+		if target == stats.Actual {
+			continue
+		}
+
+		slog.Info("Resizing balloon", "instance", instance.Name, "from", stats.Actual, "to", target, "hostAvailable", host.Available)
+		if balloonErr := instance.SetBalloon(ctx, target); balloonErr != nil {
+			slog.Warn("Failed to resize balloon", "instance", instance.Name, "error", balloonErr)
+		}
+	}
+
+	return nil
+}
+
+// target computes the guest memory for the next interval.
+func (p *BalloonPolicy) target(stats *MemoryStats, configured uint64, underPressure bool) uint64 {
+	if !underPressure {
+		growStep := p.GrowStep
+		if growStep == 0 {
+			growStep = defaultBalloonGrowStep
+		}
+		return min(stats.Actual+growStep, configured)
+	}
+
+	// Without statistics there is no way to tell how much memory is idle.
+	if stats.LastUpdate.IsZero() || stats.Available == 0 {
+		return stats.Actual
+	}
+
+	reserve := p.GuestReserve
+	if reserve == 0 {
+		reserve = defaultBalloonGuestReserve
+	}
+	minimum := p.GuestMinimum
+	if minimum == 0 {
+		minimum = defaultBalloonGuestMinimum
+	}
+
+	if stats.Available <= reserve {
+		return stats.Actual
+	}
+	reclaimable := stats.Available - reserve
+	if reclaimable >= stats.Actual {
+		return min(minimum, stats.Actual)
+	}
+	return max(stats.Actual-reclaimable, min(minimum, stats.Actual))
+}
@@ -0,0 +1,68 @@
+package qemu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalloonPolicyTarget(t *testing.T) {
+	policy := &BalloonPolicy{}
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		stats         MemoryStats
+		configured    uint64
+		underPressure bool
+		expected      uint64
+	}{
+		{
+			name:          "reclaims idle memory under pressure",
+			stats:         MemoryStats{Actual: 4096, Available: 2304, LastUpdate: now},
+			configured:    4096,
+			underPressure: true,
+			expected:      2048,
+		},
+		{
+			name:          "keeps the guest minimum",
+			stats:         MemoryStats{Actual: 1024, Available: 1000, LastUpdate: now},
+			configured:    1024,
+			underPressure: true,
+			expected:      512,
+		},
+		{
+			name:          "leaves busy guests alone",
+			stats:         MemoryStats{Actual: 2048, Available: 200, LastUpdate: now},
+			configured:    2048,
+			underPressure: true,
+			expected:      2048,
+		},
+		{
+			name:          "needs guest statistics",
+			stats:         MemoryStats{Actual: 2048},
+			configured:    2048,
+			underPressure: true,
+			expected:      2048,
+		},
+		{
+			name:       "gives memory back without pressure",
+			stats:      MemoryStats{Actual: 1024, LastUpdate: now},
+			configured: 1536,
+			expected:   1280,
+		},
+		{
+			name:       "never exceeds the configured memory",
+			stats:      MemoryStats{Actual: 1400, LastUpdate: now},
+			configured: 1536,
+			expected:   1536,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policy.target(&tt.stats, tt.configured, tt.underPressure))
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package qemu
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/q-controller/qemu-client/pkg/qmp"
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+const probeTimeout = 10 * time.Second
+
+var versionPattern = regexp.MustCompile(`version (\d+\.\d+(?:\.\d+)?)`)
+
+// Capabilities describes what an installed QEMU binary supports.
+type Capabilities struct {
+	Binary       string   `json:"binary"`
+	Version      string   `json:"version"`
+	Target       string   `json:"target"`   // emulated architecture, e.g., "x86_64"; see utils.QemuTarget
+	Machines     []string `json:"machines"` // machine names and their aliases, e.g., "q35"
+	CpuModels    []string `json:"cpuModels"`
+	Types        []string `json:"types"` // QOM types: devices, objects and backends
+	Accelerators []string `json:"accelerators"`
+}
+
+func (c *Capabilities) HasMachine(name string) bool {
+	return slices.Contains(c.Machines, name)
+}
+
+func (c *Capabilities) HasCpuModel(name string) bool {
+	return slices.Contains(c.CpuModels, name)
+}
+
+func (c *Capabilities) HasType(name string) bool {
+	return slices.Contains(c.Types, name)
+}
+
+func (c *Capabilities) HasAccelerator(name string) bool {
+	return slices.Contains(c.Accelerators, name)
+}
+
+// check rejects options the binary cannot honour.
+func (c *Capabilities) check(config *QemuConfig) error {
+	// A binary chosen via QEMU_BINARY or Config.QemuBinary may emulate another target.
+	if target, targetErr := utils.QemuTarget(config.Arch); targetErr == nil && c.Target != "" && c.Target != target {
+		return fmt.Errorf("%s (%s) emulates %s, not %s", c.Binary, c.Version, c.Target, config.Arch)
+	}
+
+	if !c.HasMachine(config.Machine) {
+		return fmt.Errorf("%s (%s) does not support machine %q", c.Binary, c.Version, config.Machine)
+	}
+
+	if accel := strings.Split(config.Accelerator, ",")[0]; accel != "" && !c.HasAccelerator(accel) {
+		return fmt.Errorf("%s (%s) does not support accelerator %q", c.Binary, c.Version, accel)
+	}
+
+	// "host" is only listed when probing with hardware acceleration enabled.
+	if model := config.Hardware.Cpu.Model; model != "" && model != "host" && len(c.CpuModels) > 0 && !c.HasCpuModel(model) {
+		return fmt.Errorf("%s (%s) does not support CPU model %q", c.Binary, c.Version, model)
+	}
+
+	capture := config.Network.Capture || slices.ContainsFunc(config.Nics, func(nic NicConfig) bool { return nic.Network.Capture })
+	if capture && !c.HasType("filter-dump") {
+		return fmt.Errorf("%s (%s) does not support packet capture (filter-dump)", c.Binary, c.Version)
+	}
+
+	if config.Tpm != nil {
+		if !c.HasType("tpm-emulator") {
+			return fmt.Errorf("%s (%s) does not support swtpm (tpm-emulator)", c.Binary, c.Version)
+		}
+		if model, modelErr := config.Tpm.model(config.Arch); modelErr == nil && !c.HasType(model) {
+			return fmt.Errorf("%s (%s) does not support TPM device %q", c.Binary, c.Version, model)
+		}
+	}
+
+	for _, share := range config.Shares {
+		device := "vhost-user-fs-pci"
+		if share.shareType() == Share9p {
+			device = "virtio-9p-pci"
+		}
+		if !c.HasType(device) {
+			return fmt.Errorf("%s (%s) does not support %s shares (%s)", c.Binary, c.Version, share.shareType(), device)
+		}
+	}
+
+	if config.Display != nil && config.Display.Gpu == GpuVirtio && !c.HasType("virtio-gpu-pci") {
+		return fmt.Errorf("%s (%s) does not support virtio-gpu (virtio-gpu-pci)", c.Binary, c.Version)
+	}
+
+	if config.Hardware.MemoryOptions.Hotplug == MemoryHotplugVirtio && !c.HasType("virtio-mem-pci") {
+		return fmt.Errorf("%s (%s) does not support virtio-mem (virtio-mem-pci)", c.Binary, c.Version)
+	}
+
+	if config.VsockCID != 0 && !c.HasType("vhost-vsock-pci") && !c.HasType("vhost-vsock-ccw") {
+		return fmt.Errorf("%s (%s) does not support vsock (vhost-vsock)", c.Binary, c.Version)
+	}
+
+	if len(config.PciDevices) > 0 && !c.HasType("vfio-pci") {
+		return fmt.Errorf("%s (%s) does not support PCI passthrough (vfio-pci)", c.Binary, c.Version)
+	}
+
+	if len(config.UsbDevices) > 0 && !c.HasType("usb-host") {
+		return fmt.Errorf("%s (%s) does not support USB passthrough (usb-host)", c.Binary, c.Version)
+	}
+
+	return nil
+}
+
+// ProbeCapabilities queries a QEMU binary for its target, supported machines, CPU models,
+// QOM types and accelerators. Results are cached in the user cache dir until the binary
+// is replaced.
+func ProbeCapabilities(ctx context.Context, binary string) (*Capabilities, error) {
+	cacheDir := ""
+	if userCacheDir, cacheDirErr := os.UserCacheDir(); cacheDirErr == nil {
+		cacheDir = filepath.Join(userCacheDir, "qemu-client", "capabilities")
+	}
+
+	key, keyErr := capabilitiesCacheKey(cacheDir, binary)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	cachePath := ""
+	if cacheDir != "" {
+		cachePath = filepath.Join(cacheDir, key+".json")
+		if caps, cacheErr := readCapabilitiesCache(cachePath); cacheErr == nil {
+			caps.Binary = binary
+			return caps, nil
+		}
+	}
+
+	caps, probeErr := probe(ctx, binary)
+	if probeErr != nil {
+		return nil, probeErr
+	}
+
+	if cachePath != "" {
+		if cacheErr := writeCapabilitiesCache(cachePath, caps); cacheErr != nil {
+			slog.Debug("Failed to cache QEMU capabilities", "error", cacheErr)
+		}
+	}
+
+	return caps, nil
+}
+
+func probe(ctx context.Context, binary string) (*Capabilities, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	versionOutput, versionErr := exec.CommandContext(ctx, binary, "--version").Output()
+	if versionErr != nil {
+		return nil, fmt.Errorf("%s --version failed: %w", binary, versionErr)
+	}
+	version, parseErr := parseQemuVersion(string(versionOutput))
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	dir, dirErr := os.MkdirTemp("", "qemu-probe-*")
+	if dirErr != nil {
+		return nil, dirErr
+	}
+	defer os.RemoveAll(dir)
+
+	qmpPath := filepath.Join(dir, "qmp.sock")
+	command := exec.CommandContext(ctx, binary,
+		"-machine", "none",
+		"-nodefaults",
+		"-display", "none",
+		"-qmp", fmt.Sprintf("unix:%s,server=on,wait=off", qmpPath),
+	)
+	if startErr := command.Start(); startErr != nil {
+		return nil, fmt.Errorf("failed to start %s for probing: %w", binary, startErr)
+	}
+	defer func() {
+		command.Process.Kill()
+		command.Wait()
+	}()
+
+	monitor, monitorErr := dialWhenReady(ctx, qmpPath)
+	if monitorErr != nil {
+		return nil, monitorErr
+	}
+	defer monitor.Close()
+
+	caps := &Capabilities{
+		Binary:  binary,
+		Version: version,
+	}
+
+	var target struct {
+		Arch string `json:"arch"`
+	}
+	if execErr := monitor.Execute(ctx, "query-target", nil, &target); execErr != nil {
+		return nil, execErr
+	}
+	caps.Target = target.Arch
+
+	var machines []struct {
+		Name  string `json:"name"`
+		Alias string `json:"alias"`
+	}
+	if execErr := monitor.Execute(ctx, "query-machines", nil, &machines); execErr != nil {
+		return nil, execErr
+	}
+	for _, machine := range machines {
+		caps.Machines = append(caps.Machines, machine.Name)
+		if machine.Alias != "" {
+			caps.Machines = append(caps.Machines, machine.Alias)
+		}
+	}
+
+	// Not every target implements CPU model queries.
+	var cpuModels []struct {
+		Name string `json:"name"`
+	}
+	if execErr := monitor.Execute(ctx, "query-cpu-definitions", nil, &cpuModels); execErr == nil {
+		for _, model := range cpuModels {
+			caps.CpuModels = append(caps.CpuModels, model.Name)
+		}
+	}
+
+	var types []struct {
+		Name string `json:"name"`
+	}
+	if execErr := monitor.Execute(ctx, "qom-list-types", nil, &types); execErr != nil {
+		return nil, execErr
+	}
+	for _, t := range types {
+		caps.Types = append(caps.Types, t.Name)
+	}
+
+	// QMP has no accelerator query; accelerators are QOM types implementing "accel".
+	var accels []struct {
+		Name string `json:"name"`
+	}
+	if execErr := monitor.Execute(ctx, "qom-list-types", map[string]interface{}{"implements": "accel"}, &accels); execErr != nil {
+		return nil, execErr
+	}
+	for _, accel := range accels {
+		if name, ok := strings.CutSuffix(accel.Name, "-accel"); ok {
+			caps.Accelerators = append(caps.Accelerators, name)
+		}
+	}
+
+	return caps, nil
+}
+
+// dialWhenReady retries connecting until QEMU has created the QMP socket.
+func dialWhenReady(ctx context.Context, path string) (*qmp.Client, error) {
+	for {
+		monitor, dialErr := qmp.Dial(ctx, path)
+		if dialErr == nil {
+			return monitor, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("QMP socket %s not ready: %w", path, dialErr)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// parseQemuVersion extracts the version from output such as
+// "QEMU emulator version 8.2.2 (Debian 1:8.2.2+ds-0ubuntu1)".
+func parseQemuVersion(output string) (string, error) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("unrecognised QEMU version output: %q", strings.TrimSpace(output))
+	}
+	return match[1], nil
+}
+
+// capabilitiesCacheKey identifies a binary by the sha256 of its content. Hashing takes a
+// while for binaries of this size, so the hash is remembered in dir under the resolved
+// path, inode, size and modification time of the binary, which change whenever it is
+// replaced or upgraded in place. An empty dir always hashes the content.
+func capabilitiesCacheKey(dir, path string) (string, error) {
+	resolved, resolveErr := filepath.EvalSymlinks(path)
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+
+	info, statErr := os.Stat(resolved)
+	if statErr != nil {
+		return "", statErr
+	}
+
+	var inode uint64
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		inode = uint64(stat.Ino)
+	}
+	statKey := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d\x00%d", resolved, inode, info.Size(), info.ModTime().UnixNano())))
+	hashPath := ""
+	if dir != "" {
+		hashPath = filepath.Join(dir, "binaries", hex.EncodeToString(statKey[:]))
+		if hash, readErr := os.ReadFile(hashPath); readErr == nil && len(hash) == sha256.Size*2 {
+			return string(hash), nil
+		}
+	}
+
+	file, openErr := os.Open(resolved)
+	if openErr != nil {
+		return "", openErr
+	}
+	defer file.Close()
+
+	content := sha256.New()
+	if _, copyErr := io.Copy(content, file); copyErr != nil {
+		return "", copyErr
+	}
+	hash := hex.EncodeToString(content.Sum(nil))
+
+	if hashPath != "" {
+		if mkdirErr := os.MkdirAll(filepath.Dir(hashPath), 0755); mkdirErr == nil {
+			os.WriteFile(hashPath, []byte(hash), 0644)
+		}
+	}
+	return hash, nil
+}
+
+func readCapabilitiesCache(path string) (*Capabilities, error) {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+	var caps Capabilities
+	if unmarshalErr := json.Unmarshal(data, &caps); unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+	return &caps, nil
+}
+
+func writeCapabilitiesCache(path string, caps *Capabilities) error {
+	if mkdirErr := os.MkdirAll(filepath.Dir(path), 0755); mkdirErr != nil {
+		return mkdirErr
+	}
+	data, marshalErr := json.MarshalIndent(caps, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return os.WriteFile(path, data, 0644)
+}
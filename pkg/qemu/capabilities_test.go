@@ -0,0 +1,125 @@
+package qemu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQemuVersion(t *testing.T) {
+	version, err := parseQemuVersion("QEMU emulator version 8.2.2 (Debian 1:8.2.2+ds-0ubuntu1)\nCopyright (c) 2003-2023 Fabrice Bellard and the QEMU Project developers\n")
+	require.NoError(t, err)
+	assert.Equal(t, "8.2.2", version)
+
+	_, err = parseQemuVersion("something else")
+	assert.Error(t, err)
+}
+
+func TestCapabilities_Check(t *testing.T) {
+	caps := &Capabilities{
+		Binary:       "qemu-system-x86_64",
+		Version:      "8.2.2",
+		Target:       "x86_64",
+		Machines:     []string{"pc-q35-8.2", "q35"},
+		CpuModels:    []string{"max", "Skylake-Server"},
+		Types:        []string{"virtio-net-pci"},
+		Accelerators: []string{"tcg", "kvm"},
+	}
+
+	tests := []struct {
+		name    string
+		config  QemuConfig
+		wantErr bool
+	}{
+		{
+			name:   "supported",
+			config: QemuConfig{Machine: "q35", Accelerator: "tcg,thread=multi", Hardware: Hardware{Cpu: CpuConfig{Model: "Skylake-Server"}}},
+		},
+		{
+			name:   "host model is not validated",
+			config: QemuConfig{Machine: "q35", Accelerator: "kvm", Hardware: Hardware{Cpu: CpuConfig{Model: "host"}}},
+		},
+		{
+			name:    "unknown machine",
+			config:  QemuConfig{Machine: "virt", Accelerator: "kvm"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown accelerator",
+			config:  QemuConfig{Machine: "q35", Accelerator: "hvf"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown cpu model",
+			config:  QemuConfig{Machine: "q35", Accelerator: "kvm", Hardware: Hardware{Cpu: CpuConfig{Model: "EPYC"}}},
+			wantErr: true,
+		},
+		{
+			name:    "capture without filter-dump",
+			config:  QemuConfig{Machine: "q35", Accelerator: "kvm", Network: NetworkConfig{Capture: true}},
+			wantErr: true,
+		},
+		{
+			name:    "capture of an additional NIC without filter-dump",
+			config:  QemuConfig{Machine: "q35", Accelerator: "kvm", Nics: []NicConfig{{Id: "nic1", Network: NetworkConfig{Capture: true}}}},
+			wantErr: true,
+		},
+		{
+			name:    "binary emulating another target",
+			config:  QemuConfig{Arch: utils.ArchAarch64, Machine: "q35", Accelerator: "tcg"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := caps.check(&tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCapabilitiesCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := t.TempDir()
+	binary := filepath.Join(dir, "qemu-system-x86_64")
+	require.NoError(t, os.WriteFile(binary, []byte("v1"), 0755))
+	link := filepath.Join(dir, "qemu")
+	require.NoError(t, os.Symlink(binary, link))
+
+	key, err := capabilitiesCacheKey(cacheDir, binary)
+	require.NoError(t, err)
+	content := sha256.Sum256([]byte("v1"))
+	assert.Equal(t, hex.EncodeToString(content[:]), key, "the key is the hash of the content")
+	linked, err := capabilitiesCacheKey(cacheDir, link)
+	require.NoError(t, err)
+	assert.Equal(t, key, linked, "symlinks share the cache of their target")
+	uncached, err := capabilitiesCacheKey("", binary)
+	require.NoError(t, err)
+	assert.Equal(t, key, uncached)
+
+	// An upgrade in place changes the modification time, so the content is hashed again.
+	require.NoError(t, os.WriteFile(binary, []byte("v2"), 0755))
+	require.NoError(t, os.Chtimes(binary, time.Now(), time.Now().Add(time.Hour)))
+	upgraded, err := capabilitiesCacheKey(cacheDir, binary)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, upgraded)
+
+	// A copy of the same binary elsewhere shares the cache.
+	copied := filepath.Join(dir, "copy")
+	require.NoError(t, os.WriteFile(copied, []byte("v2"), 0755))
+	copiedKey, err := capabilitiesCacheKey(cacheDir, copied)
+	require.NoError(t, err)
+	assert.Equal(t, upgraded, copiedKey)
+}
@@ -0,0 +1,74 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/q-controller/qemu-client/pkg/qmp"
+)
+
+func captureId(id string) string {
+	return fmt.Sprintf("capture-%s", id)
+}
+
+// nicCapturePath is the default capture file of a NIC: CapturePath(dir) for the primary
+// NIC, whose netdev is named after the instance, and capture-<nic>.pcap for others.
+func nicCapturePath(dir, instanceID, nic string) string {
+	if nic == instanceID {
+		return CapturePath(dir)
+	}
+	return filepath.Join(dir, fmt.Sprintf("capture-%s.pcap", nic))
+}
+
+// StartCapture starts writing the traffic of a NIC as pcap to path. nic is the ID passed
+// to AttachNIC, or empty for the primary NIC; an empty path selects a file in the
+// instance directory, see CapturePath.
+func (i *Instance) StartCapture(ctx context.Context, nic, path string) error {
+	if nic == "" {
+		nic = i.Name
+	}
+	if path == "" {
+		path = nicCapturePath(i.Dir, i.Name, nic)
+	}
+
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return startCapture(ctx, monitor, nic, path)
+}
+
+func startCapture(ctx context.Context, monitor *qmp.Client, netdev, path string) error {
+	return monitor.Execute(ctx, "object-add", map[string]interface{}{
+		"qom-type": "filter-dump",
+		"id":       captureId(netdev),
+		"netdev":   netdev,
+		"file":     path,
+	}, nil)
+}
+
+// captureArgs returns the arguments capturing the traffic of netdev from boot onwards.
+func captureArgs(netdev, path string) []string {
+	return []string{"-object", fmt.Sprintf("filter-dump,id=%s,netdev=%s,file=%s", captureId(netdev), netdev, path)}
+}
+
+// StopCapture stops a capture of a NIC started with StartCapture or, for the primary
+// NIC, the Capture option.
+func (i *Instance) StopCapture(ctx context.Context, nic string) error {
+	if nic == "" {
+		nic = i.Name
+	}
+
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return monitor.Execute(ctx, "object-del", map[string]interface{}{
+		"id": captureId(nic),
+	}, nil)
+}
@@ -0,0 +1,33 @@
+package qemu
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstance_Capture(t *testing.T) {
+	instance, monitor := newFakeMonitor(t, nil)
+
+	require.NoError(t, instance.StartCapture(testContext(t), "", ""))
+	assert.Equal(t, map[string]interface{}{
+		"qom-type": "filter-dump",
+		"id":       "capture-vm",
+		"netdev":   "vm",
+		"file":     CapturePath(instance.Dir),
+	}, monitor.arguments("object-add"))
+
+	require.NoError(t, instance.StartCapture(testContext(t), "nic1", ""))
+	assert.Equal(t, map[string]interface{}{
+		"qom-type": "filter-dump",
+		"id":       "capture-nic1",
+		"netdev":   "nic1",
+		"file":     filepath.Join(instance.Dir, "capture-nic1.pcap"),
+	}, monitor.arguments("object-add"))
+
+	require.NoError(t, instance.StopCapture(testContext(t), "nic1"))
+	assert.Equal(t, map[string]interface{}{"id": "capture-nic1"}, monitor.arguments("object-del"))
+	assert.Equal(t, []string{"object-add", "object-add", "object-del"}, monitor.executed())
+}
@@ -0,0 +1,126 @@
+package qemu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// consoleLineLimit caps the length of a buffered line, so output without newlines
+// cannot grow the buffer unbounded.
+const consoleLineLimit = 4096
+
+func ConsoleSocketPath(dir string) string {
+	return filepath.Join(dir, "console.sock")
+}
+
+// ConsoleLogPath is the file QEMU appends all serial console output to, whether or not
+// a client is attached.
+func ConsoleLogPath(dir string) string {
+	return filepath.Join(dir, "console.log")
+}
+
+func buildConsoleArgs(dir string) []string {
+	return []string{
+		"-chardev", fmt.Sprintf("socket,id=serial0,path=%s,server=on,wait=off,logfile=%s,logappend=on", ConsoleSocketPath(dir), ConsoleLogPath(dir)),
+		"-serial", "chardev:serial0",
+	}
+}
+
+// Console attaches to the guest serial console. Only one client can be attached at a time.
+func (i *Instance) Console() (io.ReadWriteCloser, error) {
+	return net.Dial("unix", ConsoleSocketPath(i.Dir))
+}
+
+// ConsoleTail returns the last n lines of serial console output, e.g., to diagnose a
+// guest that failed to boot.
+func (i *Instance) ConsoleTail(n int) ([]string, error) {
+	file, openErr := os.Open(ConsoleLogPath(i.Dir))
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+
+	ring := NewLineRing(n)
+	if _, copyErr := io.Copy(ring, file); copyErr != nil {
+		return nil, copyErr
+	}
+	return ring.Lines(), nil
+}
+
+// LineRing is an io.Writer keeping the last lines written to it. It can be used to
+// tee a Console stream.
+type LineRing struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int  // index the next complete line is stored at
+	full    bool // all slots are in use
+	partial []byte
+}
+
+func NewLineRing(size int) *LineRing {
+	return &LineRing{lines: make([]string, max(size, 1))}
+}
+
+func (r *LineRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := p
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n')
+		n := end
+		if end < 0 {
+			n = len(data)
+		}
+
+		// Overlong lines are split at the limit.
+		if room := consoleLineLimit - len(r.partial); n > room {
+			r.partial = append(r.partial, data[:room]...)
+			r.push()
+			data = data[room:]
+			continue
+		}
+
+		r.partial = append(r.partial, data[:n]...)
+		if end < 0 {
+			break
+		}
+		r.push()
+		data = data[n+1:]
+	}
+
+	return len(p), nil
+}
+
+func (r *LineRing) push() {
+	r.lines[r.next] = string(bytes.TrimSuffix(r.partial, []byte("\r")))
+	r.partial = r.partial[:0]
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Lines returns the buffered lines, oldest first, including an unterminated last line.
+func (r *LineRing) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines := []string{}
+	if r.full {
+		lines = append(lines, r.lines[r.next:]...)
+	}
+	lines = append(lines, r.lines[:r.next]...)
+	if len(r.partial) > 0 {
+		lines = append(lines, string(r.partial))
+		if len(lines) > len(r.lines) {
+			lines = lines[1:]
+		}
+	}
+	return lines
+}
@@ -0,0 +1,39 @@
+package qemu
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineRing(t *testing.T) {
+	ring := NewLineRing(3)
+	assert.Empty(t, ring.Lines())
+
+	io.WriteString(ring, "one\r\ntwo\nthr")
+	io.WriteString(ring, "ee\nfour\nfi")
+	assert.Equal(t, []string{"three", "four", "fi"}, ring.Lines())
+
+	io.WriteString(ring, "ve\n")
+	assert.Equal(t, []string{"three", "four", "five"}, ring.Lines())
+
+	io.WriteString(ring, strings.Repeat("x", consoleLineLimit+1))
+	lines := ring.Lines()
+	require.Len(t, lines, 3)
+	assert.Len(t, lines[1], consoleLineLimit, "overlong lines are split")
+	assert.Equal(t, "x", lines[2])
+}
+
+func TestConsoleTail(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(ConsoleLogPath(dir), []byte("SeaBIOS\nBooting from Hard Disk...\nlogin: "), 0644))
+
+	instance := &Instance{Name: "vm", Dir: dir}
+	lines, err := instance.ConsoleTail(2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Booting from Hard Disk...", "login: "}, lines)
+}
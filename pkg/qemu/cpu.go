@@ -0,0 +1,106 @@
+package qemu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+// CpuConfig holds the guest CPU model and topology.
+type CpuConfig struct {
+	Model    string   // "host", "max" or a named model such as "Skylake-Server"; defaults to "host", or the most capable model under TCG
+	Features []string // e.g., "+avx2", "-svm" or "pmu=off"
+	Sockets  int
+	Dies     int
+	Cores    int
+	Threads  int
+	MaxCpus  int // upper bound for CPU hotplug; defaults to the boot CPU count
+}
+
+// buildCpuArgs returns the -cpu and -smp values for cpus boot CPUs.
+// Topology fields left at zero default to 1 once any of them is set, and the
+// topology must then describe exactly MaxCpus CPUs.
+func buildCpuArgs(cpus int, cpu CpuConfig, accelerator string, arch utils.Arch) (string, string, error) {
+	if cpus < 1 {
+		return "", "", fmt.Errorf("cpu configuration: at least one CPU is required")
+	}
+
+	tcg := strings.Split(accelerator, ",")[0] == utils.TCG
+
+	model := cpu.Model
+	if model == "" {
+		model = "host"
+		if tcg {
+			tcgModel, tcgModelErr := utils.GetCpuModelForArch(arch)
+			if tcgModelErr != nil {
+				return "", "", tcgModelErr
+			}
+			model = tcgModel
+		}
+	}
+	if model == "host" && tcg {
+		return "", "", fmt.Errorf("cpu configuration: model %q requires hardware acceleration; use \"max\" or a named model with tcg", model)
+	}
+
+	cpuArg := model
+	for _, feature := range cpu.Features {
+		// Separators in a name would inject further -cpu properties.
+		toggled := len(feature) > 1 && !strings.ContainsAny(feature[1:], ", =")
+		switch {
+		case strings.HasPrefix(feature, "+") && toggled:
+			cpuArg += fmt.Sprintf(",%s=on", feature[1:])
+		case strings.HasPrefix(feature, "-") && toggled:
+			cpuArg += fmt.Sprintf(",%s=off", feature[1:])
+		case strings.Contains(feature, "=") && !strings.ContainsAny(feature, ", ") && !strings.ContainsAny(feature[:1], "+-"):
+			cpuArg += "," + feature
+		default:
+			return "", "", fmt.Errorf("cpu configuration: invalid feature %q; expected +name, -name or name=value", feature)
+		}
+	}
+
+	maxCpus := cpu.MaxCpus
+	if maxCpus == 0 {
+		maxCpus = cpus
+	}
+	if maxCpus < cpus {
+		return "", "", fmt.Errorf("cpu configuration: MaxCpus (%d) is lower than the CPU count (%d)", maxCpus, cpus)
+	}
+
+	smpArg := fmt.Sprintf("cpus=%d", cpus)
+	if maxCpus != cpus {
+		smpArg += fmt.Sprintf(",maxcpus=%d", maxCpus)
+	}
+
+	topology := []struct {
+		name  string
+		value int
+	}{
+		{"sockets", cpu.Sockets},
+		{"dies", cpu.Dies},
+		{"cores", cpu.Cores},
+		{"threads", cpu.Threads},
+	}
+
+	hasTopology := false
+	for _, t := range topology {
+		if t.value < 0 {
+			return "", "", fmt.Errorf("cpu configuration: %s must not be negative", t.name)
+		}
+		hasTopology = hasTopology || t.value > 0
+	}
+
+	if hasTopology {
+		total := 1
+		for _, t := range topology {
+			value := max(t.value, 1)
+			total *= value
+			smpArg += fmt.Sprintf(",%s=%d", t.name, value)
+		}
+		if total != maxCpus {
+			return "", "", fmt.Errorf("cpu configuration: topology describes %d CPUs but %d are required", total, maxCpus)
+		}
+	}
+
+	return cpuArg, smpArg, nil
+}
@@ -0,0 +1,133 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCpuArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		cpus        int
+		cpu         CpuConfig
+		accelerator string
+		arch        utils.Arch
+		expectedCpu string
+		expectedSmp string
+		wantErr     bool
+	}{
+		{
+			name:        "defaults",
+			cpus:        2,
+			accelerator: "kvm",
+			expectedCpu: "host",
+			expectedSmp: "cpus=2",
+		},
+		{
+			name:        "named model with features",
+			cpus:        1,
+			cpu:         CpuConfig{Model: "Skylake-Server", Features: []string{"+avx2", "-svm", "pmu=off"}},
+			accelerator: "kvm",
+			expectedCpu: "Skylake-Server,avx2=on,svm=off,pmu=off",
+			expectedSmp: "cpus=1",
+		},
+		{
+			name:        "full topology with hotplug headroom",
+			cpus:        4,
+			cpu:         CpuConfig{Model: "max", Sockets: 2, Cores: 4, Threads: 2, MaxCpus: 16},
+			accelerator: "tcg",
+			expectedCpu: "max",
+			expectedSmp: "cpus=4,maxcpus=16,sockets=2,dies=1,cores=4,threads=2",
+		},
+		{
+			name:        "topology mismatch",
+			cpus:        4,
+			cpu:         CpuConfig{Sockets: 1, Cores: 2},
+			accelerator: "kvm",
+			wantErr:     true,
+		},
+		{
+			name:        "max cpus below boot cpus",
+			cpus:        4,
+			cpu:         CpuConfig{MaxCpus: 2},
+			accelerator: "kvm",
+			wantErr:     true,
+		},
+		{
+			name:        "default model under tcg",
+			cpus:        1,
+			accelerator: "tcg,thread=multi",
+			expectedCpu: "max",
+			expectedSmp: "cpus=1",
+		},
+		{
+			name:        "default model for riscv64 under tcg",
+			cpus:        1,
+			accelerator: "tcg",
+			arch:        utils.ArchRiscv64,
+			expectedCpu: "rv64",
+			expectedSmp: "cpus=1",
+		},
+		{
+			name:        "host model under tcg",
+			cpus:        1,
+			cpu:         CpuConfig{Model: "host"},
+			accelerator: "tcg",
+			wantErr:     true,
+		},
+		{
+			name:        "invalid feature",
+			cpus:        1,
+			cpu:         CpuConfig{Features: []string{"avx2"}},
+			accelerator: "kvm",
+			wantErr:     true,
+		},
+		{
+			name:        "property injection via toggled feature",
+			cpus:        1,
+			cpu:         CpuConfig{Features: []string{"+avx2,kvm=off"}},
+			accelerator: "kvm",
+			wantErr:     true,
+		},
+		{
+			name:        "toggled feature with value",
+			cpus:        1,
+			cpu:         CpuConfig{Features: []string{"-pmu=on"}},
+			accelerator: "kvm",
+			wantErr:     true,
+		},
+		{
+			name:        "property injection via name=value",
+			cpus:        1,
+			cpu:         CpuConfig{Features: []string{"pmu=off,kvm=off"}},
+			accelerator: "kvm",
+			wantErr:     true,
+		},
+		{
+			name:        "no cpus",
+			cpus:        0,
+			accelerator: "kvm",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arch := tt.arch
+			if arch == "" {
+				arch = utils.ArchX86_64
+			}
+			cpuArg, smpArg, err := buildCpuArgs(tt.cpus, tt.cpu, tt.accelerator, arch)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCpu, cpuArg)
+			assert.Equal(t, tt.expectedSmp, smpArg)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package qemu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// property is an option of a descriptor. Values are strings, numbers, booleans or
+// nested []property, e.g., the address of a stream netdev.
+type property struct {
+	key   string
+	value interface{}
+}
+
+func prop(key string, value interface{}) property {
+	return property{key: key, value: value}
+}
+
+// descriptor defines a device, netdev or block node once, so that cold-plug (command
+// line) and hotplug (QMP) configurations cannot drift apart.
+type descriptor struct {
+	typeKey string // QMP argument naming the type: "driver" for devices, "type" for netdevs
+	name    string // the driver or netdev type; empty when props carry it, as for blockdevs
+	props   []property
+}
+
+func newDevice(driver string, props ...property) descriptor {
+	return descriptor{typeKey: "driver", name: driver, props: props}
+}
+
+func newNetdev(netdevType string, props ...property) descriptor {
+	return descriptor{typeKey: "type", name: netdevType, props: props}
+}
+
+func newBlockdev(props ...property) descriptor {
+	return descriptor{props: props}
+}
+
+// arg renders the descriptor as a command line option value, e.g.,
+// "virtio-net,netdev=vm,mac=52:54:00:12:34:56,id=vm".
+func (d descriptor) arg() string {
+	parts := []string{}
+	if d.name != "" {
+		parts = append(parts, d.name)
+	}
+	return strings.Join(appendArgs(parts, "", d.props), ",")
+}
+
+func appendArgs(parts []string, prefix string, props []property) []string {
+	for _, p := range props {
+		switch value := p.value.(type) {
+		case []property:
+			parts = appendArgs(parts, prefix+p.key+".", value)
+		case bool:
+			parts = append(parts, fmt.Sprintf("%s%s=%s", prefix, p.key, map[bool]string{true: "on", false: "off"}[value]))
+		default:
+			parts = append(parts, fmt.Sprintf("%s%s=%v", prefix, p.key, value))
+		}
+	}
+	return parts
+}
+
+// qmp renders the descriptor as arguments of device_add, netdev_add or blockdev-add.
+func (d descriptor) qmp() map[string]interface{} {
+	args := qmpArgs(d.props)
+	if d.name != "" {
+		args[d.typeKey] = d.name
+	}
+	return args
+}
+
+func qmpArgs(props []property) map[string]interface{} {
+	args := map[string]interface{}{}
+	for _, p := range props {
+		if nested, ok := p.value.([]property); ok {
+			args[p.key] = qmpArgs(nested)
+		} else {
+			args[p.key] = p.value
+		}
+	}
+	return args
+}
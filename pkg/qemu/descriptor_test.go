@@ -0,0 +1,50 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescriptor(t *testing.T) {
+	netdev := newNetdev("stream", prop("id", "vm"), prop("server", false),
+		prop("addr", []property{prop("type", "unix"), prop("path", "/run/hub.sock")}))
+
+	assert.Equal(t, "stream,id=vm,server=off,addr.type=unix,addr.path=/run/hub.sock", netdev.arg())
+	assert.Equal(t, map[string]interface{}{
+		"type":   "stream",
+		"id":     "vm",
+		"server": false,
+		"addr":   map[string]interface{}{"type": "unix", "path": "/run/hub.sock"},
+	}, netdev.qmp())
+
+	device := newDevice("virtio-net", prop("netdev", "vm"), prop("mac", "52:54:00:12:34:56"), prop("id", "vm"))
+	assert.Equal(t, "virtio-net,netdev=vm,mac=52:54:00:12:34:56,id=vm", device.arg())
+	assert.Equal(t, "virtio-net", device.qmp()["driver"])
+}
+
+func TestDiskDescriptors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.raw")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+
+	args, err := buildDiskArgs([]DiskConfig{{Id: "data", Path: path, Format: "raw", ReadOnly: true}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-blockdev", "node-name=data,driver=raw,read-only=on,file.driver=file,file.filename=" + path + ",file.read-only=on",
+		"-device", "virtio-blk,drive=data,id=data",
+	}, args)
+
+	blockdev, _, err := DiskConfig{Id: "data", Path: path}.descriptors()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"node-name": "data",
+		"driver":    "qcow2",
+		"file":      map[string]interface{}{"driver": "file", "filename": path},
+	}, blockdev.qmp())
+
+	_, err = buildDiskArgs([]DiskConfig{{Id: "data", Path: path}, {Id: "data", Path: path}})
+	assert.Error(t, err, "duplicate IDs")
+}
@@ -0,0 +1,162 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+type DisplayType string
+
+const (
+	DisplayNone  DisplayType = "none" // no remote display; the guest framebuffer is still available to Screenshot
+	DisplayVNC   DisplayType = "vnc"
+	DisplaySPICE DisplayType = "spice"
+)
+
+type GpuType string
+
+const (
+	GpuStd    GpuType = "std"    // standard VGA, x86_64 only
+	GpuVirtio GpuType = "virtio" // virtio-gpu
+	GpuNone   GpuType = "none"
+)
+
+// vncDisplayBase is the TCP port of VNC display 0.
+const vncDisplayBase = 5900
+
+// DisplayConfig configures the guest graphics device and how its display is exported.
+type DisplayConfig struct {
+	Type     DisplayType // defaults to DisplayNone
+	Listen   string      // "host:port" for TCP; empty listens on DisplaySocketPath(dir)
+	Password string      `json:"-"` // required to listen on TCP; VNC only uses the first 8 characters
+	Gpu      GpuType     // defaults to the machine's graphics device
+}
+
+func DisplaySocketPath(dir string) string {
+	return filepath.Join(dir, "display.sock")
+}
+
+func displaySecretPath(dir string) string {
+	return filepath.Join(dir, "display.secret")
+}
+
+func buildDisplayArgs(dir string, display *DisplayConfig, arch utils.Arch) ([]string, error) {
+	// QEMU's own display windows are never used; remote displays are configured below.
+	args := []string{"-display", "none"}
+	if display == nil {
+		// SendKeys and TypeText need a keyboard even without a display.
+		return append(args, buildInputArgs(arch, false)...), nil
+	}
+
+	switch display.Gpu {
+	case "":
+	case GpuStd:
+		if arch != utils.ArchX86_64 {
+			return nil, fmt.Errorf("display configuration: std VGA is not available on %s", arch)
+		}
+		args = append(args, "-vga", "std")
+	case GpuVirtio:
+		args = append(args, "-vga", "none", "-device", "virtio-gpu-pci")
+	case GpuNone:
+		args = append(args, "-vga", "none")
+	default:
+		return nil, fmt.Errorf("display configuration: unknown GPU %q", display.Gpu)
+	}
+
+	// Absolute pointer events need a tablet; see Instance.Click.
+	args = append(args, buildInputArgs(arch, true)...)
+
+	secret := ""
+	if display.Password != "" {
+		if display.Type != DisplayVNC && display.Type != DisplaySPICE {
+			return nil, fmt.Errorf("display configuration: a password requires VNC or SPICE")
+		}
+		// Passing the password in a file keeps it out of the process list.
+		if writeErr := os.WriteFile(displaySecretPath(dir), []byte(display.Password), 0600); writeErr != nil {
+			return nil, writeErr
+		}
+		args = append(args, "-object", fmt.Sprintf("secret,id=display-secret,file=%s", displaySecretPath(dir)))
+		secret = "display-secret"
+	}
+
+	switch display.Type {
+	case "", DisplayNone:
+	case DisplayVNC:
+		vnc := "unix:" + DisplaySocketPath(dir)
+		if display.Listen != "" {
+			host, port, splitErr := splitListen(display.Listen)
+			if splitErr != nil {
+				return nil, splitErr
+			}
+			if port < vncDisplayBase {
+				return nil, fmt.Errorf("display configuration: VNC port must be at least %d", vncDisplayBase)
+			}
+			vnc = fmt.Sprintf("%s:%d", host, port-vncDisplayBase)
+		}
+		if secret != "" {
+			vnc += ",password-secret=" + secret
+		}
+		args = append(args, "-vnc", vnc)
+	case DisplaySPICE:
+		spice := fmt.Sprintf("unix=on,addr=%s", DisplaySocketPath(dir))
+		if display.Listen != "" {
+			host, port, splitErr := splitListen(display.Listen)
+			if splitErr != nil {
+				return nil, splitErr
+			}
+			spice = fmt.Sprintf("addr=%s,port=%d", host, port)
+		}
+		if secret != "" {
+			spice += ",password-secret=" + secret
+		} else {
+			spice += ",disable-ticketing=on"
+		}
+		args = append(args, "-spice", spice)
+	default:
+		return nil, fmt.Errorf("display configuration: unknown display type %q", display.Type)
+	}
+
+	if display.Listen != "" && secret == "" {
+		return nil, fmt.Errorf("display configuration: a password is required to listen on %s", display.Listen)
+	}
+
+	return args, nil
+}
+
+func splitListen(listen string) (string, int, error) {
+	host, portString, splitErr := net.SplitHostPort(listen)
+	if splitErr != nil {
+		return "", 0, fmt.Errorf("display configuration: %w", splitErr)
+	}
+	port, portErr := strconv.Atoi(portString)
+	if portErr != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("display configuration: invalid port %q", portString)
+	}
+	return host, port, nil
+}
+
+// Screenshot writes the current guest display to path as a PNG image.
+func (i *Instance) Screenshot(ctx context.Context, path string) error {
+	// QEMU resolves relative paths against its own working directory.
+	absPath, absErr := filepath.Abs(path)
+	if absErr != nil {
+		return absErr
+	}
+
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return monitor.Execute(ctx, "screendump", map[string]interface{}{
+		"filename": absPath,
+		"format":   "png",
+	}, nil)
+}
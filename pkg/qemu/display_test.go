@@ -0,0 +1,68 @@
+package qemu
+
+import (
+	"os"
+	"testing"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildDisplayArgs(t *testing.T) {
+	dir := t.TempDir()
+
+	args, err := buildDisplayArgs(dir, nil, utils.ArchX86_64)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-display", "none"}, args)
+
+	args, err = buildDisplayArgs(dir, nil, utils.ArchAarch64)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-display", "none",
+		"-device", "qemu-xhci,id=input-xhci", "-device", "usb-kbd,bus=input-xhci.0",
+	}, args, "headless guests without PS/2 still get a keyboard")
+
+	args, err = buildDisplayArgs(dir, &DisplayConfig{Type: DisplayVNC, Gpu: GpuVirtio}, utils.ArchX86_64)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-display", "none",
+		"-vga", "none", "-device", "virtio-gpu-pci",
+		"-device", "qemu-xhci,id=input-xhci", "-device", "usb-tablet,bus=input-xhci.0",
+		"-vnc", "unix:" + DisplaySocketPath(dir),
+	}, args)
+
+	args, err = buildDisplayArgs(dir, &DisplayConfig{Type: DisplayVNC, Listen: "127.0.0.1:5901", Password: "secret"}, utils.ArchX86_64)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-display", "none",
+		"-device", "qemu-xhci,id=input-xhci", "-device", "usb-tablet,bus=input-xhci.0",
+		"-object", "secret,id=display-secret,file=" + displaySecretPath(dir),
+		"-vnc", "127.0.0.1:1,password-secret=display-secret",
+	}, args)
+	secret, err := os.ReadFile(displaySecretPath(dir))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(secret))
+
+	args, err = buildDisplayArgs(dir, &DisplayConfig{Type: DisplaySPICE}, utils.ArchAarch64)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-display", "none",
+		"-device", "qemu-xhci,id=input-xhci", "-device", "usb-tablet,bus=input-xhci.0", "-device", "usb-kbd,bus=input-xhci.0",
+		"-spice", "unix=on,addr=" + DisplaySocketPath(dir) + ",disable-ticketing=on",
+	}, args)
+}
+
+func TestBuildDisplayArgs_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, display := range map[string]*DisplayConfig{
+		"tcp without password": {Type: DisplayVNC, Listen: "0.0.0.0:5900"},
+		"vnc port below base":  {Type: DisplayVNC, Listen: "0.0.0.0:80", Password: "secret"},
+		"std vga on aarch64":   {Gpu: GpuStd},
+		"password without vnc": {Password: "secret"},
+	} {
+		_, err := buildDisplayArgs(dir, display, utils.ArchAarch64)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,143 @@
+package qemu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+// FirmwareConfig selects UEFI firmware for an instance.
+type FirmwareConfig struct {
+	Features   []string                  // required descriptor features, e.g., utils.FirmwareSecureBoot
+	Descriptor *utils.FirmwareDescriptor // explicit firmware; discovered from utils.FirmwareSearchPaths otherwise
+}
+
+// resolve returns the configured descriptor or discovers one matching arch and machine.
+// An explicit descriptor must have the required features as well.
+func (f *FirmwareConfig) resolve(arch utils.Arch, machine string) (*utils.FirmwareDescriptor, error) {
+	if f.Descriptor != nil {
+		if mismatched := f.Descriptor.MismatchedFeatures(f.Features); len(mismatched) > 0 {
+			return nil, fmt.Errorf("firmware %s does not match features %v", f.Descriptor.Path, mismatched)
+		}
+		return f.Descriptor, nil
+	}
+
+	descriptors, discoverErr := utils.DiscoverFirmware(utils.FirmwareSearchPaths()...)
+	if discoverErr != nil {
+		return nil, discoverErr
+	}
+	return utils.SelectFirmware(descriptors, arch, machine, f.Features)
+}
+
+// resolveFirmware returns the UEFI firmware for an instance, or nil when it boots the
+// default BIOS. aarch64 has no built-in firmware, so it boots UEFI with a per-instance
+// variable store unless no descriptor is installed.
+func resolveFirmware(arch utils.Arch, machine string, config *FirmwareConfig, secureBoot bool) (*utils.FirmwareDescriptor, error) {
+	if secureBoot {
+		secureBootConfig := FirmwareConfig{}
+		if config != nil {
+			secureBootConfig = *config
+		}
+		secureBootConfig.Features = append(slices.Clone(secureBootConfig.Features), utils.FirmwareSecureBoot, utils.FirmwareEnrolledKeys)
+		config = &secureBootConfig
+	}
+
+	if config != nil {
+		return config.resolve(arch, machine)
+	}
+
+	if arch != utils.ArchAarch64 {
+		return nil, nil
+	}
+	descriptor, resolveErr := (&FirmwareConfig{}).resolve(arch, machine)
+	if resolveErr != nil {
+		slog.Warn("No UEFI firmware descriptor found, booting without a variable store", "arch", arch, "error", resolveErr)
+		return nil, nil
+	}
+	return descriptor, nil
+}
+
+func VarsPath(dir string) string {
+	return filepath.Join(dir, "efivars.fd")
+}
+
+// buildFirmwareArgs returns the arguments loading the firmware. For flash firmware, the
+// per-instance NVRAM is created from the template on first use and kept across restarts.
+func buildFirmwareArgs(dir string, firmware *utils.FirmwareDescriptor) ([]string, error) {
+	mapping := firmware.Mapping
+
+	switch mapping.Device {
+	case "memory":
+		return []string{"-bios", mapping.Filename}, nil
+	case "flash":
+	default:
+		return nil, fmt.Errorf("firmware %s: unsupported device %q", firmware.Path, mapping.Device)
+	}
+
+	executable := mapping.Executable
+	switch mapping.Mode {
+	case "", utils.FirmwareModeSplit:
+		if mapping.NvramTemplate == nil {
+			return nil, fmt.Errorf("firmware %s: split mode requires an NVRAM template", firmware.Path)
+		}
+		if copyErr := copyIfMissing(mapping.NvramTemplate.Filename, VarsPath(dir)); copyErr != nil {
+			return nil, copyErr
+		}
+		return []string{
+			"-drive", fmt.Sprintf("if=pflash,format=%s,unit=0,readonly=on,file=%s", formatOrRaw(executable.Format), executable.Filename),
+			"-drive", fmt.Sprintf("if=pflash,format=%s,unit=1,file=%s", formatOrRaw(mapping.NvramTemplate.Format), VarsPath(dir)),
+		}, nil
+	case utils.FirmwareModeCombined:
+		// Code and variables share one file, so the instance needs its own writable copy.
+		if copyErr := copyIfMissing(executable.Filename, VarsPath(dir)); copyErr != nil {
+			return nil, copyErr
+		}
+		return []string{
+			"-drive", fmt.Sprintf("if=pflash,format=%s,unit=0,file=%s", formatOrRaw(executable.Format), VarsPath(dir)),
+		}, nil
+	case utils.FirmwareModeStateless:
+		return []string{
+			"-drive", fmt.Sprintf("if=pflash,format=%s,unit=0,readonly=on,file=%s", formatOrRaw(executable.Format), executable.Filename),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("firmware %s: unsupported mode %q", firmware.Path, mapping.Mode)
+}
+
+func formatOrRaw(format string) string {
+	if format == "" {
+		return "raw"
+	}
+	return format
+}
+
+func copyIfMissing(src, dst string) error {
+	if _, statErr := os.Stat(dst); statErr == nil {
+		return nil
+	} else if !errors.Is(statErr, os.ErrNotExist) {
+		return statErr
+	}
+
+	in, openErr := os.Open(src)
+	if openErr != nil {
+		return fmt.Errorf("failed to open firmware template: %w", openErr)
+	}
+	defer in.Close()
+
+	out, createErr := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if createErr != nil {
+		return createErr
+	}
+	if _, copyErr := io.Copy(out, in); copyErr != nil {
+		out.Close()
+		os.Remove(dst)
+		return copyErr
+	}
+	return out.Close()
+}
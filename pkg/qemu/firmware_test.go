@@ -0,0 +1,187 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func firmwareFiles(t *testing.T) (code, vars string) {
+	dir := t.TempDir()
+	code = filepath.Join(dir, "AAVMF_CODE.fd")
+	vars = filepath.Join(dir, "AAVMF_VARS.fd")
+	require.NoError(t, os.WriteFile(code, []byte("code"), 0644))
+	require.NoError(t, os.WriteFile(vars, []byte("template"), 0644))
+	return code, vars
+}
+
+func TestBuildFirmwareArgs(t *testing.T) {
+	code, vars := firmwareFiles(t)
+
+	tests := []struct {
+		name     string
+		mapping  utils.FirmwareMapping
+		expected func(dir string) []string
+		nvram    string // expected content of the instance variable store; empty if none
+		err      string
+	}{
+		{
+			name: "split",
+			mapping: utils.FirmwareMapping{
+				Device:        "flash",
+				Mode:          utils.FirmwareModeSplit,
+				Executable:    utils.FirmwareFile{Filename: code, Format: "raw"},
+				NvramTemplate: &utils.FirmwareFile{Filename: vars},
+			},
+			expected: func(dir string) []string {
+				return []string{
+					"-drive", "if=pflash,format=raw,unit=0,readonly=on,file=" + code,
+					"-drive", "if=pflash,format=raw,unit=1,file=" + VarsPath(dir),
+				}
+			},
+			nvram: "template",
+		},
+		{
+			name: "split without mode",
+			mapping: utils.FirmwareMapping{
+				Device:        "flash",
+				Executable:    utils.FirmwareFile{Filename: code, Format: "qcow2"},
+				NvramTemplate: &utils.FirmwareFile{Filename: vars, Format: "qcow2"},
+			},
+			expected: func(dir string) []string {
+				return []string{
+					"-drive", "if=pflash,format=qcow2,unit=0,readonly=on,file=" + code,
+					"-drive", "if=pflash,format=qcow2,unit=1,file=" + VarsPath(dir),
+				}
+			},
+			nvram: "template",
+		},
+		{
+			name:    "split without template",
+			mapping: utils.FirmwareMapping{Device: "flash", Mode: utils.FirmwareModeSplit, Executable: utils.FirmwareFile{Filename: code}},
+			err:     "requires an NVRAM template",
+		},
+		{
+			name:    "combined",
+			mapping: utils.FirmwareMapping{Device: "flash", Mode: utils.FirmwareModeCombined, Executable: utils.FirmwareFile{Filename: code}},
+			expected: func(dir string) []string {
+				return []string{"-drive", "if=pflash,format=raw,unit=0,file=" + VarsPath(dir)}
+			},
+			nvram: "code",
+		},
+		{
+			name:    "stateless",
+			mapping: utils.FirmwareMapping{Device: "flash", Mode: utils.FirmwareModeStateless, Executable: utils.FirmwareFile{Filename: code}},
+			expected: func(string) []string {
+				return []string{"-drive", "if=pflash,format=raw,unit=0,readonly=on,file=" + code}
+			},
+		},
+		{
+			name:    "memory",
+			mapping: utils.FirmwareMapping{Device: "memory", Filename: code},
+			expected: func(string) []string {
+				return []string{"-bios", code}
+			},
+		},
+		{
+			name:    "unsupported device",
+			mapping: utils.FirmwareMapping{Device: "kernel"},
+			err:     "unsupported device",
+		},
+		{
+			name:    "unsupported mode",
+			mapping: utils.FirmwareMapping{Device: "flash", Mode: "other"},
+			err:     "unsupported mode",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			args, err := buildFirmwareArgs(dir, &utils.FirmwareDescriptor{Path: "test.json", Mapping: tt.mapping})
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected(dir), args)
+
+			nvram, readErr := os.ReadFile(VarsPath(dir))
+			if tt.nvram == "" {
+				assert.ErrorIs(t, readErr, os.ErrNotExist)
+			} else {
+				require.NoError(t, readErr)
+				assert.Equal(t, tt.nvram, string(nvram))
+			}
+		})
+	}
+}
+
+func TestBuildFirmwareArgs_KeepsVariableStore(t *testing.T) {
+	code, vars := firmwareFiles(t)
+	firmware := &utils.FirmwareDescriptor{Mapping: utils.FirmwareMapping{
+		Device:        "flash",
+		Executable:    utils.FirmwareFile{Filename: code},
+		NvramTemplate: &utils.FirmwareFile{Filename: vars},
+	}}
+	dir := t.TempDir()
+
+	_, err := buildFirmwareArgs(dir, firmware)
+	require.NoError(t, err)
+
+	// Variables written by the guest survive a restart and a changed template.
+	require.NoError(t, os.WriteFile(VarsPath(dir), []byte("boot entries"), 0644))
+	require.NoError(t, os.WriteFile(vars, []byte("updated template"), 0644))
+
+	_, err = buildFirmwareArgs(dir, firmware)
+	require.NoError(t, err)
+
+	nvram, err := os.ReadFile(VarsPath(dir))
+	require.NoError(t, err)
+	assert.Equal(t, "boot entries", string(nvram))
+}
+
+func TestResolveFirmware_Default(t *testing.T) {
+	firmware, err := resolveFirmware(utils.ArchX86_64, "q35", nil, false)
+	require.NoError(t, err)
+	assert.Nil(t, firmware, "x86_64 boots SeaBIOS by default")
+}
+
+func TestResolveFirmware_ExplicitDescriptor(t *testing.T) {
+	plain := &utils.FirmwareDescriptor{Path: "60-edk2.json", Features: []string{"acpi-s3"}}
+	secure := &utils.FirmwareDescriptor{Path: "30-edk2-secboot.json", Features: []string{
+		"acpi-s3", utils.FirmwareEnrolledKeys, utils.FirmwareRequiresSMM, utils.FirmwareSecureBoot,
+	}}
+	unenrolled := &utils.FirmwareDescriptor{Path: "40-edk2-secboot.json", Features: []string{utils.FirmwareSecureBoot}}
+
+	tests := []struct {
+		name       string
+		config     FirmwareConfig
+		secureBoot bool
+		err        string
+	}{
+		{name: "no features", config: FirmwareConfig{Descriptor: plain}},
+		{name: "features present", config: FirmwareConfig{Descriptor: plain, Features: []string{"acpi-s3"}}},
+		{name: "feature missing", config: FirmwareConfig{Descriptor: plain, Features: []string{utils.FirmwareAmdSev}}, err: "does not match features [amd-sev]"},
+		{name: "excluded feature present", config: FirmwareConfig{Descriptor: secure, Features: []string{"-" + utils.FirmwareSecureBoot}}, err: "does not match features [-secure-boot]"},
+		{name: "secure boot", config: FirmwareConfig{Descriptor: secure}, secureBoot: true},
+		{name: "secure boot without support", config: FirmwareConfig{Descriptor: plain}, secureBoot: true, err: "does not match features [secure-boot enrolled-keys]"},
+		{name: "secure boot without enrolled keys", config: FirmwareConfig{Descriptor: unenrolled}, secureBoot: true, err: "does not match features [enrolled-keys]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			firmware, err := resolveFirmware(utils.ArchX86_64, "q35", &tt.config, tt.secureBoot)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Same(t, tt.config.Descriptor, firmware)
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package qemu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/q-controller/qemu-client/pkg/qmp"
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+// DiskConfig is an additional disk, attached at boot through BuildQemuArgs or at runtime
+// through AttachDisk.
+type DiskConfig struct {
+	Id       string // device ID, also used as the block node name
+	Path     string
+	Format   string // "qcow2" (default) or "raw"
+	ReadOnly bool
+}
+
+// descriptors returns the block node and device of the disk.
+func (d DiskConfig) descriptors() (descriptor, descriptor, error) {
+	if d.Id == "" {
+		return descriptor{}, descriptor{}, fmt.Errorf("disk %s: Id must be set", d.Path)
+	}
+	if _, statErr := os.Stat(d.Path); statErr != nil {
+		return descriptor{}, descriptor{}, fmt.Errorf("disk %s: %w", d.Id, statErr)
+	}
+
+	format := d.Format
+	if format == "" {
+		format = "qcow2"
+	}
+
+	file := []property{prop("driver", "file"), prop("filename", d.Path)}
+	blockdev := []property{prop("node-name", d.Id), prop("driver", format)}
+	if d.ReadOnly {
+		file = append(file, prop("read-only", true))
+		blockdev = append(blockdev, prop("read-only", true))
+	}
+	blockdev = append(blockdev, prop("file", file))
+
+	// QEMU resolves virtio aliases to the PCI or CCW (s390x) variant of the machine.
+	device := newDevice("virtio-blk", prop("drive", d.Id), prop("id", d.Id))
+
+	return newBlockdev(blockdev...), device, nil
+}
+
+// NicConfig is an additional NIC, attached at boot through BuildQemuArgs or at runtime
+// through AttachNIC.
+type NicConfig struct {
+	Id       string // device and netdev ID; with tap networking, also the host tap interface
+	Network  NetworkConfig
+	Platform *PlatformConfig
+}
+
+// descriptors returns the netdev and device of the NIC.
+func (n NicConfig) descriptors() (descriptor, descriptor, error) {
+	if n.Id == "" {
+		return descriptor{}, descriptor{}, fmt.Errorf("nic: Id must be set")
+	}
+
+	network := n.Network
+	mac, macErr := utils.ValidateMAC(network.Mac)
+	if macErr != nil {
+		return descriptor{}, descriptor{}, fmt.Errorf("network configuration: %w", macErr)
+	}
+	network.Mac = mac
+	if network.Driver == "" {
+		network.Driver = "virtio-net"
+	}
+
+	return nicDescriptors(n.Id, network, n.Platform)
+}
+
+func buildDiskArgs(disks []DiskConfig) ([]string, error) {
+	args := []string{}
+	ids := map[string]bool{}
+	for _, disk := range disks {
+		if ids[disk.Id] {
+			return nil, fmt.Errorf("disk %s: duplicate Id", disk.Id)
+		}
+		ids[disk.Id] = true
+
+		blockdev, device, descriptorErr := disk.descriptors()
+		if descriptorErr != nil {
+			return nil, descriptorErr
+		}
+		args = append(args, "-blockdev", blockdev.arg(), "-device", device.arg())
+	}
+	return args, nil
+}
+
+// buildNicArgs returns the arguments of the additional NICs of an instance; captured NICs
+// write to their default capture file in dir, see nicCapturePath.
+func buildNicArgs(dir, instanceID string, nics []NicConfig) ([]string, error) {
+	args := []string{}
+	ids := map[string]bool{}
+	for _, nic := range nics {
+		if ids[nic.Id] {
+			return nil, fmt.Errorf("nic %s: duplicate Id", nic.Id)
+		}
+		ids[nic.Id] = true
+
+		netdev, device, descriptorErr := nic.descriptors()
+		if descriptorErr != nil {
+			return nil, descriptorErr
+		}
+		args = append(args, "-netdev", netdev.arg(), "-device", device.arg())
+		if nic.Network.Capture {
+			args = append(args, captureArgs(nic.Id, nicCapturePath(dir, instanceID, nic.Id))...)
+		}
+	}
+	return args, nil
+}
+
+// AttachDisk adds a disk to the running guest and records it in the manifest, so that a
+// restart keeps it.
+func (i *Instance) AttachDisk(ctx context.Context, disk DiskConfig) error {
+	blockdev, device, descriptorErr := disk.descriptors()
+	if descriptorErr != nil {
+		return descriptorErr
+	}
+
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	if execErr := monitor.Execute(ctx, "blockdev-add", blockdev.qmp(), nil); execErr != nil {
+		return execErr
+	}
+	if execErr := monitor.Execute(ctx, "device_add", device.qmp(), nil); execErr != nil {
+		monitor.Execute(ctx, "blockdev-del", map[string]interface{}{"node-name": disk.Id}, nil)
+		return execErr
+	}
+
+	return updateManifest(i.Dir, func(config *Config) {
+		config.Disks = append(slices.DeleteFunc(config.Disks, func(d DiskConfig) bool { return d.Id == disk.Id }), disk)
+	})
+}
+
+// DetachDisk removes a disk once the guest has released it, then closes its image and
+// removes it from the manifest.
+func (i *Instance) DetachDisk(ctx context.Context, id string) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	if unplugErr := unplugDevice(ctx, monitor, id); unplugErr != nil {
+		return unplugErr
+	}
+	if execErr := monitor.Execute(ctx, "blockdev-del", map[string]interface{}{"node-name": id}, nil); execErr != nil {
+		return execErr
+	}
+
+	return updateManifest(i.Dir, func(config *Config) {
+		config.Disks = slices.DeleteFunc(config.Disks, func(d DiskConfig) bool { return d.Id == id })
+	})
+}
+
+// AttachNIC adds a NIC with the given ID to the running guest and records it in the
+// manifest, so that a restart keeps it. With tap networking, the ID is also the name of
+// the host tap interface. A MAC is allocated from the MAC store of the instance unless
+// network sets one, which is then reserved there.
+func (i *Instance) AttachNIC(ctx context.Context, id string, network NetworkConfig, platform *PlatformConfig) error {
+	manifest, manifestErr := ReadManifest(i.Dir)
+	if manifestErr != nil {
+		return manifestErr
+	}
+	if slices.ContainsFunc(manifest.Nics, func(n NicConfig) bool { return n.Id == id }) {
+		return fmt.Errorf("nic %s is already attached", id)
+	}
+
+	allocator, allocatorErr := macAllocator(manifest.MacPrefix, manifest.MacStore)
+	if allocatorErr != nil {
+		return allocatorErr
+	}
+	mac, macErr := allocator.AllocateNIC(i.Name, network.Mac)
+	if macErr != nil {
+		return fmt.Errorf("nic %s: %w", id, macErr)
+	}
+	network.Mac = mac
+
+	attachErr := i.attachNIC(ctx, NicConfig{Id: id, Network: network, Platform: platform})
+	if attachErr != nil {
+		allocator.ReleaseMAC(i.Name, mac)
+	}
+	return attachErr
+}
+
+func (i *Instance) attachNIC(ctx context.Context, nic NicConfig) error {
+	netdev, device, nicErr := nic.descriptors()
+	if nicErr != nil {
+		return nicErr
+	}
+
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	if execErr := monitor.Execute(ctx, "netdev_add", netdev.qmp(), nil); execErr != nil {
+		return execErr
+	}
+	if nic.Network.Capture {
+		if captureErr := startCapture(ctx, monitor, nic.Id, nicCapturePath(i.Dir, i.Name, nic.Id)); captureErr != nil {
+			monitor.Execute(ctx, "netdev_del", map[string]interface{}{"id": nic.Id}, nil)
+			return captureErr
+		}
+	}
+	if execErr := monitor.Execute(ctx, "device_add", device.qmp(), nil); execErr != nil {
+		monitor.Execute(ctx, "netdev_del", map[string]interface{}{"id": nic.Id}, nil)
+		return execErr
+	}
+
+	// A limit that cannot be applied must not leave the NIC attached unlimited.
+	if nic.Network.RateLimit != nil {
+		if rateLimitErr := applyRateLimitOnStart(nic.Id, nic.Network.RateLimit); rateLimitErr != nil {
+			if unplugErr := unplugDevice(ctx, monitor, nic.Id); unplugErr == nil {
+				monitor.Execute(ctx, "netdev_del", map[string]interface{}{"id": nic.Id}, nil)
+			}
+			return fmt.Errorf("failed to apply rate limit: %w", rateLimitErr)
+		}
+	}
+
+	return updateManifest(i.Dir, func(config *Config) {
+		config.Nics = append(config.Nics, nic)
+	})
+}
+
+// DetachNIC removes a NIC once the guest has released it, then its netdev, removes it
+// from the manifest and releases its MAC.
+func (i *Instance) DetachNIC(ctx context.Context, id string) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	if unplugErr := unplugDevice(ctx, monitor, id); unplugErr != nil {
+		return unplugErr
+	}
+	if execErr := monitor.Execute(ctx, "netdev_del", map[string]interface{}{"id": id}, nil); execErr != nil {
+		return execErr
+	}
+
+	var mac, macPrefix, macStore string
+	updateErr := updateManifest(i.Dir, func(config *Config) {
+		for _, nic := range config.Nics {
+			if nic.Id == id {
+				mac = nic.Network.Mac
+			}
+		}
+		config.Nics = slices.DeleteFunc(config.Nics, func(n NicConfig) bool { return n.Id == id })
+		macPrefix, macStore = config.MacPrefix, config.MacStore
+	})
+	if updateErr != nil || mac == "" {
+		return updateErr
+	}
+
+	allocator, allocatorErr := macAllocator(macPrefix, macStore)
+	if allocatorErr != nil {
+		return allocatorErr
+	}
+	return allocator.ReleaseMAC(i.Name, mac)
+}
+
+// unplugDevice requests removal of a device and waits for the DEVICE_DELETED event that
+// QEMU sends once the guest has released it.
+func unplugDevice(ctx context.Context, monitor *qmp.Client, id string) error {
+	if execErr := monitor.Execute(ctx, "device_del", map[string]interface{}{"id": id}, nil); execErr != nil {
+		return execErr
+	}
+
+	_, waitErr := monitor.WaitEvent(ctx, "DEVICE_DELETED", func(data json.RawMessage) bool {
+		var deleted struct {
+			Device string `json:"device"`
+		}
+		return json.Unmarshal(data, &deleted) == nil && deleted.Device == id
+	})
+	if waitErr != nil {
+		return fmt.Errorf("device %s was not released by the guest: %w", id, waitErr)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package qemu
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstance_AttachDetachNIC(t *testing.T) {
+	instance, sequence := fakeHotplug(t)
+	ctx := testContext(t)
+	store := filepath.Join(t.TempDir(), "macs.json")
+	require.NoError(t, WriteManifest(instance.Dir, Config{MacStore: store}))
+
+	require.NoError(t, instance.AttachNIC(ctx, "vm-nic1", NetworkConfig{Mac: "52:54:00:12:34:57"}, nil))
+	manifest, err := ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Equal(t, []NicConfig{{Id: "vm-nic1", Network: NetworkConfig{Mac: "52:54:00:12:34:57"}}}, manifest.Nics)
+	assert.ErrorContains(t, instance.AttachNIC(ctx, "vm-nic1", NetworkConfig{}, nil), "already attached")
+
+	require.NoError(t, instance.DetachNIC(ctx, "vm-nic1"))
+	assert.Equal(t, []string{"netdev_add", "device_add", "device_del", "DEVICE_DELETED", "netdev_del"}, sequence())
+	manifest, err = ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Empty(t, manifest.Nics)
+
+	allocator, err := macAllocator("", store)
+	require.NoError(t, err)
+	_, err = allocator.Reserve("other", 0, "52:54:00:12:34:57")
+	assert.NoError(t, err, "DetachNIC must release the MAC")
+}
+
+func TestInstance_AttachNIC_AllocatesMAC(t *testing.T) {
+	instance, _ := fakeHotplug(t)
+	ctx := testContext(t)
+	store := filepath.Join(t.TempDir(), "macs.json")
+	require.NoError(t, WriteManifest(instance.Dir, Config{MacStore: store, MacPrefix: "02:aa:bb"}))
+
+	require.NoError(t, instance.AttachNIC(ctx, "vm-nic1", NetworkConfig{}, nil))
+	manifest, err := ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Nics, 1)
+
+	allocator, err := macAllocator("02:aa:bb", store)
+	require.NoError(t, err)
+	expected, err := allocator.Allocate(instance.Name, 1)
+	require.NoError(t, err)
+	assert.Equal(t, expected, manifest.Nics[0].Network.Mac)
+}
+
+func TestBuildNicArgs(t *testing.T) {
+	args, err := buildNicArgs("/vm", "vm", []NicConfig{{Id: "vm-nic1", Network: NetworkConfig{Mac: "52:54:00:12:34:57"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-netdev", "tap,id=vm-nic1,ifname=vm-nic1,script=no,downscript=no",
+		"-device", "virtio-net,netdev=vm-nic1,mac=52:54:00:12:34:57,id=vm-nic1",
+	}, args)
+
+	args, err = buildNicArgs("/vm", "vm", []NicConfig{{Id: "vm-nic1", Network: NetworkConfig{Mac: "52:54:00:12:34:57", Capture: true}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-object", "filter-dump,id=capture-vm-nic1,netdev=vm-nic1,file=/vm/capture-vm-nic1.pcap"}, args[4:])
+
+	nic := NicConfig{Id: "nic", Network: NetworkConfig{Mac: "52:54:00:12:34:57"}}
+	_, err = buildNicArgs("/vm", "vm", []NicConfig{nic, nic})
+	assert.ErrorContains(t, err, "duplicate Id")
+
+	_, err = buildNicArgs("/vm", "vm", []NicConfig{{Network: NetworkConfig{Mac: "52:54:00:12:34:57"}}})
+	assert.ErrorContains(t, err, "Id must be set")
+}
+
+func TestInstance_AttachNIC_Capture(t *testing.T) {
+	instance, sequence := fakeHotplug(t)
+	ctx := testContext(t)
+	require.NoError(t, WriteManifest(instance.Dir, Config{MacStore: filepath.Join(t.TempDir(), "macs.json")}))
+
+	require.NoError(t, instance.AttachNIC(ctx, "vm-nic1", NetworkConfig{Capture: true}, nil))
+	assert.Equal(t, []string{"netdev_add", "object-add", "device_add"}, sequence(), "the capture starts before the guest sees the NIC")
+}
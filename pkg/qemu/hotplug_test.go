@@ -0,0 +1,93 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHotplug returns an instance whose monitor acknowledges device_del right away but
+// emits DEVICE_DELETED only later, as QEMU does once the guest has released the device.
+// The commands and events are recorded in the order they happen.
+func fakeHotplug(t *testing.T) (*Instance, func() []string) {
+	var mu sync.Mutex
+	sequence := []string{}
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		sequence = append(sequence, name)
+	}
+
+	var monitor *fakeMonitor
+	instance, monitor := newFakeMonitor(t, func(cmd map[string]interface{}) []string {
+		record(cmd["execute"].(string))
+		if cmd["execute"] == "device_del" {
+			id := cmd["arguments"].(map[string]interface{})["id"].(string)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				// Events of other devices must not end the wait.
+				monitor.events <- `{"event": "DEVICE_DELETED", "data": {"path": "/machine/peripheral/other", "device": "other"}, "timestamp": {"seconds": 1, "microseconds": 0}}`
+				record("DEVICE_DELETED")
+				monitor.events <- `{"event": "DEVICE_DELETED", "data": {"path": "/machine/peripheral/` + id + `", "device": "` + id + `"}, "timestamp": {"seconds": 1, "microseconds": 0}}`
+			}()
+		}
+		return nil
+	})
+
+	return instance, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, sequence...)
+	}
+}
+
+func TestInstance_AttachDetachDisk(t *testing.T) {
+	instance, sequence := fakeHotplug(t)
+	ctx := testContext(t)
+
+	path := filepath.Join(t.TempDir(), "data.qcow2")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+	existing := DiskConfig{Id: "scratch", Path: path, Format: "raw"}
+	require.NoError(t, WriteManifest(instance.Dir, Config{Disks: []DiskConfig{existing}}))
+
+	disk := DiskConfig{Id: "data", Path: path, ReadOnly: true}
+	require.NoError(t, instance.AttachDisk(ctx, disk))
+	assert.Equal(t, []string{"blockdev-add", "device_add"}, sequence())
+
+	manifest, err := ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Equal(t, []DiskConfig{existing, disk}, manifest.Disks)
+
+	require.NoError(t, instance.DetachDisk(ctx, "data"))
+	assert.Equal(t, []string{"blockdev-add", "device_add", "device_del", "DEVICE_DELETED", "blockdev-del"}, sequence(),
+		"the image is closed only after the guest released the device")
+
+	manifest, err = ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Equal(t, []DiskConfig{existing}, manifest.Disks)
+}
+
+func TestInstance_AttachDiskFailure(t *testing.T) {
+	instance, monitor := newFakeMonitor(t, func(cmd map[string]interface{}) []string {
+		if cmd["execute"] == "device_add" {
+			return []string{`{"error": {"class": "GenericError", "desc": "Bus 'pcie.0' does not support hotplugging"}}`}
+		}
+		return nil
+	})
+	require.NoError(t, WriteManifest(instance.Dir, Config{}))
+
+	path := filepath.Join(t.TempDir(), "data.qcow2")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+
+	assert.ErrorContains(t, instance.AttachDisk(testContext(t), DiskConfig{Id: "data", Path: path}), "does not support hotplugging")
+	assert.Equal(t, []string{"blockdev-add", "device_add", "blockdev-del"}, monitor.executed())
+
+	manifest, err := ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Empty(t, manifest.Disks)
+}
@@ -0,0 +1,387 @@
+package qemu
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/q-controller/qemu-client/pkg/qmp"
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+const (
+	keyHoldTime = 50 * time.Millisecond
+	// absoluteMax is the coordinate range of absolute pointer events (INPUT_EVENT_ABS_MAX).
+	absoluteMax = 0x7fff
+)
+
+// keyAliases maps common key names to QEMU key codes (QKeyCode). Other names are passed
+// through, e.g., "a", "f1" or "ctrl_r".
+var keyAliases = map[string]string{
+	"control":  "ctrl",
+	"del":      "delete",
+	"enter":    "ret",
+	"return":   "ret",
+	"space":    "spc",
+	"escape":   "esc",
+	"win":      "meta_l",
+	"super":    "meta_l",
+	"meta":     "meta_l",
+	"cmd":      "meta_l",
+	"pageup":   "pgup",
+	"pagedown": "pgdn",
+	"ins":      "insert",
+}
+
+// Keymap translates characters into key combos of a keyboard layout.
+type Keymap map[rune][]string
+
+// KeymapUS is the US keyboard layout.
+var KeymapUS = func() Keymap {
+	keymap := Keymap{
+		' ': {"spc"}, '\n': {"ret"}, '\t': {"tab"},
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		keymap[c] = []string{string(c)}
+		keymap[c-'a'+'A'] = []string{"shift", string(c)}
+	}
+	for c := '0'; c <= '9'; c++ {
+		keymap[c] = []string{string(c)}
+	}
+
+	plain := map[rune]string{
+		'-': "minus", '=': "equal", '[': "bracket_left", ']': "bracket_right", '\\': "backslash",
+		';': "semicolon", '\'': "apostrophe", '`': "grave_accent", ',': "comma", '.': "dot", '/': "slash",
+	}
+	for c, key := range plain {
+		keymap[c] = []string{key}
+	}
+
+	shifted := map[rune]string{
+		'!': "1", '@': "2", '#': "3", '$': "4", '%': "5", '^': "6", '&': "7", '*': "8", '(': "9", ')': "0",
+		'_': "minus", '+': "equal", '{': "bracket_left", '}': "bracket_right", '|': "backslash",
+		':': "semicolon", '"': "apostrophe", '~': "grave_accent", '<': "comma", '>': "dot", '?': "slash",
+	}
+	for c, key := range shifted {
+		keymap[c] = []string{"shift", key}
+	}
+
+	return keymap
+}()
+
+type PointerButton string
+
+const (
+	ButtonLeft      PointerButton = "left"
+	ButtonMiddle    PointerButton = "middle"
+	ButtonRight     PointerButton = "right"
+	ButtonWheelUp   PointerButton = "wheel-up"
+	ButtonWheelDown PointerButton = "wheel-down"
+)
+
+func (b PointerButton) validate() error {
+	switch b {
+	case ButtonLeft, ButtonMiddle, ButtonRight, ButtonWheelUp, ButtonWheelDown:
+		return nil
+	}
+	return fmt.Errorf("unknown pointer button %q", b)
+}
+
+// buildInputArgs adds a USB keyboard on machines without a PS/2 controller, so that key
+// events reach headless guests too, plus a USB tablet for absolute pointer events.
+func buildInputArgs(arch utils.Arch, pointer bool) []string {
+	devices := []string{}
+	if pointer {
+		devices = append(devices, "-device", "usb-tablet,bus=input-xhci.0")
+	}
+	if arch != utils.ArchX86_64 {
+		devices = append(devices, "-device", "usb-kbd,bus=input-xhci.0")
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+	return append([]string{"-device", "qemu-xhci,id=input-xhci"}, devices...)
+}
+
+func parseKeyCombo(combo string) ([]string, error) {
+	keys := []string{}
+	for _, name := range strings.Split(strings.ToLower(strings.TrimSpace(combo)), "-") {
+		if name == "" {
+			return nil, fmt.Errorf("invalid key combo %q", combo)
+		}
+		if alias, ok := keyAliases[name]; ok {
+			name = alias
+		}
+		keys = append(keys, name)
+	}
+	return keys, nil
+}
+
+// SendKeys presses the keys of a combo such as "ctrl-alt-del" together and releases them.
+func (i *Instance) SendKeys(ctx context.Context, combo string) error {
+	keys, parseErr := parseKeyCombo(combo)
+	if parseErr != nil {
+		return parseErr
+	}
+
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return sendKeys(ctx, monitor, keys)
+}
+
+// TypeText types text using the given keymap; nil uses KeymapUS.
+func (i *Instance) TypeText(ctx context.Context, text string, keymap Keymap) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return typeText(ctx, monitor, text, keymap)
+}
+
+// MovePointer moves the pointer to an absolute position, given as fractions of the
+// screen width and height from the top left corner. It fails on instances without a
+// Display, which have no absolute pointing device.
+func (i *Instance) MovePointer(ctx context.Context, x, y float64) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return movePointer(ctx, monitor, x, y)
+}
+
+// Click moves the pointer to an absolute position and clicks a button.
+func (i *Instance) Click(ctx context.Context, x, y float64, button PointerButton) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return click(ctx, monitor, x, y, button)
+}
+
+func sendKeys(ctx context.Context, monitor *qmp.Client, keys []string) error {
+	keyValues := []map[string]string{}
+	for _, key := range keys {
+		keyValues = append(keyValues, map[string]string{"type": "qcode", "data": key})
+	}
+
+	return monitor.Execute(ctx, "send-key", map[string]interface{}{
+		"keys":      keyValues,
+		"hold-time": keyHoldTime.Milliseconds(),
+	}, nil)
+}
+
+func typeText(ctx context.Context, monitor *qmp.Client, text string, keymap Keymap) error {
+	if keymap == nil {
+		keymap = KeymapUS
+	}
+
+	for _, c := range text {
+		keys, ok := keymap[c]
+		if !ok {
+			return fmt.Errorf("no key for %q in keymap", c)
+		}
+		// QEMU queues key events, so they arrive in order without waiting here.
+		if sendErr := sendKeys(ctx, monitor, keys); sendErr != nil {
+			return sendErr
+		}
+	}
+	return nil
+}
+
+func absoluteEvents(x, y float64) ([]map[string]interface{}, error) {
+	if x < 0 || x > 1 || y < 0 || y > 1 {
+		return nil, fmt.Errorf("pointer position (%g, %g) is outside the screen", x, y)
+	}
+	return []map[string]interface{}{
+		{"type": "abs", "data": map[string]interface{}{"axis": "x", "value": int(x * absoluteMax)}},
+		{"type": "abs", "data": map[string]interface{}{"axis": "y", "value": int(y * absoluteMax)}},
+	}, nil
+}
+
+func movePointer(ctx context.Context, monitor *qmp.Client, x, y float64) error {
+	events, eventsErr := absoluteEvents(x, y)
+	if eventsErr != nil {
+		return eventsErr
+	}
+	if pointerErr := requireAbsolutePointer(ctx, monitor); pointerErr != nil {
+		return pointerErr
+	}
+	return monitor.Execute(ctx, "input-send-event", map[string]interface{}{"events": events}, nil)
+}
+
+// requireAbsolutePointer fails unless the guest has a pointing device accepting absolute
+// events, which QEMU would otherwise drop silently. Only instances with a Display have one.
+func requireAbsolutePointer(ctx context.Context, monitor *qmp.Client) error {
+	var mice []struct {
+		Absolute bool `json:"absolute"`
+	}
+	if execErr := monitor.Execute(ctx, "query-mice", nil, &mice); execErr != nil {
+		return execErr
+	}
+	for _, mouse := range mice {
+		if mouse.Absolute {
+			return nil
+		}
+	}
+	return fmt.Errorf("no absolute pointing device; pointer input requires a Display")
+}
+
+func click(ctx context.Context, monitor *qmp.Client, x, y float64, button PointerButton) error {
+	if buttonErr := button.validate(); buttonErr != nil {
+		return buttonErr
+	}
+	if moveErr := movePointer(ctx, monitor, x, y); moveErr != nil {
+		return moveErr
+	}
+	for _, down := range []bool{true, false} {
+		if execErr := monitor.Execute(ctx, "input-send-event", map[string]interface{}{
+			"events": []map[string]interface{}{
+				{"type": "btn", "data": map[string]interface{}{"button": string(button), "down": down}},
+			},
+		}, nil); execErr != nil {
+			return execErr
+		}
+	}
+	return nil
+}
+
+// InputStep is a single step of an InputScript.
+type InputStep struct {
+	Action string        // "key", "type", "wait", "move" or "click"
+	Keys   []string      // key
+	Text   string        // type
+	Delay  time.Duration // wait
+	X, Y   float64       // move and click
+	Button PointerButton // click
+}
+
+// InputScript is a sequence of input steps, parsed from lines such as:
+//
+//	# boot the installer
+//	key ctrl-alt-del
+//	wait 5s
+//	type linux text\n
+//	click 0.5 0.9 left
+//
+// Text supports the escapes \n, \t and \\.
+type InputScript []InputStep
+
+// ParseInputScript parses a script; blank lines and lines starting with # are ignored.
+func ParseInputScript(r io.Reader) (InputScript, error) {
+	script := InputScript{}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		action, rest, _ := strings.Cut(line, " ")
+		step, stepErr := parseInputStep(action, strings.TrimSpace(rest))
+		if stepErr != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, stepErr)
+		}
+		script = append(script, step)
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return nil, scanErr
+	}
+
+	return script, nil
+}
+
+func parseInputStep(action, rest string) (InputStep, error) {
+	step := InputStep{Action: action}
+
+	switch action {
+	case "key":
+		keys, parseErr := parseKeyCombo(rest)
+		if parseErr != nil {
+			return step, parseErr
+		}
+		step.Keys = keys
+	case "type":
+		step.Text = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t").Replace(rest)
+	case "wait":
+		delay, parseErr := time.ParseDuration(rest)
+		if parseErr != nil {
+			return step, parseErr
+		}
+		step.Delay = delay
+	case "move", "click":
+		fields := strings.Fields(rest)
+		if (action == "move" && len(fields) != 2) || (action == "click" && len(fields) != 2 && len(fields) != 3) {
+			return step, fmt.Errorf("%s: expected x and y", action)
+		}
+		x, xErr := strconv.ParseFloat(fields[0], 64)
+		y, yErr := strconv.ParseFloat(fields[1], 64)
+		if xErr != nil || yErr != nil {
+			return step, fmt.Errorf("%s: invalid position %q", action, rest)
+		}
+		step.X, step.Y = x, y
+		if action == "click" {
+			step.Button = ButtonLeft
+			if len(fields) == 3 {
+				step.Button = PointerButton(fields[2])
+				if buttonErr := step.Button.validate(); buttonErr != nil {
+					return step, fmt.Errorf("click: %w", buttonErr)
+				}
+			}
+		}
+	default:
+		return step, fmt.Errorf("unknown action %q", action)
+	}
+
+	return step, nil
+}
+
+// RunInputScript executes the steps of a script in order, using keymap for typing.
+func (i *Instance) RunInputScript(ctx context.Context, script InputScript, keymap Keymap) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	for index, step := range script {
+		var stepErr error
+		switch step.Action {
+		case "key":
+			stepErr = sendKeys(ctx, monitor, step.Keys)
+		case "type":
+			stepErr = typeText(ctx, monitor, step.Text, keymap)
+		case "wait":
+			select {
+			case <-ctx.Done():
+				stepErr = ctx.Err()
+			case <-time.After(step.Delay):
+			}
+		case "move":
+			stepErr = movePointer(ctx, monitor, step.X, step.Y)
+		case "click":
+			stepErr = click(ctx, monitor, step.X, step.Y, step.Button)
+		default:
+			stepErr = fmt.Errorf("unknown action %q", step.Action)
+		}
+		if stepErr != nil {
+			return fmt.Errorf("input script step %d (%s): %w", index+1, step.Action, stepErr)
+		}
+	}
+
+	return nil
+}
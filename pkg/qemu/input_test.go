@@ -0,0 +1,102 @@
+package qemu
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyCombo(t *testing.T) {
+	keys, err := parseKeyCombo("Ctrl-Alt-Del")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ctrl", "alt", "delete"}, keys)
+
+	_, err = parseKeyCombo("ctrl--c")
+	assert.Error(t, err)
+}
+
+func TestKeymapUS(t *testing.T) {
+	assert.Equal(t, []string{"shift", "a"}, KeymapUS['A'])
+	assert.Equal(t, []string{"shift", "1"}, KeymapUS['!'])
+	assert.Equal(t, []string{"slash"}, KeymapUS['/'])
+	assert.Equal(t, []string{"ret"}, KeymapUS['\n'])
+}
+
+func TestParseInputScript(t *testing.T) {
+	script, err := ParseInputScript(strings.NewReader(`
+# boot the installer
+key ctrl-alt-del
+wait 1.5s
+type root\n
+move 0.5 0.25
+click 0.1 0.9 right
+`))
+	require.NoError(t, err)
+	assert.Equal(t, InputScript{
+		{Action: "key", Keys: []string{"ctrl", "alt", "delete"}},
+		{Action: "wait", Delay: 1500 * time.Millisecond},
+		{Action: "type", Text: "root\n"},
+		{Action: "move", X: 0.5, Y: 0.25},
+		{Action: "click", X: 0.1, Y: 0.9, Button: ButtonRight},
+	}, script)
+
+	_, err = ParseInputScript(strings.NewReader("key ctrl-c\njump 1 2\n"))
+	assert.ErrorContains(t, err, "line 2")
+
+	_, err = ParseInputScript(strings.NewReader("click 0.5 0.5 lfet\n"))
+	assert.ErrorContains(t, err, `unknown pointer button "lfet"`)
+}
+
+func TestInstance_Click(t *testing.T) {
+	tests := []struct {
+		name     string
+		mice     string
+		button   PointerButton
+		executed []string
+		err      string
+	}{
+		{
+			name:     "tablet",
+			mice:     `[{"name": "QEMU PS/2 Mouse", "index": 0, "current": false, "absolute": false}, {"name": "QEMU HID Tablet", "index": 1, "current": true, "absolute": true}]`,
+			button:   ButtonLeft,
+			executed: []string{"query-mice", "input-send-event", "input-send-event", "input-send-event"},
+		},
+		{
+			name:     "headless",
+			mice:     `[{"name": "QEMU PS/2 Mouse", "index": 0, "current": true, "absolute": false}]`,
+			button:   ButtonLeft,
+			executed: []string{"query-mice"},
+			err:      "requires a Display",
+		},
+		{
+			name:     "no pointing device",
+			mice:     `[]`,
+			button:   ButtonLeft,
+			executed: []string{"query-mice"},
+			err:      "requires a Display",
+		},
+		{name: "unknown button", mice: `[]`, button: "back", executed: []string{}, err: "unknown pointer button"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, monitor := newFakeMonitor(t, func(cmd map[string]interface{}) []string {
+				if cmd["execute"] == "query-mice" {
+					return []string{`{"return": ` + tt.mice + `}`}
+				}
+				return nil
+			})
+
+			err := instance.Click(testContext(t), 0.5, 0.5, tt.button)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.executed, monitor.executed())
+		})
+	}
+}
@@ -1,33 +1,69 @@
 package qemu
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/q-controller/qemu-client/pkg/qmp"
 	"github.com/q-controller/qemu-client/pkg/utils"
 )
 
 type Instance struct {
-	QMP  string
-	QGA  string
-	Pid  int
-	Done <-chan interface{}
+	Name   string
+	Dir    string
+	HwAddr string
+	QMP    string
+	QGA    string
+	Pid    int
+	Cid    uint32 // vsock guest CID; 0 without a vsock device
+	Done   <-chan interface{}
+
+	// ShareExits reports virtiofsd daemons exiting; nil for attached instances, whose
+	// daemons are not children of this process.
+	ShareExits <-chan ShareExit
 }
 
 type Config struct {
-	Cpus      uint32
-	Memory    uint32 // in MB
-	Disk      uint32 // in MB
-	HwAddr    string
-	Platform  *PlatformConfig // platform-specific configuration
-	CloudInit CloudInitConfig
+	QemuBinary    string     // explicit QEMU binary; see utils.FindQemuBinary
+	Arch          utils.Arch // guest architecture; defaults to the host architecture
+	Accelerator   string     // overrides accelerator detection, e.g., "tcg" or "kvm"
+	Cpus          uint32
+	Cpu           CpuConfig       // CPU model and topology; defaults to the host CPU
+	Memory        uint32          // in MB
+	MemoryOptions MemoryConfig    // backend, NUMA nodes and hotplug; defaults to anonymous RAM
+	Disk          uint32          // in MB
+	HwAddr        string          // allocated from MacStore when empty; user-supplied MACs are reserved there
+	MacStore      string          // MAC allocation file; defaults to utils.DefaultMACStorePath
+	MacPrefix     string          // OUI or longer prefix of allocated MACs; defaults to utils.DefaultMACPrefix
+	RateLimit     *RateLimit      // optional bandwidth and packet-rate limits; Start fails if they cannot be applied
+	Capture       bool            // capture NIC traffic into CapturePath(dir)
+	Platform      *PlatformConfig // platform-specific configuration
+	CloudInit     CloudInitConfig
+	Firmware      *FirmwareConfig // UEFI firmware with a per-instance variable store; nil uses the default BIOS
+	SecureBoot    bool            // select Secure Boot firmware with enrolled keys; implies Firmware
+	Tpm           *TpmConfig      // software TPM 2.0 via swtpm
+	KernelBoot    *KernelBoot     // boot a kernel directly; the image is optional then
+	Cdroms        []string        // ISO images, e.g., an installer; see ChangeMedia and EjectMedia
+	Boot          *BootConfig
+	Shares        []Share      // host directories mounted in the guest via cloud-init
+	Vsock         *VsockConfig // virtio-vsock; see Instance.DialVsock and ListenVsock
+	Display       *DisplayConfig
+	Disks         []DiskConfig     // additional disks; see Instance.AttachDisk for hotplug
+	Nics          []NicConfig      // additional NICs, with MACs allocated like HwAddr; see Instance.AttachNIC for hotplug
+	PciDevices    []PciPassthrough // VFIO passthrough; devices with Bind are rebound by Start
+	UsbDevices    []UsbPassthrough
+	Sysfs         utils.Sysfs // where PciDevices are looked up, bound and released; defaults to utils.HostSysfs
 }
 
 // Path helpers — all runtime files live inside the instance directory.
@@ -60,6 +96,46 @@ func CloudInitPath(dir string) string {
 	return filepath.Join(dir, "cloudinit")
 }
 
+func CapturePath(dir string) string {
+	return filepath.Join(dir, "capture.pcap")
+}
+
+func ManifestPath(dir string) string {
+	return filepath.Join(dir, "config.json")
+}
+
+// WriteManifest records the configuration an instance was started with, so that
+// attaching to it later can recover details such as its MAC address.
+func WriteManifest(dir string, config Config) error {
+	data, marshalErr := json.MarshalIndent(config, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return os.WriteFile(ManifestPath(dir), data, 0644)
+}
+
+// updateManifest applies update to the manifest of a running instance.
+func updateManifest(dir string, update func(*Config)) error {
+	config, readErr := ReadManifest(dir)
+	if readErr != nil {
+		return readErr
+	}
+	update(config)
+	return WriteManifest(dir, *config)
+}
+
+func ReadManifest(dir string) (*Config, error) {
+	data, err := os.ReadFile(ManifestPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid manifest content: %w", err)
+	}
+	return &config, nil
+}
+
 func ReadPidfile(dir string) (int, error) {
 	data, err := os.ReadFile(PidfilePath(dir))
 	if err != nil {
@@ -100,57 +176,168 @@ func Attach(name, dir string, pid int) (*Instance, error) {
 		}
 	}()
 
+	hwAddr := ""
+	var cid uint32
+	if manifest, manifestErr := ReadManifest(dir); manifestErr == nil {
+		hwAddr = manifest.HwAddr
+		if manifest.Vsock != nil {
+			cid = manifest.Vsock.CID
+		}
+	} else {
+		slog.Debug("Failed to read instance manifest", "error", manifestErr)
+	}
+
 	return &Instance{
-		QMP:  QmpSocketPath(dir),
-		QGA:  QgaSocketPath(dir),
-		Pid:  pid,
-		Done: ch,
+		Name:   name,
+		Dir:    dir,
+		HwAddr: hwAddr,
+		QMP:    QmpSocketPath(dir),
+		QGA:    QgaSocketPath(dir),
+		Pid:    pid,
+		Cid:    cid,
+		Done:   ch,
 	}, nil
 }
 
 func Start(name, dir string, config Config) (*Instance, error) {
-	qemuBinary, qemuBinaryErr := utils.GetQemuBinary()
+	hostArch, hostArchErr := utils.HostArch()
+	if hostArchErr != nil {
+		return nil, hostArchErr
+	}
+
+	arch := config.Arch
+	if arch == "" {
+		arch = hostArch
+	}
+
+	qemuBinary, qemuBinaryErr := utils.FindQemuBinary(arch, config.QemuBinary)
 	if qemuBinaryErr != nil {
 		return nil, qemuBinaryErr
 	}
 
-	if _, err := exec.LookPath(qemuBinary); err != nil {
-		return nil, fmt.Errorf("%s is not available; please install %s", qemuBinary, qemuBinary)
+	caps, capsErr := ProbeCapabilities(context.Background(), qemuBinary)
+	if capsErr != nil {
+		slog.Warn("Failed to probe QEMU capabilities", "binary", qemuBinary, "error", capsErr)
 	}
 
-	machineType, machineTypeErr := utils.GetMachineType()
+	machineType, machineTypeErr := utils.GetMachineTypeForArch(arch)
 	if machineTypeErr != nil {
 		return nil, machineTypeErr
 	}
 
-	bios, biosErr := utils.GetBios()
-	if biosErr != nil {
-		return nil, biosErr
+	firmware, firmwareErr := resolveFirmware(arch, machineType, config.Firmware, config.SecureBoot)
+	if firmwareErr != nil {
+		return nil, firmwareErr
+	}
+
+	bios := ""
+	if firmware == nil {
+		defaultBios, biosErr := utils.GetBiosForArch(arch)
+		if biosErr != nil {
+			return nil, biosErr
+		}
+		bios = defaultBios
+	}
+
+	accelerator := utils.Accelerator{Name: config.Accelerator}.Arg()
+	if arch != hostArch {
+		// Foreign architectures can only be emulated.
+		if config.Accelerator != "" && config.Accelerator != utils.TCG {
+			return nil, fmt.Errorf("accelerator %s cannot run %s guests on a %s host", config.Accelerator, arch, hostArch)
+		}
+		accelerator = utils.Accelerator{Name: utils.TCG}.Arg()
+	} else if config.Accelerator == "" {
+		detected := utils.DetectAccelerator(qemuBinary)
+		if detected.Diagnostic != "" {
+			slog.Warn("Hardware acceleration unavailable, falling back to TCG", "reason", detected.Diagnostic)
+		}
+		accelerator = detected.Arg()
+	}
+
+	kernelBoot := KernelBoot{}
+	if config.KernelBoot != nil {
+		kernelBoot = *config.KernelBoot
+	}
+
+	// The allocated MACs are recorded in the manifest for Attach and restarts.
+	hwAddr, hwAddrErr := allocateMAC(name, config.HwAddr, config.MacPrefix, config.MacStore)
+	if hwAddrErr != nil {
+		return nil, hwAddrErr
+	}
+	config.HwAddr = hwAddr
+	nics, nicsErr := allocateNicMACs(name, config.Nics, config.MacPrefix, config.MacStore)
+	if nicsErr != nil {
+		return nil, nicsErr
+	}
+	config.Nics = nics
+
+	var cid uint32
+	if config.Vsock != nil {
+		// The allocated CID is recorded in the manifest for Attach.
+		vsock, vsockErr := config.Vsock.allocate(name)
+		if vsockErr != nil {
+			return nil, vsockErr
+		}
+		config.Vsock = vsock
+		cid = vsock.CID
+	}
+
+	sysfs := config.Sysfs
+	if sysfs.Root == "" {
+		sysfs = utils.HostSysfs
 	}
 
 	args, argsErr := BuildQemuArgs(
 		Id(name),
+		Arch(arch),
 		Machine(machineType),
-		Accelerator(utils.GetAccelerator()),
+		Accelerator(accelerator),
 		Memory(config.Memory),
+		MemoryOptions(config.MemoryOptions),
 		Disk(config.Disk),
 		Cpus(int(config.Cpus)),
+		Cpu(config.Cpu),
 		Network(NetworkConfig{
-			Mac:    config.HwAddr,
-			Driver: "virtio-net",
+			Mac:       config.HwAddr,
+			Driver:    "virtio-net",
+			RateLimit: config.RateLimit,
+			Capture:   config.Capture,
 		}),
 		Platform(config.Platform),
 		Dir(dir),
 		CloudInit(config.CloudInit),
 		Bios(bios),
+		Firmware(firmware),
+		Tpm(config.Tpm),
+		Kernel(kernelBoot.Kernel),
+		Initrd(kernelBoot.Initrd),
+		Append(kernelBoot.Append),
+		Dtb(kernelBoot.Dtb),
+		Cdroms(config.Cdroms...),
+		Boot(config.Boot),
+		Shares(config.Shares...),
+		VsockCID(cid),
+		Display(config.Display),
+		Disks(config.Disks...),
+		Nics(config.Nics...),
+		PciDevices(config.PciDevices...),
+		UsbDevices(config.UsbDevices...),
+		Sysfs(sysfs),
+		QemuCapabilities(caps),
 	)
 	if argsErr != nil {
 		return nil, argsErr
 	}
 
+	if manifestErr := WriteManifest(dir, config); manifestErr != nil {
+		return nil, manifestErr
+	}
+
 	// Remove stale socket files from a previous run before starting QEMU.
 	os.Remove(QmpSocketPath(dir))
 	os.Remove(QgaSocketPath(dir))
+	os.Remove(ConsoleSocketPath(dir))
+	os.Remove(DisplaySocketPath(dir))
 
 	slog.Info("QEMU command", "binary", qemuBinary, "args", args)
 	command := exec.Command(qemuBinary, args...)
@@ -172,12 +359,59 @@ func Start(name, dir string, config Config) (*Instance, error) {
 		Setsid: true,
 	}
 
+	var swtpm *os.Process
+	if config.Tpm != nil {
+		swtpmProcess, swtpmErr := startSwtpm(dir)
+		if swtpmErr != nil {
+			return nil, swtpmErr
+		}
+		swtpm = swtpmProcess
+	}
+
+	shareExits := make(chan ShareExit, len(config.Shares))
+	virtiofsd, virtiofsdErr := startVirtiofsd(dir, config.Shares, shareExits)
+	if virtiofsdErr != nil {
+		if swtpm != nil {
+			swtpm.Kill()
+		}
+		return nil, virtiofsdErr
+	}
+
+	// Devices bound here are released when QEMU exits; instances reattached with Attach
+	// leave that to the caller.
+	boundPci, bindErr := bindPciDevices(sysfs, config.PciDevices)
+	if bindErr != nil {
+		if swtpm != nil {
+			swtpm.Kill()
+		}
+		killProcesses(virtiofsd)
+		return nil, bindErr
+	}
+
 	// Start QEMU non-blocking
 	if err := command.Start(); err != nil {
+		if swtpm != nil {
+			swtpm.Kill()
+		}
+		killProcesses(virtiofsd)
+		releasePciDevices(sysfs, boundPci)
 		return nil, fmt.Errorf("failed to execute QEMU: %w", err)
 	}
 	slog.Debug("QEMU VM started", "pid", command.Process.Pid)
 
+	// A limit that cannot be applied must not leave the instance running unlimited.
+	if rateLimitErr := applyRateLimitsOnStart(name, config); rateLimitErr != nil {
+		// VFIO holds the devices until QEMU has exited.
+		command.Process.Kill()
+		command.Wait()
+		if swtpm != nil {
+			swtpm.Kill()
+		}
+		killProcesses(virtiofsd)
+		releasePciDevices(sysfs, boundPci)
+		return nil, fmt.Errorf("failed to apply rate limit: %w", rateLimitErr)
+	}
+
 	ch := make(chan interface{})
 
 	go func() {
@@ -187,17 +421,108 @@ func Start(name, dir string, config Config) (*Instance, error) {
 		if waitErr != nil {
 			slog.Info("Exited with error", "error", waitErr)
 		}
+		releasePciDevices(sysfs, boundPci)
 		ch <- true
 	}()
 
 	return &Instance{
-		QMP:  QmpSocketPath(dir),
-		QGA:  QgaSocketPath(dir),
-		Pid:  command.Process.Pid,
-		Done: ch,
+		Name:   name,
+		Dir:    dir,
+		HwAddr: config.HwAddr,
+		QMP:    QmpSocketPath(dir),
+		QGA:    QgaSocketPath(dir),
+		Pid:    command.Process.Pid,
+		Cid:    cid,
+		Done:   ch,
+
+		ShareExits: shareExits,
 	}, nil
 }
 
+// allocateMAC returns the MAC of the primary NIC of an instance: mac reserved for the
+// instance, or a stable MAC derived from its name when mac is empty.
+func allocateMAC(instanceID, mac, prefix, store string) (string, error) {
+	allocator, allocatorErr := macAllocator(prefix, store)
+	if allocatorErr != nil {
+		return "", allocatorErr
+	}
+	if mac == "" {
+		return allocator.Allocate(instanceID, 0)
+	}
+	return allocator.Reserve(instanceID, 0, mac)
+}
+
+// allocateNicMACs returns nics with the MACs of the additional NICs of an instance set:
+// MACs already held by the instance are kept, other set MACs are reserved and empty ones
+// allocated.
+func allocateNicMACs(instanceID string, nics []NicConfig, prefix, store string) ([]NicConfig, error) {
+	if len(nics) == 0 {
+		return nics, nil
+	}
+
+	allocator, allocatorErr := macAllocator(prefix, store)
+	if allocatorErr != nil {
+		return nil, allocatorErr
+	}
+	allocated := slices.Clone(nics)
+	for index := range allocated {
+		mac, macErr := allocator.AllocateNIC(instanceID, allocated[index].Network.Mac)
+		if macErr != nil {
+			return nil, fmt.Errorf("nic %s: %w", allocated[index].Id, macErr)
+		}
+		allocated[index].Network.Mac = mac
+	}
+	return allocated, nil
+}
+
+func macAllocator(prefix, store string) (*utils.MACAllocator, error) {
+	if prefix == "" {
+		prefix = utils.DefaultMACPrefix
+	}
+	if store == "" {
+		defaultStore, storeErr := utils.DefaultMACStorePath()
+		if storeErr != nil {
+			return nil, storeErr
+		}
+		store = defaultStore
+	}
+	return utils.NewMACAllocator(prefix, store)
+}
+
+// Remove deletes the directory of a stopped instance and releases the addresses
+// allocated to it.
+func Remove(name, dir string) error {
+	if pid, pidErr := ReadPidfile(dir); pidErr == nil && ProcessAlive(pid) {
+		return fmt.Errorf("instance %s is still running (pid %d)", name, pid)
+	}
+
+	manifest, manifestErr := ReadManifest(dir)
+	if manifestErr != nil && !errors.Is(manifestErr, os.ErrNotExist) {
+		return manifestErr
+	}
+	if manifest != nil {
+		allocator, allocatorErr := macAllocator(manifest.MacPrefix, manifest.MacStore)
+		if allocatorErr != nil {
+			return allocatorErr
+		}
+		if releaseErr := allocator.Release(name); releaseErr != nil {
+			return releaseErr
+		}
+
+		if manifest.Vsock != nil {
+			cids, cidsErr := manifest.Vsock.allocator()
+			if cidsErr != nil {
+				return cidsErr
+			}
+			if releaseErr := cids.Release(name); releaseErr != nil {
+				return releaseErr
+			}
+		}
+	}
+
+	return os.RemoveAll(dir)
+}
+
 func (i *Instance) Stop() error {
 	proc, err := os.FindProcess(i.Pid)
 	if err != nil {
@@ -211,3 +536,13 @@ func (i *Instance) Stop() error {
 
 	return nil
 }
+
+// monitor opens a short-lived QMP session to the instance.
+func (i *Instance) monitor(ctx context.Context) (*qmp.Client, error) {
+	return qmp.Dial(ctx, i.QMP)
+}
+
+// agent opens a short-lived session to the guest agent of the instance.
+func (i *Instance) agent(ctx context.Context) (*qmp.Client, error) {
+	return qmp.DialAgent(ctx, i.QGA)
+}
@@ -0,0 +1,88 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemove_ReleasesCID(t *testing.T) {
+	vsock := &VsockConfig{Store: filepath.Join(t.TempDir(), "cids.json")}
+	dir := t.TempDir()
+
+	allocated, err := vsock.allocate("vm1")
+	require.NoError(t, err)
+
+	require.NoError(t, WriteManifest(dir, Config{MacStore: filepath.Join(t.TempDir(), "macs.json"), Vsock: allocated}))
+	require.NoError(t, Remove("vm1", dir))
+
+	reused, err := vsock.allocate("vm2")
+	require.NoError(t, err)
+	assert.Equal(t, allocated.CID, reused.CID)
+}
+
+func TestRemove_ReleasesMAC(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "macs.json")
+	dir := t.TempDir()
+
+	mac, err := allocateMAC("vm1", "", "", store)
+	require.NoError(t, err)
+	again, err := allocateMAC("vm1", "", "", store)
+	require.NoError(t, err)
+	assert.Equal(t, mac, again, "restarts keep the MAC")
+
+	_, err = allocateMAC("vm2", mac, "", store)
+	assert.ErrorContains(t, err, "already assigned", "instances must not share a MAC")
+
+	require.NoError(t, WriteManifest(dir, Config{HwAddr: mac, MacStore: store}))
+	require.NoError(t, Remove("vm1", dir))
+	_, statErr := os.Stat(dir)
+	assert.True(t, os.IsNotExist(statErr))
+
+	reserved, err := allocateMAC("vm2", mac, "", store)
+	require.NoError(t, err)
+	assert.Equal(t, mac, reserved)
+}
+
+func TestAllocateMAC_Prefix(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "macs.json")
+	dir := t.TempDir()
+
+	mac, err := allocateMAC("vm1", "", "02:aa:bb", store)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(mac, "02:aa:bb:"), mac)
+
+	_, err = allocateMAC("vm2", "", "01:00:5e", store)
+	assert.ErrorContains(t, err, "multicast")
+
+	require.NoError(t, WriteManifest(dir, Config{HwAddr: mac, MacStore: store, MacPrefix: "02:aa:bb"}))
+	manifest, err := ReadManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "02:aa:bb", manifest.MacPrefix)
+
+	require.NoError(t, Remove("vm1", dir))
+	reserved, err := allocateMAC("vm2", mac, "", store)
+	require.NoError(t, err)
+	assert.Equal(t, mac, reserved)
+}
+
+func TestAllocateNicMACs(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "macs.json")
+	nics := []NicConfig{{Id: "nic1"}, {Id: "nic2", Network: NetworkConfig{Mac: "52:54:00:12:34:57"}}}
+
+	allocated, err := allocateNicMACs("vm1", nics, "", store)
+	require.NoError(t, err)
+	assert.Empty(t, nics[0].Network.Mac, "the caller's NICs must not be modified")
+	assert.Equal(t, "52:54:00:12:34:57", allocated[1].Network.Mac)
+
+	again, err := allocateNicMACs("vm1", allocated, "", store)
+	require.NoError(t, err)
+	assert.Equal(t, allocated, again, "a restart keeps the MACs")
+
+	_, err = allocateNicMACs("vm2", allocated[1:], "", store)
+	assert.ErrorContains(t, err, "nic2")
+}
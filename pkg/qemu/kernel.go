@@ -0,0 +1,49 @@
+package qemu
+
+import (
+	"fmt"
+	"os"
+)
+
+// KernelBoot boots a kernel directly instead of going through the firmware and a
+// bootloader on the image.
+type KernelBoot struct {
+	Kernel string // path to the kernel image
+	Initrd string // optional initial ramdisk
+	Append string // optional kernel command line, e.g., "console=ttyS0 root=/dev/vda1"
+	Dtb    string // optional device tree blob, for machines such as virt
+}
+
+// buildKernelArgs validates that the referenced files exist and returns the boot arguments.
+func buildKernelArgs(kernel, initrd, cmdline, dtb string) ([]string, error) {
+	if kernel == "" {
+		if initrd != "" || cmdline != "" || dtb != "" {
+			return nil, fmt.Errorf("kernel boot: Initrd, Append and Dtb require Kernel to be set")
+		}
+		return nil, nil
+	}
+
+	args := []string{}
+	for _, file := range []struct {
+		flag string
+		path string
+	}{
+		{"-kernel", kernel},
+		{"-initrd", initrd},
+		{"-dtb", dtb},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if _, statErr := os.Stat(file.path); statErr != nil {
+			return nil, fmt.Errorf("kernel boot: %s: %w", file.flag, statErr)
+		}
+		args = append(args, file.flag, file.path)
+	}
+
+	if cmdline != "" {
+		args = append(args, "-append", cmdline)
+	}
+
+	return args, nil
+}
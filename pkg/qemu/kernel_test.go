@@ -0,0 +1,57 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildKernelArgs(t *testing.T) {
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinuz")
+	initrd := filepath.Join(dir, "initrd.img")
+	dtb := filepath.Join(dir, "virt.dtb")
+	for _, file := range []string{kernel, initrd, dtb} {
+		require.NoError(t, os.WriteFile(file, nil, 0644))
+	}
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name     string
+		boot     KernelBoot
+		expected []string
+		err      string
+	}{
+		{name: "disabled"},
+		{name: "kernel", boot: KernelBoot{Kernel: kernel}, expected: []string{"-kernel", kernel}},
+		{
+			name:     "all",
+			boot:     KernelBoot{Kernel: kernel, Initrd: initrd, Append: "console=ttyS0 root=/dev/vda1", Dtb: dtb},
+			expected: []string{"-kernel", kernel, "-initrd", initrd, "-dtb", dtb, "-append", "console=ttyS0 root=/dev/vda1"},
+		},
+		{name: "initrd without kernel", boot: KernelBoot{Initrd: initrd}, err: "require Kernel"},
+		{name: "append without kernel", boot: KernelBoot{Append: "console=ttyS0"}, err: "require Kernel"},
+		{name: "dtb without kernel", boot: KernelBoot{Dtb: dtb}, err: "require Kernel"},
+		{name: "missing kernel", boot: KernelBoot{Kernel: missing}, err: "-kernel"},
+		{name: "missing initrd", boot: KernelBoot{Kernel: kernel, Initrd: missing}, err: "-initrd"},
+		{name: "missing dtb", boot: KernelBoot{Kernel: kernel, Dtb: missing}, err: "-dtb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := buildKernelArgs(tt.boot.Kernel, tt.boot.Initrd, tt.boot.Append, tt.boot.Dtb)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				if tt.boot.Kernel != "" {
+					assert.ErrorIs(t, err, os.ErrNotExist)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, args)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+)
+
+// RunState is the run state of a guest as reported by query-status.
+type RunState string
+
+const (
+	RunStateRunning       RunState = "running"
+	RunStatePaused        RunState = "paused"    // stopped with Pause
+	RunStateSuspended     RunState = "suspended" // in S3, see Suspend and Wakeup
+	RunStatePrelaunch     RunState = "prelaunch"
+	RunStateDebug         RunState = "debug"
+	RunStateInMigrate     RunState = "inmigrate"
+	RunStatePostMigrate   RunState = "postmigrate"
+	RunStateFinishMigrate RunState = "finish-migrate"
+	RunStateRestoreVM     RunState = "restore-vm"
+	RunStateSaveVM        RunState = "save-vm"
+	RunStateShutdown      RunState = "shutdown"
+	RunStateGuestPanicked RunState = "guest-panicked"
+	RunStateInternalError RunState = "internal-error"
+	RunStateIOError       RunState = "io-error"
+	RunStateWatchdog      RunState = "watchdog"
+	RunStateColo          RunState = "colo"
+)
+
+// State returns the current run state of the guest.
+func (i *Instance) State(ctx context.Context) (RunState, error) {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return "", monitorErr
+	}
+	defer monitor.Close()
+
+	var status struct {
+		Running bool     `json:"running"`
+		Status  RunState `json:"status"`
+	}
+	if execErr := monitor.Execute(ctx, "query-status", nil, &status); execErr != nil {
+		return "", execErr
+	}
+	return status.Status, nil
+}
+
+// Pause stops the vCPUs; the guest keeps its memory and devices until Resume.
+func (i *Instance) Pause(ctx context.Context) error {
+	return i.execute(ctx, "stop")
+}
+
+// Resume restarts the vCPUs of a paused guest.
+func (i *Instance) Resume(ctx context.Context) error {
+	return i.execute(ctx, "cont")
+}
+
+// Reset performs a hard reset of the guest, like pressing the reset button.
+func (i *Instance) Reset(ctx context.Context) error {
+	return i.execute(ctx, "system_reset")
+}
+
+// Wakeup resumes a guest suspended with Suspend.
+func (i *Instance) Wakeup(ctx context.Context) error {
+	return i.execute(ctx, "system_wakeup")
+}
+
+// Suspend asks the guest agent to suspend the guest to RAM (S3) and waits until QEMU
+// reports the guest as suspended. The guest must support S3, which QEMU disables on
+// some machines.
+func (i *Instance) Suspend(ctx context.Context) error {
+	// Connect to the monitor first so that the SUSPEND event cannot be missed.
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	agent, agentErr := i.agent(ctx)
+	if agentErr != nil {
+		return fmt.Errorf("guest agent unavailable: %w", agentErr)
+	}
+	defer agent.Close()
+
+	// guest-suspend-ram does not respond on success, so its response only ever carries
+	// an error, e.g., when the guest does not support S3.
+	rejected := make(chan error, 1)
+	go func() {
+		rejected <- agent.Execute(ctx, "guest-suspend-ram", nil, nil)
+	}()
+
+	suspended := make(chan error, 1)
+	go func() {
+		_, waitErr := monitor.WaitEvent(ctx, "SUSPEND", nil)
+		suspended <- waitErr
+	}()
+
+	select {
+	case waitErr := <-suspended:
+		return waitErr
+	case execErr := <-rejected:
+		if execErr == nil {
+			return fmt.Errorf("guest-suspend-ram: unexpected response")
+		}
+		return execErr
+	}
+}
+
+// execute runs a monitor command without arguments or return value.
+func (i *Instance) execute(ctx context.Context, command string) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return monitor.Execute(ctx, command, nil, nil)
+}
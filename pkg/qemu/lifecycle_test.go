@@ -0,0 +1,94 @@
+package qemu
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLifecycle simulates the run state transitions of a guest whose agent supports S3
+// unless s3 is false.
+func fakeLifecycle(t *testing.T, s3 bool) *Instance {
+	dir := t.TempDir()
+	instance := &Instance{Name: "vm", Dir: dir, QMP: filepath.Join(dir, "qmp.sock"), QGA: filepath.Join(dir, "qga.sock")}
+
+	state := make(chan RunState, 1)
+	state <- RunStateRunning
+	transition := func(next RunState) {
+		<-state
+		state <- next
+	}
+
+	events := make(chan string, 1)
+	fakeSocket(t, instance.QMP, `{"QMP": {}}`, events, func(cmd map[string]interface{}) []string {
+		switch cmd["execute"] {
+		case "query-status":
+			current := <-state
+			state <- current
+			status, _ := json.Marshal(map[string]interface{}{"running": current == RunStateRunning, "status": current})
+			return []string{`{"return": ` + string(status) + `}`}
+		case "stop":
+			transition(RunStatePaused)
+		case "cont", "system_reset", "system_wakeup":
+			transition(RunStateRunning)
+		}
+		return []string{`{"return": {}}`}
+	})
+
+	fakeSocket(t, instance.QGA, "", nil, func(cmd map[string]interface{}) []string {
+		switch cmd["execute"] {
+		case "guest-sync":
+			id := cmd["arguments"].(map[string]interface{})["id"].(float64)
+			sync, _ := json.Marshal(map[string]interface{}{"return": int64(id)})
+			return []string{string(sync)}
+		case "guest-suspend-ram":
+			if !s3 {
+				return []string{`{"error": {"class": "GenericError", "desc": "suspend-to-ram not supported by OS"}}`}
+			}
+			transition(RunStateSuspended)
+			events <- `{"event": "SUSPEND", "timestamp": {"seconds": 1, "microseconds": 0}}`
+		}
+		return nil
+	})
+
+	return instance
+}
+
+func TestInstance_PauseResume(t *testing.T) {
+	instance := fakeLifecycle(t, true)
+	ctx := testContext(t)
+
+	require.NoError(t, instance.Pause(ctx))
+	state, err := instance.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RunStatePaused, state)
+
+	require.NoError(t, instance.Resume(ctx))
+	state, err = instance.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RunStateRunning, state)
+}
+
+func TestInstance_SuspendWakeup(t *testing.T) {
+	instance := fakeLifecycle(t, true)
+	ctx := testContext(t)
+
+	require.NoError(t, instance.Suspend(ctx))
+	state, err := instance.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RunStateSuspended, state)
+
+	require.NoError(t, instance.Wakeup(ctx))
+	state, err = instance.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RunStateRunning, state)
+}
+
+func TestInstance_SuspendUnsupported(t *testing.T) {
+	instance := fakeLifecycle(t, false)
+
+	assert.ErrorContains(t, instance.Suspend(testContext(t)), "not supported")
+}
@@ -0,0 +1,211 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+// BootConfig controls the firmware boot order. Devices are QEMU drive letters:
+// "c" for the first disk, "d" for the first CD-ROM and "n" for the network.
+//
+// UEFI firmware ignores -boot, so the order is applied as bootindex properties of the
+// root disk, the first CD-ROM and the NIC instead.
+type BootConfig struct {
+	Order     string // e.g., "cd"
+	Once      string // devices for the first boot only; later reboots use Order; BIOS only
+	Menu      bool   // show an interactive boot menu
+	Installer bool   // boot the CD-ROM once, then the disk; shorthand for Once: "d", Order: "c"
+}
+
+func (b *BootConfig) arg() (string, error) {
+	order, once := b.Order, b.Once
+	if b.Installer {
+		if once != "" && once != "d" {
+			return "", fmt.Errorf("boot configuration: Installer conflicts with Once=%q", once)
+		}
+		once = "d"
+		if order == "" {
+			order = "c"
+		}
+	}
+
+	for _, devices := range []string{order, once} {
+		if strings.Trim(devices, "abcdnop") != "" {
+			return "", fmt.Errorf("boot configuration: invalid boot devices %q", devices)
+		}
+	}
+
+	parts := []string{}
+	if order != "" {
+		parts = append(parts, "order="+order)
+	}
+	if once != "" {
+		parts = append(parts, "once="+once)
+	}
+	if b.Menu {
+		parts = append(parts, "menu=on")
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// bootIndexes returns the bootindex of each device in the boot order, keyed by drive
+// letter. A one-time boot cannot be expressed with bootindex, so Installer boots the disk
+// before the CD-ROM: the firmware skips the disk while it has no bootloader.
+func (b *BootConfig) bootIndexes() (map[byte]int, error) {
+	if b.Once != "" {
+		return nil, fmt.Errorf("boot configuration: Once is not supported with UEFI firmware, use Order")
+	}
+
+	order := b.Order
+	if b.Installer {
+		if !strings.Contains(order, "c") {
+			order += "c"
+		}
+		if !strings.Contains(order, "d") {
+			order += "d"
+		}
+	}
+
+	indexes := map[byte]int{}
+	for _, device := range []byte(order) {
+		if strings.IndexByte("cdn", device) < 0 {
+			return nil, fmt.Errorf("boot configuration: boot device %q is not supported with UEFI firmware", device)
+		}
+		if _, ok := indexes[device]; !ok {
+			indexes[device] = len(indexes) + 1
+		}
+	}
+	return indexes, nil
+}
+
+// bootArgs returns the -boot argument and the bootindex of each device for the
+// configured firmware.
+func (c *QemuConfig) bootArgs() (string, map[byte]int, error) {
+	if c.Boot == nil {
+		return "", nil, nil
+	}
+
+	if !c.uefi() {
+		bootArg, bootErr := c.Boot.arg()
+		return bootArg, nil, bootErr
+	}
+
+	indexes, indexesErr := c.Boot.bootIndexes()
+	if indexesErr != nil {
+		return "", nil, indexesErr
+	}
+	bootArg := ""
+	if c.Boot.Menu {
+		// The firmware shows its boot manager for the menu timeout.
+		bootArg = "menu=on"
+	}
+	return bootArg, indexes, nil
+}
+
+// uefi reports whether the guest boots UEFI firmware. aarch64 always does, from flash or
+// from the -bios fallback.
+func (c *QemuConfig) uefi() bool {
+	return c.Firmware != nil || c.Arch == utils.ArchAarch64
+}
+
+// buildRootDiskArgs attaches the instance image. With a boot index, the drive is defined
+// separately from its device, because the legacy -hda shorthand cannot carry one.
+func buildRootDiskArgs(imagePath string, arch utils.Arch, bootIndex int) []string {
+	if bootIndex == 0 {
+		return []string{"-hda", imagePath}
+	}
+
+	// The devices -hda creates: IDE on x86, virtio elsewhere.
+	device := "virtio-blk-pci"
+	switch arch {
+	case utils.ArchX86_64:
+		device = "ide-hd"
+	case utils.ArchS390x:
+		device = "virtio-blk-ccw"
+	}
+	return []string{
+		"-drive", fmt.Sprintf("if=none,id=hda,file=%s", imagePath),
+		"-device", newDevice(device, prop("drive", "hda"), prop("id", "hda-disk"), prop("bootindex", bootIndex)).arg(),
+	}
+}
+
+func cdromDeviceId(index int) string {
+	return fmt.Sprintf("cdrom%d", index)
+}
+
+// buildCdromArgs attaches one CD-ROM drive per entry. An empty path creates an empty
+// drive whose medium can be inserted later with ChangeMedia. A non-zero bootIndex is set
+// on the first drive.
+func buildCdromArgs(cdroms []string, arch utils.Arch, bootIndex int) ([]string, error) {
+	if len(cdroms) == 0 {
+		return nil, nil
+	}
+
+	args := []string{}
+
+	// Only x86 machines have an IDE/AHCI controller; others use virtio-scsi.
+	device := "ide-cd"
+	if arch != utils.ArchX86_64 {
+		device = "scsi-cd"
+		args = append(args, "-device", "virtio-scsi-pci,id=cdrom-scsi")
+	}
+
+	for index, path := range cdroms {
+		drive := fmt.Sprintf("if=none,id=%s-drive,media=cdrom,readonly=on", cdromDeviceId(index))
+		if path != "" {
+			if _, statErr := os.Stat(path); statErr != nil {
+				return nil, fmt.Errorf("cdrom: %w", statErr)
+			}
+			drive += fmt.Sprintf(",format=raw,file=%s", path)
+		}
+		args = append(args, "-drive", drive)
+		deviceArg := fmt.Sprintf("%s,drive=%s-drive,id=%s", device, cdromDeviceId(index), cdromDeviceId(index))
+		if index == 0 && bootIndex != 0 {
+			deviceArg += fmt.Sprintf(",bootindex=%d", bootIndex)
+		}
+		args = append(args, "-device", deviceArg)
+	}
+
+	return args, nil
+}
+
+// EjectMedia opens the tray of a CD-ROM drive and removes its medium. With force, the
+// guest's lock on the tray is overridden.
+func (i *Instance) EjectMedia(ctx context.Context, cdrom int, force bool) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	if openErr := monitor.Execute(ctx, "blockdev-open-tray", map[string]interface{}{
+		"id":    cdromDeviceId(cdrom),
+		"force": force,
+	}, nil); openErr != nil {
+		return openErr
+	}
+
+	return monitor.Execute(ctx, "blockdev-remove-medium", map[string]interface{}{
+		"id": cdromDeviceId(cdrom),
+	}, nil)
+}
+
+// ChangeMedia replaces the medium of a CD-ROM drive with the ISO at path.
+func (i *Instance) ChangeMedia(ctx context.Context, cdrom int, path string) error {
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	return monitor.Execute(ctx, "blockdev-change-medium", map[string]interface{}{
+		"id":             cdromDeviceId(cdrom),
+		"filename":       path,
+		"format":         "raw",
+		"read-only-mode": "read-only",
+	}, nil)
+}
@@ -0,0 +1,125 @@
+package qemu
+
+import (
+	"os"
+	"testing"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootConfigArg(t *testing.T) {
+	tests := []struct {
+		name     string
+		boot     BootConfig
+		expected string
+		wantErr  bool
+	}{
+		{name: "order and menu", boot: BootConfig{Order: "dc", Menu: true}, expected: "order=dc,menu=on"},
+		{name: "installer", boot: BootConfig{Installer: true}, expected: "order=c,once=d"},
+		{name: "installer keeps order", boot: BootConfig{Installer: true, Order: "cn"}, expected: "order=cn,once=d"},
+		{name: "installer conflicts with once", boot: BootConfig{Installer: true, Once: "n"}, wantErr: true},
+		{name: "invalid device", boot: BootConfig{Order: "cx"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arg, err := tt.boot.arg()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, arg)
+		})
+	}
+}
+
+func TestQemuConfig_BootArgs(t *testing.T) {
+	uefi := &utils.FirmwareDescriptor{}
+
+	tests := []struct {
+		name    string
+		config  QemuConfig
+		arg     string
+		indexes map[byte]int
+		err     string
+	}{
+		{name: "default", config: QemuConfig{Arch: utils.ArchX86_64}},
+		{name: "bios", config: QemuConfig{Arch: utils.ArchX86_64, Boot: &BootConfig{Installer: true}}, arg: "order=c,once=d"},
+		{
+			name:    "uefi order",
+			config:  QemuConfig{Arch: utils.ArchX86_64, Firmware: uefi, Boot: &BootConfig{Order: "ndc"}},
+			indexes: map[byte]int{'n': 1, 'd': 2, 'c': 3},
+		},
+		{
+			name:    "uefi installer",
+			config:  QemuConfig{Arch: utils.ArchX86_64, Firmware: uefi, Boot: &BootConfig{Installer: true, Menu: true}},
+			arg:     "menu=on",
+			indexes: map[byte]int{'c': 1, 'd': 2},
+		},
+		{
+			name:    "uefi installer keeps order",
+			config:  QemuConfig{Arch: utils.ArchX86_64, Firmware: uefi, Boot: &BootConfig{Installer: true, Order: "n"}},
+			indexes: map[byte]int{'n': 1, 'c': 2, 'd': 3},
+		},
+		{
+			name:    "aarch64 boots uefi",
+			config:  QemuConfig{Arch: utils.ArchAarch64, Boot: &BootConfig{Order: "dc"}},
+			indexes: map[byte]int{'d': 1, 'c': 2},
+		},
+		{name: "uefi once", config: QemuConfig{Arch: utils.ArchX86_64, Firmware: uefi, Boot: &BootConfig{Once: "d"}}, err: "Once is not supported"},
+		{name: "uefi floppy", config: QemuConfig{Arch: utils.ArchX86_64, Firmware: uefi, Boot: &BootConfig{Order: "ac"}}, err: "not supported with UEFI"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arg, indexes, err := tt.config.bootArgs()
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.arg, arg)
+			assert.Equal(t, tt.indexes, indexes)
+		})
+	}
+}
+
+func TestBuildRootDiskArgs(t *testing.T) {
+	assert.Equal(t, []string{"-hda", "/vm/image.qcow2"}, buildRootDiskArgs("/vm/image.qcow2", utils.ArchX86_64, 0))
+	assert.Equal(t, []string{
+		"-drive", "if=none,id=hda,file=/vm/image.qcow2",
+		"-device", "ide-hd,drive=hda,id=hda-disk,bootindex=1",
+	}, buildRootDiskArgs("/vm/image.qcow2", utils.ArchX86_64, 1))
+	assert.Equal(t, []string{
+		"-drive", "if=none,id=hda,file=/vm/image.qcow2",
+		"-device", "virtio-blk-pci,drive=hda,id=hda-disk,bootindex=2",
+	}, buildRootDiskArgs("/vm/image.qcow2", utils.ArchAarch64, 2))
+}
+
+func TestBuildCdromArgs(t *testing.T) {
+	iso := t.TempDir() + "/installer.iso"
+	require.NoError(t, os.WriteFile(iso, nil, 0644))
+
+	args, err := buildCdromArgs([]string{iso, ""}, utils.ArchX86_64, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-drive", "if=none,id=cdrom0-drive,media=cdrom,readonly=on,format=raw,file=" + iso,
+		"-device", "ide-cd,drive=cdrom0-drive,id=cdrom0",
+		"-drive", "if=none,id=cdrom1-drive,media=cdrom,readonly=on",
+		"-device", "ide-cd,drive=cdrom1-drive,id=cdrom1",
+	}, args)
+
+	args, err = buildCdromArgs([]string{""}, utils.ArchAarch64, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-device", "virtio-scsi-pci,id=cdrom-scsi",
+		"-drive", "if=none,id=cdrom0-drive,media=cdrom,readonly=on",
+		"-device", "scsi-cd,drive=cdrom0-drive,id=cdrom0,bootindex=2",
+	}, args)
+
+	_, err = buildCdromArgs([]string{"/nonexistent.iso"}, utils.ArchX86_64, 0)
+	assert.Error(t, err)
+}
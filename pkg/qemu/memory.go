@@ -0,0 +1,174 @@
+package qemu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+type MemoryBackend string
+
+const (
+	MemoryBackendRam       MemoryBackend = "ram"       // anonymous memory
+	MemoryBackendMemfd     MemoryBackend = "memfd"     // shareable anonymous memory, Linux only
+	MemoryBackendHugepages MemoryBackend = "hugepages" // a file on hugetlbfs, Linux only
+)
+
+type MemoryHotplug string
+
+const (
+	MemoryHotplugNone   MemoryHotplug = ""
+	MemoryHotplugDimm   MemoryHotplug = "dimm"       // pc-dimm devices added per resize
+	MemoryHotplugVirtio MemoryHotplug = "virtio-mem" // a single virtio-mem device that is resized
+)
+
+const (
+	defaultHugepagePath = "/dev/hugepages"
+	defaultMemorySlots  = 16
+	virtioMemId         = "vmem0"
+)
+
+// NumaNode is a guest NUMA node. The memory of all nodes must add up to the guest memory.
+type NumaNode struct {
+	Memory    uint32 // in MB
+	Cpus      string // guest CPU indexes, e.g., "0-3,8"
+	HostNodes string // host NUMA nodes the memory is bound to, e.g., "0" or "0-1"
+	Policy    string // "bind" (default with HostNodes), "preferred" or "interleave"
+}
+
+// MemoryConfig configures how guest memory is backed, laid out and extended.
+type MemoryConfig struct {
+	Backend      MemoryBackend // defaults to MemoryBackendRam
+	HugepagePath string        // hugetlbfs mount point; defaults to /dev/hugepages
+	Prealloc     bool          // allocate all memory at startup
+	Mlock        bool          // lock guest memory into host RAM
+	Nodes        []NumaNode
+	MaxMemory    uint32        // in MB; enables Hotplug up to this size
+	Slots        int           // DIMM slots; defaults to 16 with MemoryHotplugDimm
+	Hotplug      MemoryHotplug // see Instance.AddMemory
+}
+
+func (m *MemoryConfig) backend() MemoryBackend {
+	if m.Backend == "" {
+		return MemoryBackendRam
+	}
+	return m.Backend
+}
+
+// memoryObject returns a memory backend object. Shared memory is required by vhost-user
+// devices such as virtiofs.
+func (m *MemoryConfig) memoryObject(id string, size uint32, shared bool, node *NumaNode) string {
+	object := ""
+	switch m.backend() {
+	case MemoryBackendMemfd:
+		object = fmt.Sprintf("memory-backend-memfd,id=%s,size=%dM,share=on", id, size)
+	case MemoryBackendHugepages:
+		path := m.HugepagePath
+		if path == "" {
+			path = defaultHugepagePath
+		}
+		object = fmt.Sprintf("memory-backend-file,id=%s,size=%dM,mem-path=%s", id, size, path)
+		if shared {
+			object += ",share=on"
+		}
+	default:
+		object = fmt.Sprintf("memory-backend-ram,id=%s,size=%dM", id, size)
+	}
+
+	if m.Prealloc {
+		object += ",prealloc=on"
+	}
+	if node != nil && node.HostNodes != "" {
+		policy := node.Policy
+		if policy == "" {
+			policy = "bind"
+		}
+		object += fmt.Sprintf(",host-nodes=%s,policy=%s", node.HostNodes, policy)
+	}
+	return object
+}
+
+// buildMemoryArgs returns the machine properties and arguments for guest memory. With
+// shared set, the backend must be mappable by other processes.
+func buildMemoryArgs(memory uint32, config MemoryConfig, shared bool) ([]string, []string, error) {
+	backend := config.backend()
+	if supportedErr := memoryBackendSupported(backend); supportedErr != nil {
+		return nil, nil, supportedErr
+	}
+	if shared && backend == MemoryBackendRam {
+		// Plain RAM cannot be shared; memfd is the closest equivalent.
+		if supportedErr := memoryBackendSupported(MemoryBackendMemfd); supportedErr != nil {
+			return nil, nil, fmt.Errorf("virtiofs requires shared memory: %w", supportedErr)
+		}
+		config.Backend = MemoryBackendMemfd
+	}
+
+	machine := []string{}
+	args := []string{}
+
+	size := utils.FormatMb(memory)
+	switch config.Hotplug {
+	case MemoryHotplugNone:
+		if config.MaxMemory != 0 {
+			return nil, nil, fmt.Errorf("memory configuration: MaxMemory requires a Hotplug mode")
+		}
+	case MemoryHotplugDimm, MemoryHotplugVirtio:
+		// Memory reaches MaxMemory once hotplugged memory is persisted, see Instance.AddMemory.
+		if config.MaxMemory < memory {
+			return nil, nil, fmt.Errorf("memory configuration: MaxMemory (%d MB) is below the memory (%d MB)", config.MaxMemory, memory)
+		}
+		size = fmt.Sprintf("size=%s,maxmem=%s", size, utils.FormatMb(config.MaxMemory))
+		if config.Hotplug == MemoryHotplugDimm {
+			slots := config.Slots
+			if slots == 0 {
+				slots = defaultMemorySlots
+			}
+			size += fmt.Sprintf(",slots=%d", slots)
+		}
+	default:
+		return nil, nil, fmt.Errorf("memory configuration: unknown hotplug mode %q", config.Hotplug)
+	}
+	args = append(args, "-m", size)
+
+	needsBackend := config.Backend != "" || config.Prealloc || shared
+	if len(config.Nodes) > 0 {
+		total := uint32(0)
+		for index, node := range config.Nodes {
+			total += node.Memory
+			id := fmt.Sprintf("mem%d", index)
+			args = append(args, "-object", config.memoryObject(id, node.Memory, shared, &node))
+
+			numa := fmt.Sprintf("node,nodeid=%d,memdev=%s", index, id)
+			for _, cpus := range strings.Split(node.Cpus, ",") {
+				if cpus != "" {
+					numa += ",cpus=" + cpus
+				}
+			}
+			args = append(args, "-numa", numa)
+		}
+		if total != memory {
+			return nil, nil, fmt.Errorf("memory configuration: NUMA nodes have %d MB, but the guest has %d MB", total, memory)
+		}
+	} else if needsBackend {
+		args = append(args, "-object", config.memoryObject("mem", memory, shared, nil))
+		machine = append(machine, "memory-backend=mem")
+	}
+
+	if config.Hotplug == MemoryHotplugVirtio && config.MaxMemory > memory {
+		// The device starts empty; Instance.AddMemory raises its requested size.
+		memdev := virtioMemId + "-mem"
+		args = append(args, "-object", config.memoryObject(memdev, config.MaxMemory-memory, shared, nil))
+		device := fmt.Sprintf("virtio-mem-pci,id=%s,memdev=%s,requested-size=0", virtioMemId, memdev)
+		if len(config.Nodes) > 0 {
+			device += ",node=0"
+		}
+		args = append(args, "-device", device)
+	}
+
+	if config.Mlock {
+		args = append(args, "-overcommit", "mem-lock=on")
+	}
+
+	return machine, args, nil
+}
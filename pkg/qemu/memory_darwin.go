@@ -0,0 +1,10 @@
+package qemu
+
+import "fmt"
+
+func memoryBackendSupported(backend MemoryBackend) error {
+	if backend != MemoryBackendRam {
+		return fmt.Errorf("memory backend %s is not supported on darwin", backend)
+	}
+	return nil
+}
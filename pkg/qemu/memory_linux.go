@@ -0,0 +1,5 @@
+package qemu
+
+func memoryBackendSupported(backend MemoryBackend) error {
+	return nil
+}
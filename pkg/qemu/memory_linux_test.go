@@ -0,0 +1,99 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMemoryArgs(t *testing.T) {
+	tests := []struct {
+		name            string
+		memory          uint32
+		config          MemoryConfig
+		shared          bool
+		expectedMachine []string
+		expectedArgs    []string
+	}{
+		{
+			name:            "defaults",
+			memory:          1024,
+			expectedMachine: []string{},
+			expectedArgs:    []string{"-m", "1024M"},
+		},
+		{
+			name:            "hugepages with preallocation and mlock",
+			memory:          2048,
+			config:          MemoryConfig{Backend: MemoryBackendHugepages, Prealloc: true, Mlock: true},
+			expectedMachine: []string{"memory-backend=mem"},
+			expectedArgs: []string{
+				"-m", "2048M",
+				"-object", "memory-backend-file,id=mem,size=2048M,mem-path=/dev/hugepages,prealloc=on",
+				"-overcommit", "mem-lock=on",
+			},
+		},
+		{
+			name:            "shared memory for virtiofs",
+			memory:          1024,
+			shared:          true,
+			expectedMachine: []string{"memory-backend=mem"},
+			expectedArgs:    []string{"-m", "1024M", "-object", "memory-backend-memfd,id=mem,size=1024M,share=on"},
+		},
+		{
+			name:   "NUMA nodes bound to host nodes",
+			memory: 4096,
+			config: MemoryConfig{Nodes: []NumaNode{
+				{Memory: 2048, Cpus: "0-1", HostNodes: "0"},
+				{Memory: 2048, Cpus: "2-3,6", HostNodes: "1", Policy: "preferred"},
+			}},
+			expectedMachine: []string{},
+			expectedArgs: []string{
+				"-m", "4096M",
+				"-object", "memory-backend-ram,id=mem0,size=2048M,host-nodes=0,policy=bind",
+				"-numa", "node,nodeid=0,memdev=mem0,cpus=0-1",
+				"-object", "memory-backend-ram,id=mem1,size=2048M,host-nodes=1,policy=preferred",
+				"-numa", "node,nodeid=1,memdev=mem1,cpus=2-3,cpus=6",
+			},
+		},
+		{
+			name:            "DIMM hotplug",
+			memory:          1024,
+			config:          MemoryConfig{MaxMemory: 8192, Hotplug: MemoryHotplugDimm},
+			expectedMachine: []string{},
+			expectedArgs:    []string{"-m", "size=1024M,maxmem=8192M,slots=16"},
+		},
+		{
+			name:            "virtio-mem hotplug",
+			memory:          1024,
+			config:          MemoryConfig{MaxMemory: 4096, Hotplug: MemoryHotplugVirtio},
+			expectedMachine: []string{},
+			expectedArgs: []string{
+				"-m", "size=1024M,maxmem=4096M",
+				"-object", "memory-backend-ram,id=vmem0-mem,size=3072M",
+				"-device", "virtio-mem-pci,id=vmem0,memdev=vmem0-mem,requested-size=0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine, args, err := buildMemoryArgs(tt.memory, tt.config, tt.shared)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedMachine, machine)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestBuildMemoryArgs_Invalid(t *testing.T) {
+	for name, config := range map[string]MemoryConfig{
+		"NUMA nodes do not add up":  {Nodes: []NumaNode{{Memory: 512}}},
+		"MaxMemory without hotplug": {MaxMemory: 4096},
+		"MaxMemory below memory":    {MaxMemory: 512, Hotplug: MemoryHotplugDimm},
+		"unknown hotplug mode":      {MaxMemory: 4096, Hotplug: "acpi"},
+	} {
+		_, _, err := buildMemoryArgs(1024, config, false)
+		assert.Error(t, err, name)
+	}
+}
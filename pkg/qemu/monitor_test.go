@@ -0,0 +1,125 @@
+package qemu
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSocket serves connections on path, answering each command with handler. Lines
+// received from events are written to whichever connection is open.
+func fakeSocket(t *testing.T, path, greeting string, events <-chan string, handler func(cmd map[string]interface{}) []string) {
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if greeting != "" {
+					conn.Write([]byte(greeting + "\n"))
+				}
+				done := make(chan struct{})
+				defer close(done)
+				go func() {
+					for {
+						select {
+						case line := <-events:
+							conn.Write([]byte(line + "\n"))
+						case <-done:
+							return
+						}
+					}
+				}()
+				decoder := json.NewDecoder(bufio.NewReader(conn))
+				for {
+					var cmd map[string]interface{}
+					if decoder.Decode(&cmd) != nil {
+						return
+					}
+					for _, line := range handler(cmd) {
+						conn.Write([]byte(line + "\n"))
+					}
+				}
+			}()
+		}
+	}()
+}
+
+// fakeMonitor is a QMP monitor that records the commands it receives. Commands are
+// answered by the handler passed to newFakeMonitor, or with an empty return value.
+type fakeMonitor struct {
+	events chan string // lines sent to the open connection, e.g., DEVICE_DELETED events
+
+	mu       sync.Mutex
+	commands []map[string]interface{}
+}
+
+// newFakeMonitor returns an instance whose QMP socket is served by a fakeMonitor.
+func newFakeMonitor(t *testing.T, handler func(cmd map[string]interface{}) []string) (*Instance, *fakeMonitor) {
+	dir := t.TempDir()
+	instance := &Instance{Name: "vm", Dir: dir, QMP: filepath.Join(dir, "qmp.sock"), QGA: filepath.Join(dir, "qga.sock")}
+	monitor := &fakeMonitor{events: make(chan string, 16)}
+
+	fakeSocket(t, instance.QMP, `{"QMP": {}}`, monitor.events, func(cmd map[string]interface{}) []string {
+		if cmd["execute"] == "qmp_capabilities" {
+			return []string{`{"return": {}}`}
+		}
+		monitor.mu.Lock()
+		monitor.commands = append(monitor.commands, cmd)
+		monitor.mu.Unlock()
+
+		if handler != nil {
+			if lines := handler(cmd); lines != nil {
+				return lines
+			}
+		}
+		return []string{`{"return": {}}`}
+	})
+
+	return instance, monitor
+}
+
+// executed returns the names of the commands received so far.
+func (m *fakeMonitor) executed() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := []string{}
+	for _, cmd := range m.commands {
+		names = append(names, cmd["execute"].(string))
+	}
+	return names
+}
+
+// arguments returns the arguments of the last command with the given name.
+func (m *fakeMonitor) arguments(name string) map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.commands) - 1; i >= 0; i-- {
+		if m.commands[i]["execute"] == name {
+			arguments, _ := m.commands[i]["arguments"].(map[string]interface{})
+			return arguments
+		}
+	}
+	return nil
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
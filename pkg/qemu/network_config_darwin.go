@@ -9,12 +9,12 @@ type VmnetBridged struct {
 	Interface string // interface name for bridged networking
 }
 
-// buildNetdevArgs returns the QEMU netdev arguments for bridged mode.
-func (b *VmnetBridged) buildNetdevArgs(id string) (string, error) {
+// netdev returns the QEMU netdev for bridged mode.
+func (b *VmnetBridged) netdev(id string) (descriptor, error) {
 	if b.Interface == "" {
-		return "", fmt.Errorf("vmnet-bridged: Interface must be set")
+		return descriptor{}, fmt.Errorf("vmnet-bridged: Interface must be set")
 	}
-	return fmt.Sprintf("vmnet-bridged,id=%s,ifname=%s", id, b.Interface), nil
+	return newNetdev("vmnet-bridged", prop("id", id), prop("ifname", b.Interface)), nil
 }
 
 // VmnetShared holds configuration for vmnet-shared networking mode.
@@ -24,11 +24,11 @@ type VmnetShared struct {
 	SubnetMask   string // e.g., "255.255.255.0"
 }
 
-// buildNetdevArgs returns the QEMU netdev arguments for shared mode.
+// netdev returns the QEMU netdev for shared mode.
 // If all address fields are empty, a bare vmnet-shared netdev is returned (QEMU defaults).
 // If all address fields are set, they are included in the netdev args.
 // If only some fields are set, an error is returned.
-func (s *VmnetShared) buildNetdevArgs(id string) (string, error) {
+func (s *VmnetShared) netdev(id string) (descriptor, error) {
 	fields := []string{s.StartAddress, s.EndAddress, s.SubnetMask}
 	setCount := 0
 	for _, f := range fields {
@@ -39,12 +39,12 @@ func (s *VmnetShared) buildNetdevArgs(id string) (string, error) {
 
 	switch setCount {
 	case 0:
-		return fmt.Sprintf("vmnet-shared,id=%s", id), nil
+		return newNetdev("vmnet-shared", prop("id", id)), nil
 	case len(fields):
-		return fmt.Sprintf("vmnet-shared,id=%s,start-address=%s,end-address=%s,subnet-mask=%s",
-			id, s.StartAddress, s.EndAddress, s.SubnetMask), nil
+		return newNetdev("vmnet-shared", prop("id", id), prop("start-address", s.StartAddress),
+			prop("end-address", s.EndAddress), prop("subnet-mask", s.SubnetMask)), nil
 	default:
-		return "", fmt.Errorf("vmnet-shared: all of StartAddress, EndAddress, and SubnetMask must be set together or all left empty")
+		return descriptor{}, fmt.Errorf("vmnet-shared: all of StartAddress, EndAddress, and SubnetMask must be set together or all left empty")
 	}
 }
 
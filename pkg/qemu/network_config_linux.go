@@ -2,8 +2,47 @@
 
 package qemu
 
+import (
+	"fmt"
+	"net"
+)
+
+// SocketNetwork holds configuration for a private VM-to-VM network built on QEMU socket netdevs.
+// Instances sharing the same Multicast group or Hub form an isolated L2 segment; no host
+// privileges are required. Exactly one of Multicast or Hub must be set.
+type SocketNetwork struct {
+	Multicast string // multicast group and port, e.g., "230.0.0.1:1234"
+	Hub       string // unix socket path of a network.Hub
+}
+
+// netdev returns the QEMU netdev for socket networking.
+func (s *SocketNetwork) netdev(id string) (descriptor, error) {
+	if s.Multicast != "" && s.Hub != "" {
+		return descriptor{}, fmt.Errorf("socket network: Multicast and Hub are mutually exclusive")
+	}
+
+	if s.Hub != "" {
+		return newNetdev("stream", prop("id", id), prop("server", false),
+			prop("addr", []property{prop("type", "unix"), prop("path", s.Hub)})), nil
+	}
+
+	if s.Multicast != "" {
+		host, port, splitErr := net.SplitHostPort(s.Multicast)
+		if splitErr != nil {
+			return descriptor{}, fmt.Errorf("socket network: invalid Multicast address %q: %w", s.Multicast, splitErr)
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.IsMulticast() {
+			return descriptor{}, fmt.Errorf("socket network: %s is not a multicast address", host)
+		}
+		return newNetdev("dgram", prop("id", id),
+			prop("remote", []property{prop("type", "inet"), prop("host", host), prop("port", port)})), nil
+	}
+
+	return descriptor{}, fmt.Errorf("socket network: either Multicast or Hub must be set")
+}
+
 // LinuxNetworkConfig holds Linux-specific network configuration.
-// Currently empty as Linux tap networking uses the VM ID as interface name.
+// When Socket is nil, tap networking is used with the VM ID as interface name.
 type LinuxNetworkConfig struct {
-	// Future Linux-specific network fields can be added here
+	Socket *SocketNetwork // for private socket-based VM-to-VM networks
 }
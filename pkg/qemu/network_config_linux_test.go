@@ -0,0 +1,44 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketNetwork_Netdev(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  SocketNetwork
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "hub",
+			network:  SocketNetwork{Hub: "/run/hub.sock"},
+			expected: "stream,id=vm,server=off,addr.type=unix,addr.path=/run/hub.sock",
+		},
+		{
+			name:     "multicast",
+			network:  SocketNetwork{Multicast: "230.0.0.1:1234"},
+			expected: "dgram,id=vm,remote.type=inet,remote.host=230.0.0.1,remote.port=1234",
+		},
+		{name: "both", network: SocketNetwork{Hub: "/run/hub.sock", Multicast: "230.0.0.1:1234"}, wantErr: "mutually exclusive"},
+		{name: "neither", network: SocketNetwork{}, wantErr: "must be set"},
+		{name: "unicast group", network: SocketNetwork{Multicast: "10.0.0.1:1234"}, wantErr: "not a multicast address"},
+		{name: "missing port", network: SocketNetwork{Multicast: "230.0.0.1"}, wantErr: "invalid Multicast address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netdev, err := tt.network.netdev("vm")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, netdev.arg())
+		})
+	}
+}
@@ -5,33 +5,52 @@ import (
 )
 
 func buildNetwork(id string, network NetworkConfig, platform *PlatformConfig) ([]string, error) {
+	netdev, device, nicErr := nicDescriptors(id, network, platform)
+	if nicErr != nil {
+		return nil, nicErr
+	}
+
+	args := []string{
+		"-netdev", netdev.arg(),
+		"-device", device.arg(),
+	}
+
+	return args, nil
+}
+
+// nicDescriptors returns the netdev and device of a NIC, shared by cold-plug and AttachNIC.
+func nicDescriptors(id string, network NetworkConfig, platform *PlatformConfig) (descriptor, descriptor, error) {
 	if platform == nil || platform.Network == nil {
-		return nil, fmt.Errorf("platform network configuration required")
+		return descriptor{}, descriptor{}, fmt.Errorf("platform network configuration required")
+	}
+
+	if network.RateLimit != nil {
+		return descriptor{}, descriptor{}, fmt.Errorf("network configuration: RateLimit is not supported with vmnet networking")
 	}
 
 	darwinNet := platform.Network
 	if darwinNet.Bridged != nil && darwinNet.Shared != nil {
-		return nil, fmt.Errorf("network configuration: Bridged and Shared are mutually exclusive")
+		return descriptor{}, descriptor{}, fmt.Errorf("network configuration: Bridged and Shared are mutually exclusive")
 	}
 
-	var netdevArgs string
-	var netdevArgsErr error
+	var netdev descriptor
+	var netdevErr error
 
 	if darwinNet.Bridged != nil {
-		netdevArgs, netdevArgsErr = darwinNet.Bridged.buildNetdevArgs(id)
+		netdev, netdevErr = darwinNet.Bridged.netdev(id)
 	} else if darwinNet.Shared != nil {
-		netdevArgs, netdevArgsErr = darwinNet.Shared.buildNetdevArgs(id)
+		netdev, netdevErr = darwinNet.Shared.netdev(id)
 	} else {
-		return nil, fmt.Errorf("network configuration required: either Bridged or Shared must be set")
+		return descriptor{}, descriptor{}, fmt.Errorf("network configuration required: either Bridged or Shared must be set")
 	}
-	if netdevArgsErr != nil {
-		return nil, netdevArgsErr
+	if netdevErr != nil {
+		return descriptor{}, descriptor{}, netdevErr
 	}
 
-	args := []string{
-		"-netdev", netdevArgs,
-		"-device", fmt.Sprintf("%s,netdev=%s,mac=%s,id=%s", network.Driver, id, network.Mac, id),
+	device := newDevice(network.Driver, prop("netdev", id), prop("mac", network.Mac), prop("id", id))
+	if network.bootIndex != 0 {
+		device.props = append(device.props, prop("bootindex", network.bootIndex))
 	}
 
-	return args, nil
+	return netdev, device, nil
 }
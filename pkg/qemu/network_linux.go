@@ -3,10 +3,45 @@ package qemu
 import "fmt"
 
 func buildNetwork(id string, network NetworkConfig, platform *PlatformConfig) ([]string, error) {
+	netdev, device, nicErr := nicDescriptors(id, network, platform)
+	if nicErr != nil {
+		return nil, nicErr
+	}
+
 	args := []string{}
 
-	args = append(args, "-device", fmt.Sprintf("%s,netdev=%s,mac=%s,id=%s", network.Driver, id, network.Mac, id))
-	args = append(args, "-netdev", fmt.Sprintf("tap,id=%s,ifname=%s,script=no,downscript=no", id, id))
+	args = append(args, "-device", device.arg())
+	args = append(args, "-netdev", netdev.arg())
 
 	return args, nil
 }
+
+// nicDescriptors returns the netdev and device of a NIC, shared by cold-plug and AttachNIC.
+func nicDescriptors(id string, network NetworkConfig, platform *PlatformConfig) (descriptor, descriptor, error) {
+	netdev := newNetdev("tap", prop("id", id), prop("ifname", id), prop("script", "no"), prop("downscript", "no"))
+
+	if platform != nil && platform.Network != nil && platform.Network.Socket != nil {
+		socketNetdev, socketNetdevErr := platform.Network.Socket.netdev(id)
+		if socketNetdevErr != nil {
+			return descriptor{}, descriptor{}, socketNetdevErr
+		}
+		netdev = socketNetdev
+
+		if network.RateLimit != nil {
+			return descriptor{}, descriptor{}, fmt.Errorf("network configuration: RateLimit requires tap networking")
+		}
+	}
+
+	if network.RateLimit != nil {
+		if validateErr := network.RateLimit.validate(); validateErr != nil {
+			return descriptor{}, descriptor{}, validateErr
+		}
+	}
+
+	device := newDevice(network.Driver, prop("netdev", id), prop("mac", network.Mac), prop("id", id))
+	if network.bootIndex != 0 {
+		device.props = append(device.props, prop("bootindex", network.bootIndex))
+	}
+
+	return netdev, device, nil
+}
@@ -0,0 +1,136 @@
+package qemu
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+// usbPassthroughBus is the xhci controller host USB devices are attached to.
+const usbPassthroughBus = "usb-passthrough"
+
+// PciPassthrough is a host PCI device assigned to the guest through VFIO. The device and
+// the rest of its IOMMU group must be bound to vfio-pci, bridges excepted.
+type PciPassthrough struct {
+	Address string // host PCI address, e.g., "0000:03:00.0"
+	Bind    bool   // bind to vfio-pci on Start and rebind the host driver when QEMU exits
+}
+
+// UsbPassthrough is a host USB device, selected either by VendorId and ProductId or by
+// Bus and Address.
+type UsbPassthrough struct {
+	VendorId  uint16
+	ProductId uint16
+	Bus       int
+	Address   int
+}
+
+func pciPassthroughId(i int) string {
+	return fmt.Sprintf("hostpci%d", i)
+}
+
+func usbPassthroughId(i int) string {
+	return fmt.Sprintf("hostusb%d", i)
+}
+
+func (u UsbPassthrough) device(id string) (descriptor, error) {
+	byId := u.VendorId != 0 || u.ProductId != 0
+	byPort := u.Bus != 0 || u.Address != 0
+	switch {
+	case byId && byPort:
+		return descriptor{}, fmt.Errorf("USB device %s: select by vendor/product or by bus/address, not both", id)
+	case byId && (u.VendorId == 0 || u.ProductId == 0):
+		return descriptor{}, fmt.Errorf("USB device %s: both VendorId and ProductId must be set", id)
+	case byPort && (u.Bus == 0 || u.Address == 0):
+		return descriptor{}, fmt.Errorf("USB device %s: both Bus and Address must be set", id)
+	case !byId && !byPort:
+		return descriptor{}, fmt.Errorf("USB device %s: no device selected", id)
+	}
+
+	props := []property{prop("bus", usbPassthroughBus+".0")}
+	if byId {
+		props = append(props, prop("vendorid", fmt.Sprintf("0x%04x", u.VendorId)), prop("productid", fmt.Sprintf("0x%04x", u.ProductId)))
+	} else {
+		props = append(props, prop("hostbus", u.Bus), prop("hostaddr", u.Address))
+	}
+	props = append(props, prop("id", id))
+
+	return newDevice("usb-host", props...), nil
+}
+
+// buildPassthroughArgs validates the IOMMU groups of PCI devices and returns their vfio-pci
+// devices, followed by the usb-host devices on a dedicated xhci controller. Devices with
+// Bind set are not bound yet; see bindPciDevices.
+func buildPassthroughArgs(sysfs utils.Sysfs, pci []PciPassthrough, usb []UsbPassthrough) ([]string, error) {
+	args := []string{}
+
+	if len(pci) > 0 {
+		if supportedErr := pciPassthroughSupported(); supportedErr != nil {
+			return nil, supportedErr
+		}
+	}
+
+	binding := []string{}
+	for _, device := range pci {
+		if device.Bind {
+			binding = append(binding, device.Address)
+		}
+	}
+
+	addresses := map[string]bool{}
+	for i, device := range pci {
+		address, addressErr := utils.NormalizePciAddress(device.Address)
+		if addressErr != nil {
+			return nil, addressErr
+		}
+		if addresses[address] {
+			return nil, fmt.Errorf("PCI device %s: passed through twice", address)
+		}
+		addresses[address] = true
+
+		if validateErr := sysfs.ValidateIommuGroup(address, binding...); validateErr != nil {
+			return nil, validateErr
+		}
+		args = append(args, "-device", newDevice("vfio-pci", prop("host", address), prop("id", pciPassthroughId(i))).arg())
+	}
+
+	if len(usb) > 0 {
+		args = append(args, "-device", "qemu-xhci,id="+usbPassthroughBus)
+	}
+	for i, device := range usb {
+		usbDevice, usbErr := device.device(usbPassthroughId(i))
+		if usbErr != nil {
+			return nil, usbErr
+		}
+		args = append(args, "-device", usbDevice.arg())
+	}
+
+	return args, nil
+}
+
+// bindPciDevices binds the devices with Bind set to vfio-pci and returns their addresses.
+// On failure, devices bound so far are released again.
+func bindPciDevices(sysfs utils.Sysfs, pci []PciPassthrough) ([]string, error) {
+	bound := []string{}
+	for _, device := range pci {
+		if !device.Bind {
+			continue
+		}
+		if bindErr := sysfs.BindVfio(device.Address); bindErr != nil {
+			releasePciDevices(sysfs, bound)
+			return nil, fmt.Errorf("failed to bind PCI device %s to %s: %w", device.Address, utils.VfioPciDriver, bindErr)
+		}
+		bound = append(bound, device.Address)
+	}
+	return bound, nil
+}
+
+// releasePciDevices hands devices bound by bindPciDevices back to their host drivers.
+func releasePciDevices(sysfs utils.Sysfs, addresses []string) {
+	for _, address := range addresses {
+		if unbindErr := sysfs.UnbindVfio(address); unbindErr != nil {
+			slog.Error("Failed to release PCI device", "address", address, "error", unbindErr)
+		}
+	}
+}
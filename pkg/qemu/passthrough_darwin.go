@@ -0,0 +1,7 @@
+package qemu
+
+import "fmt"
+
+func pciPassthroughSupported() error {
+	return fmt.Errorf("PCI passthrough requires VFIO and is not supported on darwin")
+}
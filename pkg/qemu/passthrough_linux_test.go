@@ -0,0 +1,77 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePciSysfs builds a sysfs tree with one IOMMU group holding a GPU bound to driver
+// and its audio function bound to snd_hda_intel.
+func fakePciSysfs(t *testing.T, driver string) utils.Sysfs {
+	sysfs, err := utils.WriteFakeSysfs(t.TempDir(),
+		utils.PciDevice{Address: "0000:01:00.0", Vendor: "0x10de", Device: "0x1b80", Class: "0x030000", Driver: driver, IommuGroup: "7"},
+		utils.PciDevice{Address: "0000:01:00.1", Vendor: "0x10de", Device: "0x10f0", Class: "0x040300", Driver: "snd_hda_intel", IommuGroup: "7"},
+	)
+	require.NoError(t, err)
+	return sysfs
+}
+
+func TestBuildPassthroughArgs_Pci(t *testing.T) {
+	sysfs := fakePciSysfs(t, utils.VfioPciDriver)
+
+	_, err := buildPassthroughArgs(sysfs, []PciPassthrough{{Address: "01:00.0"}}, nil)
+	assert.ErrorContains(t, err, "bound to snd_hda_intel", "the whole IOMMU group must be assigned")
+
+	args, err := buildPassthroughArgs(sysfs, []PciPassthrough{{Address: "01:00.0"}, {Address: "01:00.1", Bind: true}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-device", "vfio-pci,host=0000:01:00.0,id=hostpci0",
+		"-device", "vfio-pci,host=0000:01:00.1,id=hostpci1",
+	}, args)
+
+	_, err = buildPassthroughArgs(sysfs, []PciPassthrough{{Address: "01:00.0"}, {Address: "01:00.1", Bind: true}, {Address: "0000:01:00.1"}}, nil)
+	assert.ErrorContains(t, err, "passed through twice")
+}
+
+func TestBindPciDevices(t *testing.T) {
+	sysfs := fakePciSysfs(t, "nouveau")
+
+	bound, err := bindPciDevices(sysfs, []PciPassthrough{{Address: "0000:01:00.0", Bind: true}, {Address: "0000:01:00.1"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0000:01:00.0"}, bound)
+
+	override, err := os.ReadFile(filepath.Join(sysfs.Root, "bus", "pci", "devices", "0000:01:00.0", "driver_override"))
+	require.NoError(t, err)
+	assert.Equal(t, utils.VfioPciDriver, string(override))
+	unbind, err := os.ReadFile(filepath.Join(sysfs.Root, "bus", "pci", "drivers", "nouveau", "unbind"))
+	require.NoError(t, err)
+	assert.Equal(t, "0000:01:00.0", string(unbind))
+
+	releasePciDevices(sysfs, bound)
+	override, err = os.ReadFile(filepath.Join(sysfs.Root, "bus", "pci", "devices", "0000:01:00.0", "driver_override"))
+	require.NoError(t, err)
+	assert.Equal(t, "\n", string(override))
+}
+
+func TestBuildPassthroughArgs_Usb(t *testing.T) {
+	args, err := buildPassthroughArgs(utils.Sysfs{}, nil, []UsbPassthrough{
+		{VendorId: 0x046d, ProductId: 0xc52b},
+		{Bus: 1, Address: 4},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-device", "qemu-xhci,id=usb-passthrough",
+		"-device", "usb-host,bus=usb-passthrough.0,vendorid=0x046d,productid=0xc52b,id=hostusb0",
+		"-device", "usb-host,bus=usb-passthrough.0,hostbus=1,hostaddr=4,id=hostusb1",
+	}, args)
+
+	for _, device := range []UsbPassthrough{{}, {VendorId: 0x046d}, {Bus: 1}, {VendorId: 0x046d, ProductId: 0xc52b, Bus: 1, Address: 4}} {
+		_, err := buildPassthroughArgs(utils.Sysfs{}, nil, []UsbPassthrough{device})
+		assert.Error(t, err, "%+v", device)
+	}
+}
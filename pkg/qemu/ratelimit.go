@@ -0,0 +1,108 @@
+package qemu
+
+import "fmt"
+
+// minBurst is the smallest burst accepted by tc, large enough for a full-sized frame.
+const minBurst = 16 * 1024
+
+// minPacketBurst is the smallest packet burst, so short bursts of small packets pass.
+const minPacketBurst = 8
+
+// RateLimit caps the network usage of a NIC. Rates are in bits or packets per second and
+// zero means unlimited. Ingress is traffic towards the guest, egress traffic from it.
+type RateLimit struct {
+	Ingress        uint64
+	Egress         uint64
+	Burst          uint64 // in bytes; defaults to 100ms worth of traffic at the configured rate
+	IngressPackets uint64
+	EgressPackets  uint64
+	PacketBurst    uint64 // in packets; defaults to 100ms worth of packets at the configured rate
+}
+
+func (r *RateLimit) validate() error {
+	if r.Ingress == 0 && r.Egress == 0 && r.Burst != 0 {
+		return fmt.Errorf("rate limit: Burst requires Ingress or Egress to be set")
+	}
+	if r.IngressPackets == 0 && r.EgressPackets == 0 && r.PacketBurst != 0 {
+		return fmt.Errorf("rate limit: PacketBurst requires IngressPackets or EgressPackets to be set")
+	}
+	return nil
+}
+
+// applyRateLimitsOnStart applies the limits of the primary NIC, whose tap is named after
+// the instance, and of the additional NICs, whose taps are named after their IDs.
+func applyRateLimitsOnStart(name string, config Config) error {
+	if config.RateLimit != nil {
+		if applyErr := applyRateLimitOnStart(name, config.RateLimit); applyErr != nil {
+			return applyErr
+		}
+	}
+	for _, nic := range config.Nics {
+		if nic.Network.RateLimit != nil {
+			if applyErr := applyRateLimitOnStart(nic.Id, nic.Network.RateLimit); applyErr != nil {
+				return fmt.Errorf("nic %s: %w", nic.Id, applyErr)
+			}
+		}
+	}
+	return nil
+}
+
+// burst returns the burst size in bytes to use for the given rate.
+func (r *RateLimit) burst(rate uint64) uint64 {
+	if r.Burst != 0 {
+		return max(r.Burst, minBurst)
+	}
+	return max(rate/8/10, minBurst)
+}
+
+// packetBurst returns the burst size in packets to use for the given packet rate.
+func (r *RateLimit) packetBurst(rate uint64) uint64 {
+	if r.PacketBurst != 0 {
+		return max(r.PacketBurst, minPacketBurst)
+	}
+	return max(rate/10, minPacketBurst)
+}
+
+// tcCommands returns the tc invocations applying the limit to a tap device, assuming no
+// limits are configured yet. Bandwidth towards the guest is shaped by a tbf qdisc; all
+// other limits police traffic through clsact filters, which drop what exceeds the rate.
+func (r *RateLimit) tcCommands(tap string) [][]string {
+	commands := [][]string{}
+
+	// Traffic towards the guest leaves the host through the tap.
+	if r.Ingress != 0 {
+		commands = append(commands, []string{"qdisc", "add", "dev", tap, "root", "tbf",
+			"rate", fmt.Sprintf("%dbit", r.Ingress),
+			"burst", fmt.Sprintf("%d", r.burst(r.Ingress)),
+			"latency", "50ms"})
+	}
+
+	if r.Egress == 0 && r.IngressPackets == 0 && r.EgressPackets == 0 {
+		return commands
+	}
+	commands = append(commands, []string{"qdisc", "add", "dev", tap, "clsact"})
+
+	// Byte and packet rates cannot share a police action; packets conforming to the first
+	// filter continue to the next one.
+	police := func(hook string, prio int, rate ...string) []string {
+		command := []string{"filter", "add", "dev", tap, hook, "prio", fmt.Sprintf("%d", prio), "matchall", "action", "police"}
+		command = append(command, rate...)
+		return append(command, "conform-exceed", "drop/continue")
+	}
+
+	// Traffic from the guest enters the host through the tap.
+	if r.Egress != 0 {
+		commands = append(commands, police("ingress", 1,
+			"rate", fmt.Sprintf("%dbit", r.Egress), "burst", fmt.Sprintf("%d", r.burst(r.Egress))))
+	}
+	if r.EgressPackets != 0 {
+		commands = append(commands, police("ingress", 2,
+			"pkt_rate", fmt.Sprintf("%d", r.EgressPackets), "pkt_burst", fmt.Sprintf("%d", r.packetBurst(r.EgressPackets))))
+	}
+	if r.IngressPackets != 0 {
+		commands = append(commands, police("egress", 1,
+			"pkt_rate", fmt.Sprintf("%d", r.IngressPackets), "pkt_burst", fmt.Sprintf("%d", r.packetBurst(r.IngressPackets))))
+	}
+
+	return commands
+}
@@ -0,0 +1,12 @@
+package qemu
+
+import "fmt"
+
+// SetRateLimit is not supported with vmnet networking, which offers no traffic shaping.
+func (i *Instance) SetRateLimit(limit *RateLimit) error {
+	return fmt.Errorf("rate limit: not supported with vmnet networking")
+}
+
+func applyRateLimitOnStart(tap string, limit *RateLimit) error {
+	return fmt.Errorf("rate limit: not supported with vmnet networking")
+}
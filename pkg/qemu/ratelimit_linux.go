@@ -0,0 +1,71 @@
+package qemu
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+const tapWaitTimeout = 5 * time.Second
+
+// SetRateLimit applies limit to the tap device of a running instance, replacing any
+// previous limit, and records it in the manifest. A nil limit removes all limits.
+func (i *Instance) SetRateLimit(limit *RateLimit) error {
+	if applyErr := applyRateLimit(i.Name, limit); applyErr != nil {
+		return applyErr
+	}
+	return updateManifest(i.Dir, func(config *Config) {
+		config.RateLimit = limit
+	})
+}
+
+func applyRateLimit(tap string, limit *RateLimit) error {
+	if _, statErr := os.Stat(filepath.Join("/sys/class/net", tap)); statErr != nil {
+		return fmt.Errorf("rate limit: no tap device %s: %w", tap, statErr)
+	}
+
+	// Remove existing limits; these fail harmlessly when nothing is configured.
+	runTc("qdisc", "del", "dev", tap, "root")
+	runTc("qdisc", "del", "dev", tap, "clsact")
+	runTc("qdisc", "del", "dev", tap, "ingress")
+
+	if limit == nil {
+		return nil
+	}
+	if validateErr := limit.validate(); validateErr != nil {
+		return validateErr
+	}
+
+	for _, command := range limit.tcCommands(tap) {
+		if tcErr := runTc(command...); tcErr != nil {
+			return tcErr
+		}
+	}
+
+	return nil
+}
+
+// applyRateLimitOnStart waits for QEMU to bring up the tap device before applying limit.
+func applyRateLimitOnStart(tap string, limit *RateLimit) error {
+	deadline := time.Now().Add(tapWaitTimeout)
+	for {
+		if _, statErr := os.Stat(filepath.Join("/sys/class/net", tap)); statErr == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return applyRateLimit(tap, limit)
+}
+
+func runTc(args ...string) error {
+	cmd := exec.Command("tc", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("tc %v failed: %w: %s", args, err, stderr.String())
+	}
+	return nil
+}
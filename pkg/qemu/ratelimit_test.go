@@ -0,0 +1,53 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit_Validate(t *testing.T) {
+	assert.NoError(t, (&RateLimit{Ingress: 1_000_000, Burst: 64 * 1024}).validate())
+	assert.NoError(t, (&RateLimit{EgressPackets: 1000, PacketBurst: 100}).validate())
+	assert.Error(t, (&RateLimit{Burst: 64 * 1024}).validate(), "burst without a byte rate")
+	assert.Error(t, (&RateLimit{Ingress: 1_000_000, PacketBurst: 100}).validate(), "packet burst without a packet rate")
+}
+
+func TestRateLimit_Burst(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    RateLimit
+		rate     uint64
+		expected uint64
+	}{
+		{name: "100ms of traffic", limit: RateLimit{}, rate: 100_000_000, expected: 1_250_000},
+		{name: "at least one frame", limit: RateLimit{}, rate: 1_000, expected: minBurst},
+		{name: "explicit", limit: RateLimit{Burst: 1 << 20}, rate: 1_000, expected: 1 << 20},
+		{name: "explicit below minimum", limit: RateLimit{Burst: 100}, rate: 1_000, expected: minBurst},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.limit.burst(tt.rate))
+		})
+	}
+
+	assert.Equal(t, uint64(100), (&RateLimit{}).packetBurst(1000))
+	assert.Equal(t, uint64(minPacketBurst), (&RateLimit{}).packetBurst(10))
+	assert.Equal(t, uint64(500), (&RateLimit{PacketBurst: 500}).packetBurst(10))
+}
+
+func TestRateLimit_TcCommands(t *testing.T) {
+	assert.Equal(t, [][]string{
+		{"qdisc", "add", "dev", "vm", "root", "tbf", "rate", "8000000bit", "burst", "100000", "latency", "50ms"},
+	}, (&RateLimit{Ingress: 8_000_000}).tcCommands("vm"))
+
+	assert.Equal(t, [][]string{
+		{"qdisc", "add", "dev", "vm", "clsact"},
+		{"filter", "add", "dev", "vm", "ingress", "prio", "1", "matchall", "action", "police", "rate", "8000000bit", "burst", "100000", "conform-exceed", "drop/continue"},
+		{"filter", "add", "dev", "vm", "ingress", "prio", "2", "matchall", "action", "police", "pkt_rate", "5000", "pkt_burst", "500", "conform-exceed", "drop/continue"},
+		{"filter", "add", "dev", "vm", "egress", "prio", "1", "matchall", "action", "police", "pkt_rate", "2000", "pkt_burst", "200", "conform-exceed", "drop/continue"},
+	}, (&RateLimit{Egress: 8_000_000, EgressPackets: 5000, IngressPackets: 2000}).tcCommands("vm"))
+
+	assert.Empty(t, (&RateLimit{}).tcCommands("vm"))
+}
@@ -0,0 +1,293 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+type hotpluggableCpu struct {
+	Type       string                 `json:"type"`
+	VcpusCount int                    `json:"vcpus-count"`
+	Props      map[string]interface{} `json:"props"`
+	QomPath    string                 `json:"qom-path"`
+}
+
+// cpuDeviceId names a hotplugged CPU after its topology, e.g., "cpu-s1-c0-t0".
+func cpuDeviceId(props map[string]interface{}) string {
+	id := "cpu"
+	for _, key := range []string{"node-id", "drawer-id", "book-id", "socket-id", "die-id", "cluster-id", "core-id", "thread-id"} {
+		if value, ok := props[key]; ok {
+			id += fmt.Sprintf("-%s%v", key[:1], value)
+		}
+	}
+	return id
+}
+
+// SetCpus plugs or unplugs vCPUs until the guest has n of them. Plugging requires free
+// slots, see CpuConfig.MaxCpus; only CPUs plugged at runtime can be unplugged. New CPUs
+// are onlined through the guest agent, and the manifest is updated so that a restart
+// keeps the new count. If plugging or unplugging fails midway, the count reached is
+// recorded before the error is returned.
+func (i *Instance) SetCpus(ctx context.Context, n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid vCPU count %d", n)
+	}
+
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	var cpus []hotpluggableCpu
+	if execErr := monitor.Execute(ctx, "query-hotpluggable-cpus", nil, &cpus); execErr != nil {
+		return execErr
+	}
+
+	current, maxCpus, removable := 0, 0, 0
+	for _, cpu := range cpus {
+		maxCpus += cpu.VcpusCount
+		if cpu.QomPath != "" {
+			current += cpu.VcpusCount
+		}
+		if strings.HasPrefix(cpu.QomPath, "/machine/peripheral/") {
+			removable += cpu.VcpusCount
+		}
+	}
+	if n > maxCpus {
+		return fmt.Errorf("only %d vCPUs fit the CPU topology; raise Cpu.MaxCpus", maxCpus)
+	}
+	if n < current-removable {
+		return fmt.Errorf("only CPUs plugged at runtime can be unplugged; at least %d vCPUs remain", current-removable)
+	}
+
+	var resizeErr error
+	switch {
+	case n > current:
+		plugged := current
+		for _, cpu := range cpus {
+			if current >= n {
+				break
+			}
+			if cpu.QomPath != "" {
+				continue
+			}
+			args := map[string]interface{}{"driver": cpu.Type, "id": cpuDeviceId(cpu.Props)}
+			for key, value := range cpu.Props {
+				args[key] = value
+			}
+			if resizeErr = monitor.Execute(ctx, "device_add", args, nil); resizeErr != nil {
+				break
+			}
+			current += cpu.VcpusCount
+		}
+		if current > plugged {
+			i.onlineCpus(ctx)
+		}
+	case n < current:
+		for index := len(cpus) - 1; index >= 0 && current > n; index-- {
+			cpu := cpus[index]
+			id, hotplugged := strings.CutPrefix(cpu.QomPath, "/machine/peripheral/")
+			if !hotplugged {
+				continue
+			}
+			if resizeErr = unplugDevice(ctx, monitor, id); resizeErr != nil {
+				break
+			}
+			current -= cpu.VcpusCount
+		}
+	}
+
+	// Slots may hold several vCPUs, so the count reached is recorded rather than n.
+	if updateErr := updateManifest(i.Dir, func(config *Config) {
+		config.Cpus = uint32(current)
+	}); updateErr != nil {
+		return errors.Join(resizeErr, updateErr)
+	}
+	return resizeErr
+}
+
+// AddMemory adds mb of memory to a guest started with MemoryConfig.Hotplug: a virtio-mem
+// device is grown, or a pc-dimm is plugged. New memory is onlined through the guest agent,
+// and the manifest is updated so that a restart keeps the new size.
+func (i *Instance) AddMemory(ctx context.Context, mb uint32) error {
+	config, manifestErr := ReadManifest(i.Dir)
+	if manifestErr != nil {
+		return manifestErr
+	}
+	memory := config.MemoryOptions
+	if memory.MaxMemory != 0 && config.Memory+mb > memory.MaxMemory {
+		return fmt.Errorf("cannot grow memory to %d MB, the maximum is %d MB", config.Memory+mb, memory.MaxMemory)
+	}
+
+	monitor, monitorErr := i.monitor(ctx)
+	if monitorErr != nil {
+		return monitorErr
+	}
+	defer monitor.Close()
+
+	switch memory.Hotplug {
+	case MemoryHotplugVirtio:
+		path := "/machine/peripheral/" + virtioMemId
+		var requested uint64
+		if execErr := monitor.Execute(ctx, "qom-get", map[string]interface{}{
+			"path":     path,
+			"property": "requested-size",
+		}, &requested); execErr != nil {
+			return execErr
+		}
+		if execErr := monitor.Execute(ctx, "qom-set", map[string]interface{}{
+			"path":     path,
+			"property": "requested-size",
+			"value":    requested + utils.MbToBytes(uint64(mb)),
+		}, nil); execErr != nil {
+			return execErr
+		}
+	case MemoryHotplugDimm:
+		var devices []memoryDevice
+		if execErr := monitor.Execute(ctx, "query-memory-devices", nil, &devices); execErr != nil {
+			return execErr
+		}
+		id := nextDimmId(devices)
+
+		qomType, props := memory.hotplugObject(utils.MbToBytes(uint64(mb)), hasVirtiofsShare(config.Shares))
+		props["qom-type"] = qomType
+		props["id"] = id + "-mem"
+		if execErr := monitor.Execute(ctx, "object-add", props, nil); execErr != nil {
+			return execErr
+		}
+		if execErr := monitor.Execute(ctx, "device_add", map[string]interface{}{
+			"driver": "pc-dimm",
+			"id":     id,
+			"memdev": id + "-mem",
+		}, nil); execErr != nil {
+			monitor.Execute(ctx, "object-del", map[string]interface{}{"id": id + "-mem"}, nil)
+			return execErr
+		}
+	default:
+		return fmt.Errorf("instance %s was not started with memory hotplug", i.Name)
+	}
+
+	i.onlineMemory(ctx)
+
+	return updateManifest(i.Dir, func(config *Config) {
+		config.Memory += mb
+	})
+}
+
+type memoryDevice struct {
+	Type string `json:"type"`
+	Data struct {
+		Id string `json:"id"`
+	} `json:"data"`
+}
+
+// nextDimmId returns the first "dimmN" id not used by a memory device. Ids of unplugged
+// DIMMs are reused.
+func nextDimmId(devices []memoryDevice) string {
+	used := map[string]bool{}
+	for _, device := range devices {
+		used[device.Data.Id] = true
+	}
+	for n := 0; ; n++ {
+		if id := fmt.Sprintf("dimm%d", n); !used[id] {
+			return id
+		}
+	}
+}
+
+// hotplugObject returns the QOM type and properties of a backend for a hotplugged DIMM,
+// matching the backend of the boot memory.
+func (m *MemoryConfig) hotplugObject(size uint64, shared bool) (string, map[string]interface{}) {
+	props := map[string]interface{}{"size": size}
+	if m.Prealloc {
+		props["prealloc"] = true
+	}
+
+	switch {
+	case m.backend() == MemoryBackendHugepages:
+		path := m.HugepagePath
+		if path == "" {
+			path = defaultHugepagePath
+		}
+		props["mem-path"] = path
+		if shared {
+			props["share"] = true
+		}
+		return "memory-backend-file", props
+	case m.backend() == MemoryBackendMemfd || shared:
+		props["share"] = true
+		return "memory-backend-memfd", props
+	}
+	return "memory-backend-ram", props
+}
+
+// onlineCpus onlines offline vCPUs in the guest. Many guests do this on their own, so
+// failures are only logged.
+func (i *Instance) onlineCpus(ctx context.Context) {
+	agent, agentErr := i.agent(ctx)
+	if agentErr != nil {
+		slog.Debug("Guest agent unavailable, new vCPUs may be offline", "instance", i.Name, "error", agentErr)
+		return
+	}
+	defer agent.Close()
+
+	var vcpus []struct {
+		LogicalId int  `json:"logical-id"`
+		Online    bool `json:"online"`
+	}
+	if execErr := agent.Execute(ctx, "guest-get-vcpus", nil, &vcpus); execErr != nil {
+		slog.Debug("Failed to list guest vCPUs", "instance", i.Name, "error", execErr)
+		return
+	}
+
+	offline := []map[string]interface{}{}
+	for _, vcpu := range vcpus {
+		if !vcpu.Online {
+			offline = append(offline, map[string]interface{}{"logical-id": vcpu.LogicalId, "online": true})
+		}
+	}
+	if len(offline) == 0 {
+		return
+	}
+	if execErr := agent.Execute(ctx, "guest-set-vcpus", map[string]interface{}{"vcpus": offline}, nil); execErr != nil {
+		slog.Warn("Failed to online guest vCPUs", "instance", i.Name, "error", execErr)
+	}
+}
+
+// onlineMemory onlines offline memory blocks in the guest. Failures are only logged.
+func (i *Instance) onlineMemory(ctx context.Context) {
+	agent, agentErr := i.agent(ctx)
+	if agentErr != nil {
+		slog.Debug("Guest agent unavailable, new memory may be offline", "instance", i.Name, "error", agentErr)
+		return
+	}
+	defer agent.Close()
+
+	var blocks []struct {
+		PhysIndex uint64 `json:"phys-index"`
+		Online    bool   `json:"online"`
+	}
+	if execErr := agent.Execute(ctx, "guest-get-memory-blocks", nil, &blocks); execErr != nil {
+		slog.Debug("Failed to list guest memory blocks", "instance", i.Name, "error", execErr)
+		return
+	}
+
+	offline := []map[string]interface{}{}
+	for _, block := range blocks {
+		if !block.Online {
+			offline = append(offline, map[string]interface{}{"phys-index": block.PhysIndex, "online": true})
+		}
+	}
+	if len(offline) == 0 {
+		return
+	}
+	if execErr := agent.Execute(ctx, "guest-set-memory-blocks", map[string]interface{}{"mem-blks": offline}, nil); execErr != nil {
+		slog.Warn("Failed to online guest memory", "instance", i.Name, "error", execErr)
+	}
+}
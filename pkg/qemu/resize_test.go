@@ -0,0 +1,193 @@
+package qemu
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCpuDeviceId(t *testing.T) {
+	assert.Equal(t, "cpu-s1-c2-t0", cpuDeviceId(map[string]interface{}{"socket-id": 1, "core-id": 2, "thread-id": 0}))
+}
+
+func TestMemoryHotplugObject(t *testing.T) {
+	qomType, props := (&MemoryConfig{}).hotplugObject(1<<30, false)
+	assert.Equal(t, "memory-backend-ram", qomType)
+	assert.Equal(t, map[string]interface{}{"size": uint64(1 << 30)}, props)
+
+	qomType, props = (&MemoryConfig{}).hotplugObject(1<<30, true)
+	assert.Equal(t, "memory-backend-memfd", qomType, "virtiofs needs shared memory")
+	assert.Equal(t, true, props["share"])
+
+	qomType, props = (&MemoryConfig{Backend: MemoryBackendHugepages, Prealloc: true}).hotplugObject(1<<30, false)
+	assert.Equal(t, "memory-backend-file", qomType)
+	assert.Equal(t, map[string]interface{}{"size": uint64(1 << 30), "mem-path": "/dev/hugepages", "prealloc": true}, props)
+}
+
+func TestNextDimmId(t *testing.T) {
+	device := func(deviceType, id string) memoryDevice {
+		d := memoryDevice{Type: deviceType}
+		d.Data.Id = id
+		return d
+	}
+
+	assert.Equal(t, "dimm0", nextDimmId(nil))
+	assert.Equal(t, "dimm0", nextDimmId([]memoryDevice{device("virtio-mem", "vmem0")}), "other memory devices take no dimm id")
+	assert.Equal(t, "dimm1", nextDimmId([]memoryDevice{device("dimm", "dimm0"), device("dimm", "dimm2")}), "ids of unplugged dimms are reused")
+	assert.Equal(t, "dimm2", nextDimmId([]memoryDevice{device("dimm", "dimm0"), device("dimm", ""), device("dimm", "dimm1")}))
+}
+
+// fakeCpuSlots answers query-hotpluggable-cpus with four single-thread cores, the first
+// two of which were present at boot, and emits DEVICE_DELETED when a CPU is unplugged.
+// Plugging failCore fails.
+func fakeCpuSlots(t *testing.T, failCore int) (*Instance, *fakeMonitor) {
+	var monitor *fakeMonitor
+	var mu sync.Mutex
+	plugged := map[int]string{0: "/machine/unattached/device[0]", 1: "/machine/unattached/device[1]"}
+
+	instance, monitor := newFakeMonitor(t, func(cmd map[string]interface{}) []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch cmd["execute"] {
+		case "query-hotpluggable-cpus":
+			cpus := []hotpluggableCpu{}
+			for core := 0; core < 4; core++ {
+				cpus = append(cpus, hotpluggableCpu{
+					Type:       "host-x86_64-cpu",
+					VcpusCount: 1,
+					Props:      map[string]interface{}{"socket-id": 0, "core-id": core, "thread-id": 0},
+					QomPath:    plugged[core],
+				})
+			}
+			result, _ := json.Marshal(map[string]interface{}{"return": cpus})
+			return []string{string(result)}
+		case "device_add":
+			arguments := cmd["arguments"].(map[string]interface{})
+			if int(arguments["core-id"].(float64)) == failCore {
+				return []string{`{"error": {"class": "GenericError", "desc": "CPU hotplug failed"}}`}
+			}
+			plugged[int(arguments["core-id"].(float64))] = "/machine/peripheral/" + arguments["id"].(string)
+		case "device_del":
+			id := cmd["arguments"].(map[string]interface{})["id"].(string)
+			for core, path := range plugged {
+				if path == "/machine/peripheral/"+id {
+					delete(plugged, core)
+				}
+			}
+			monitor.events <- `{"event": "DEVICE_DELETED", "data": {"device": "` + id + `"}, "timestamp": {"seconds": 1, "microseconds": 0}}`
+		}
+		return nil
+	})
+	require.NoError(t, WriteManifest(instance.Dir, Config{Cpus: 2}))
+	return instance, monitor
+}
+
+func TestInstance_SetCpus(t *testing.T) {
+	instance, monitor := fakeCpuSlots(t, -1)
+	ctx := testContext(t)
+
+	require.NoError(t, instance.SetCpus(ctx, 4))
+	assert.Equal(t, []string{"query-hotpluggable-cpus", "device_add", "device_add"}, monitor.executed())
+	assert.Equal(t, map[string]interface{}{
+		"driver": "host-x86_64-cpu", "id": "cpu-s0-c3-t0", "socket-id": float64(0), "core-id": float64(3), "thread-id": float64(0),
+	}, monitor.arguments("device_add"))
+	manifest, err := ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4), manifest.Cpus)
+
+	require.NoError(t, instance.SetCpus(ctx, 3))
+	assert.Equal(t, map[string]interface{}{"id": "cpu-s0-c3-t0"}, monitor.arguments("device_del"))
+	manifest, err = ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), manifest.Cpus)
+
+	executed := len(monitor.executed())
+	assert.ErrorContains(t, instance.SetCpus(ctx, 5), "raise Cpu.MaxCpus")
+	assert.ErrorContains(t, instance.SetCpus(ctx, 1), "only CPUs plugged at runtime can be unplugged")
+	assert.ErrorContains(t, instance.SetCpus(ctx, 0), "invalid vCPU count")
+	assert.Equal(t, []string{"query-hotpluggable-cpus", "query-hotpluggable-cpus"}, monitor.executed()[executed:], "invalid counts must not change the guest")
+	manifest, err = ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), manifest.Cpus)
+}
+
+func TestInstance_SetCpus_PartialFailure(t *testing.T) {
+	instance, monitor := fakeCpuSlots(t, 3)
+
+	assert.ErrorContains(t, instance.SetCpus(testContext(t), 4), "CPU hotplug failed")
+	assert.Equal(t, []string{"query-hotpluggable-cpus", "device_add", "device_add"}, monitor.executed())
+	manifest, err := ReadManifest(instance.Dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), manifest.Cpus, "the vCPU plugged before the failure is recorded")
+}
+
+func TestInstance_AddMemory(t *testing.T) {
+	t.Run("dimm", func(t *testing.T) {
+		instance, monitor := newFakeMonitor(t, func(cmd map[string]interface{}) []string {
+			if cmd["execute"] == "query-memory-devices" {
+				return []string{`{"return": [{"type": "dimm", "data": {"id": "dimm0", "memdev": "/objects/dimm0-mem"}}, {"type": "dimm", "data": {"id": "dimm2", "memdev": "/objects/dimm2-mem"}}]}`}
+			}
+			return nil
+		})
+		require.NoError(t, WriteManifest(instance.Dir, Config{
+			Memory:        2048,
+			MemoryOptions: MemoryConfig{Hotplug: MemoryHotplugDimm, MaxMemory: 4096},
+		}))
+
+		require.NoError(t, instance.AddMemory(testContext(t), 1024))
+		assert.Equal(t, []string{"query-memory-devices", "object-add", "device_add"}, monitor.executed())
+		assert.Equal(t, map[string]interface{}{"qom-type": "memory-backend-ram", "id": "dimm1-mem", "size": float64(1 << 30)}, monitor.arguments("object-add"))
+		assert.Equal(t, map[string]interface{}{"driver": "pc-dimm", "id": "dimm1", "memdev": "dimm1-mem"}, monitor.arguments("device_add"))
+
+		manifest, err := ReadManifest(instance.Dir)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(3072), manifest.Memory)
+
+		assert.ErrorContains(t, instance.AddMemory(testContext(t), 2048), "the maximum is 4096 MB")
+	})
+
+	t.Run("dimm plug failure", func(t *testing.T) {
+		instance, monitor := newFakeMonitor(t, func(cmd map[string]interface{}) []string {
+			switch cmd["execute"] {
+			case "query-memory-devices":
+				return []string{`{"return": []}`}
+			case "device_add":
+				return []string{`{"error": {"class": "GenericError", "desc": "a used vhost backend has no free memory slots left"}}`}
+			}
+			return nil
+		})
+		require.NoError(t, WriteManifest(instance.Dir, Config{Memory: 2048, MemoryOptions: MemoryConfig{Hotplug: MemoryHotplugDimm}}))
+
+		assert.ErrorContains(t, instance.AddMemory(testContext(t), 1024), "no free memory slots")
+		assert.Equal(t, []string{"query-memory-devices", "object-add", "device_add", "object-del"}, monitor.executed())
+		manifest, err := ReadManifest(instance.Dir)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2048), manifest.Memory)
+	})
+
+	t.Run("virtio-mem", func(t *testing.T) {
+		instance, monitor := newFakeMonitor(t, func(cmd map[string]interface{}) []string {
+			if cmd["execute"] == "qom-get" {
+				return []string{`{"return": 1073741824}`}
+			}
+			return nil
+		})
+		require.NoError(t, WriteManifest(instance.Dir, Config{Memory: 2048, MemoryOptions: MemoryConfig{Hotplug: MemoryHotplugVirtio}}))
+
+		require.NoError(t, instance.AddMemory(testContext(t), 512))
+		assert.Equal(t, map[string]interface{}{
+			"path": "/machine/peripheral/vmem0", "property": "requested-size", "value": float64(1<<30 + 512<<20),
+		}, monitor.arguments("qom-set"))
+	})
+
+	t.Run("not hotpluggable", func(t *testing.T) {
+		instance, _ := newFakeMonitor(t, nil)
+		require.NoError(t, WriteManifest(instance.Dir, Config{Memory: 2048}))
+
+		assert.ErrorContains(t, instance.AddMemory(testContext(t), 1024), "not started with memory hotplug")
+	})
+}
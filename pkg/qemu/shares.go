@@ -0,0 +1,268 @@
+package qemu
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type ShareType string
+
+const (
+	ShareVirtiofs ShareType = "virtiofs" // fast, requires virtiofsd and shared guest memory (Linux only)
+	Share9p       ShareType = "9p"       // slower, but built into QEMU on every host
+)
+
+const (
+	virtiofsdWaitTimeout = 5 * time.Second
+	shareTagMaxLength    = 36 // virtiofs limit; 9p tags are limited further by the guest
+)
+
+// ShareExit reports a virtiofsd daemon that exited. The guest loses access to the share
+// until the instance is restarted. Daemons also exit once QEMU does.
+type ShareExit struct {
+	Tag string
+	Err error // nil when the daemon exited cleanly
+}
+
+var shareTagPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// virtiofsdPaths lists the locations distributions install virtiofsd to besides PATH.
+var virtiofsdPaths = []string{
+	"/usr/libexec/virtiofsd",
+	"/usr/lib/qemu/virtiofsd",
+	"/usr/lib/virtiofsd",
+}
+
+// Share exports a host directory to the guest.
+type Share struct {
+	Type          ShareType // defaults to ShareVirtiofs
+	Source        string    // host directory
+	Tag           string    // mount tag seen by the guest
+	MountPoint    string    // guest mount point added to cloud-init; defaults to /mnt/<tag>
+	ReadOnly      bool
+	SecurityModel string // 9p only: "mapped-xattr" (default), "mapped-file", "passthrough" or "none"
+}
+
+func (s Share) shareType() ShareType {
+	if s.Type == "" {
+		return ShareVirtiofs
+	}
+	return s.Type
+}
+
+func (s Share) mountPoint() string {
+	if s.MountPoint == "" {
+		return "/mnt/" + s.Tag
+	}
+	return s.MountPoint
+}
+
+func VirtiofsSocketPath(dir, tag string) string {
+	return filepath.Join(dir, fmt.Sprintf("virtiofs-%s.sock", tag))
+}
+
+func validateShares(shares []Share) error {
+	tags := map[string]bool{}
+	for _, share := range shares {
+		if share.Tag == "" || len(share.Tag) > shareTagMaxLength {
+			return fmt.Errorf("share %s: tag must be 1 to %d characters", share.Source, shareTagMaxLength)
+		}
+		// Tags end up in QEMU option strings and socket file names.
+		if !shareTagPattern.MatchString(share.Tag) || strings.Contains(share.Tag, "..") {
+			return fmt.Errorf("share %s: tag %q may only contain letters, digits, '.', '_' and '-'", share.Source, share.Tag)
+		}
+		if tags[share.Tag] {
+			return fmt.Errorf("share %s: duplicate tag %q", share.Source, share.Tag)
+		}
+		tags[share.Tag] = true
+
+		info, statErr := os.Stat(share.Source)
+		if statErr != nil {
+			return fmt.Errorf("share %s: %w", share.Tag, statErr)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("share %s: %s is not a directory", share.Tag, share.Source)
+		}
+
+		switch share.shareType() {
+		case ShareVirtiofs:
+			if share.SecurityModel != "" {
+				return fmt.Errorf("share %s: security model is only supported by 9p", share.Tag)
+			}
+		case Share9p:
+		default:
+			return fmt.Errorf("share %s: unknown share type %q", share.Tag, share.Type)
+		}
+	}
+	return nil
+}
+
+func hasVirtiofsShare(shares []Share) bool {
+	for _, share := range shares {
+		if share.shareType() == ShareVirtiofs {
+			return true
+		}
+	}
+	return false
+}
+
+func buildShareArgs(dir string, shares []Share) []string {
+	args := []string{}
+	for _, share := range shares {
+		switch share.shareType() {
+		case ShareVirtiofs:
+			args = append(args, "-chardev", fmt.Sprintf("socket,id=virtiofs-%s,path=%s", share.Tag, VirtiofsSocketPath(dir, share.Tag)))
+			args = append(args, "-device", fmt.Sprintf("vhost-user-fs-pci,chardev=virtiofs-%s,tag=%s", share.Tag, share.Tag))
+		case Share9p:
+			securityModel := share.SecurityModel
+			if securityModel == "" {
+				securityModel = "mapped-xattr"
+			}
+			fsdev := fmt.Sprintf("local,id=fsdev-%s,path=%s,security_model=%s", share.Tag, share.Source, securityModel)
+			if share.ReadOnly {
+				fsdev += ",readonly=on"
+			}
+			args = append(args, "-fsdev", fsdev)
+			args = append(args, "-device", fmt.Sprintf("virtio-9p-pci,fsdev=fsdev-%s,mount_tag=%s", share.Tag, share.Tag))
+		}
+	}
+	return args
+}
+
+// shareMounts returns the cloud-init mount entries that mount every share on boot.
+func shareMounts(shares []Share) [][]string {
+	mounts := [][]string{}
+	for _, share := range shares {
+		options := "defaults,nofail"
+		if share.shareType() == Share9p {
+			options = "trans=virtio,version=9p2000.L,nofail"
+		}
+		if share.ReadOnly {
+			options += ",ro"
+		}
+		mounts = append(mounts, []string{share.Tag, share.mountPoint(), string(share.shareType()), options, "0", "0"})
+	}
+	return mounts
+}
+
+func findVirtiofsd() (string, error) {
+	if path, lookErr := exec.LookPath("virtiofsd"); lookErr == nil {
+		return path, nil
+	}
+	for _, path := range virtiofsdPaths {
+		if _, statErr := os.Stat(path); statErr == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("virtiofsd is not available; please install virtiofsd")
+}
+
+// startVirtiofsd launches one virtiofsd per virtiofs share and waits for their sockets.
+// Each daemon exits once QEMU disconnects from it, which is reported on exits; it must
+// have room for one report per share. On failure, the daemons already started are killed.
+func startVirtiofsd(dir string, shares []Share, exits chan<- ShareExit) ([]*os.Process, error) {
+	processes := []*os.Process{}
+	if !hasVirtiofsShare(shares) {
+		return processes, nil
+	}
+
+	binary, binaryErr := findVirtiofsd()
+	if binaryErr != nil {
+		return nil, binaryErr
+	}
+
+	for _, share := range shares {
+		if share.shareType() != ShareVirtiofs {
+			continue
+		}
+
+		process, startErr := startVirtiofsdForShare(binary, dir, share, exits)
+		if startErr != nil {
+			killProcesses(processes)
+			return nil, startErr
+		}
+		processes = append(processes, process)
+	}
+
+	return processes, nil
+}
+
+func startVirtiofsdForShare(binary, dir string, share Share, exits chan<- ShareExit) (*os.Process, error) {
+	socketPath := VirtiofsSocketPath(dir, share.Tag)
+	os.Remove(socketPath)
+
+	args := []string{
+		"--socket-path", socketPath,
+		"--shared-dir", share.Source,
+		"--cache", "auto",
+	}
+	if share.ReadOnly {
+		args = append(args, "--readonly")
+	}
+	// Without root, virtiofsd cannot set up its namespace sandbox.
+	if os.Geteuid() != 0 {
+		args = append(args, "--sandbox", "none")
+	}
+
+	logFile, logFileErr := os.OpenFile(filepath.Join(dir, fmt.Sprintf("virtiofsd-%s.log", share.Tag)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if logFileErr != nil {
+		return nil, logFileErr
+	}
+	defer logFile.Close()
+
+	command := exec.Command(binary, args...)
+	command.Stdout = logFile
+	command.Stderr = logFile
+	// Detach from parent process, like QEMU itself
+	command.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+
+	if startErr := command.Start(); startErr != nil {
+		return nil, fmt.Errorf("failed to execute virtiofsd: %w", startErr)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- command.Wait()
+	}()
+
+	deadline := time.Now().Add(virtiofsdWaitTimeout)
+	for {
+		if _, statErr := os.Stat(socketPath); statErr == nil {
+			slog.Debug("virtiofsd started", "share", share.Tag, "pid", command.Process.Pid)
+			go func() {
+				waitErr := <-exited
+				if waitErr != nil {
+					slog.Warn("virtiofsd exited", "share", share.Tag, "error", waitErr)
+				}
+				exits <- ShareExit{Tag: share.Tag, Err: waitErr}
+			}()
+			return command.Process, nil
+		}
+
+		select {
+		case waitErr := <-exited:
+			return nil, fmt.Errorf("virtiofsd for share %s exited: %v", share.Tag, waitErr)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			command.Process.Kill()
+			return nil, fmt.Errorf("virtiofsd did not create %s in time", socketPath)
+		}
+	}
+}
+
+func killProcesses(processes []*os.Process) {
+	for _, process := range processes {
+		process.Kill()
+	}
+}
@@ -0,0 +1,111 @@
+package qemu
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildShareArgs(t *testing.T) {
+	shares := []Share{
+		{Source: "/srv/data", Tag: "data"},
+		{Type: Share9p, Source: "/srv/src", Tag: "src", ReadOnly: true},
+	}
+
+	assert.Equal(t, []string{
+		"-chardev", "socket,id=virtiofs-data,path=/vm/virtiofs-data.sock",
+		"-device", "vhost-user-fs-pci,chardev=virtiofs-data,tag=data",
+		"-fsdev", "local,id=fsdev-src,path=/srv/src,security_model=mapped-xattr,readonly=on",
+		"-device", "virtio-9p-pci,fsdev=fsdev-src,mount_tag=src",
+	}, buildShareArgs("/vm", shares))
+
+	assert.Equal(t, [][]string{
+		{"data", "/mnt/data", "virtiofs", "defaults,nofail", "0", "0"},
+		{"src", "/mnt/src", "9p", "trans=virtio,version=9p2000.L,nofail,ro", "0", "0"},
+	}, shareMounts(shares))
+}
+
+func TestValidateShares(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, validateShares([]Share{{Source: dir, Tag: "a"}, {Type: Share9p, Source: dir, Tag: "b", SecurityModel: "none"}}))
+	assert.Error(t, validateShares([]Share{{Source: dir}}), "missing tag")
+	assert.Error(t, validateShares([]Share{{Source: dir, Tag: "a"}, {Source: dir, Tag: "a"}}), "duplicate tag")
+	assert.Error(t, validateShares([]Share{{Source: dir + "/missing", Tag: "a"}}), "missing source")
+	assert.Error(t, validateShares([]Share{{Source: dir, Tag: "a", SecurityModel: "none"}}), "security model with virtiofs")
+}
+
+func TestValidateShares_Tag(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		tag   string
+		valid bool
+	}{
+		{tag: "data", valid: true},
+		{tag: "my-share_1.0", valid: true},
+		{tag: "data,addr=0x10"},
+		{tag: "data=1"},
+		{tag: "../data"},
+		{tag: "a/b"},
+		{tag: ".."},
+		{tag: "a..b"},
+		{tag: "data share"},
+		{tag: strings.Repeat("a", shareTagMaxLength), valid: true},
+		{tag: strings.Repeat("a", shareTagMaxLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			err := validateShares([]Share{{Source: dir, Tag: tt.tag}})
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestStartVirtiofsd_ReportsExit(t *testing.T) {
+	// A fake virtiofsd creating its socket, then exiting with a status chosen by share tag.
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "virtiofsd"), []byte(`#!/bin/sh
+while [ "$1" != "--socket-path" ]; do shift; done
+touch "$2"
+sleep 0.5
+case "$2" in *crash*) exit 3 ;; esac
+`), 0755))
+	t.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	shares := []Share{
+		{Source: t.TempDir(), Tag: "data"},
+		{Type: Share9p, Source: t.TempDir(), Tag: "src"},
+		{Source: t.TempDir(), Tag: "crash"},
+	}
+	exits := make(chan ShareExit, len(shares))
+	processes, err := startVirtiofsd(t.TempDir(), shares, exits)
+	require.NoError(t, err)
+	assert.Len(t, processes, 2)
+
+	reported := map[string]error{}
+	for range processes {
+		select {
+		case exit := <-exits:
+			reported[exit.Tag] = exit.Err
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "virtiofsd exit not reported")
+		}
+	}
+	require.Contains(t, reported, "data")
+	assert.NoError(t, reported["data"])
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, reported["crash"], &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode())
+}
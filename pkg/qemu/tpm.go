@@ -0,0 +1,99 @@
+package qemu
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+const (
+	swtpmBinary      = "swtpm"
+	swtpmWaitTimeout = 5 * time.Second
+)
+
+// TpmConfig adds a software TPM 2.0 backed by an swtpm process per instance.
+type TpmConfig struct {
+	Model string // "tpm-tis", "tpm-crb", "tpm-tis-device" or "tpm-spapr"; defaults by architecture
+}
+
+func TpmStatePath(dir string) string {
+	return filepath.Join(dir, "tpm")
+}
+
+func TpmSocketPath(dir string) string {
+	return filepath.Join(dir, "swtpm.sock")
+}
+
+func (t *TpmConfig) model(arch utils.Arch) (string, error) {
+	if t.Model != "" {
+		return t.Model, nil
+	}
+	switch arch {
+	case utils.ArchX86_64:
+		return "tpm-crb", nil
+	case utils.ArchAarch64:
+		return "tpm-tis-device", nil
+	case utils.ArchPpc64le:
+		return "tpm-spapr", nil
+	}
+	return "", fmt.Errorf("tpm: no TPM device available for %s", arch)
+}
+
+func buildTpmArgs(dir string, model string) []string {
+	return []string{
+		"-chardev", fmt.Sprintf("socket,id=chrtpm,path=%s", TpmSocketPath(dir)),
+		"-tpmdev", "emulator,id=tpm0,chardev=chrtpm",
+		"-device", fmt.Sprintf("%s,tpmdev=tpm0", model),
+	}
+}
+
+// startSwtpm launches swtpm for the instance and waits for its control socket. The TPM
+// state persists in TpmStatePath(dir); swtpm terminates once QEMU disconnects from it.
+func startSwtpm(dir string) (*os.Process, error) {
+	if _, err := exec.LookPath(swtpmBinary); err != nil {
+		return nil, fmt.Errorf("%s is not available; please install %s", swtpmBinary, swtpmBinary)
+	}
+
+	if mkdirErr := os.MkdirAll(TpmStatePath(dir), 0700); mkdirErr != nil {
+		return nil, mkdirErr
+	}
+
+	socketPath := TpmSocketPath(dir)
+	os.Remove(socketPath)
+
+	command := exec.Command(swtpmBinary, "socket",
+		"--tpm2",
+		"--tpmstate", fmt.Sprintf("dir=%s", TpmStatePath(dir)),
+		"--ctrl", fmt.Sprintf("type=unixio,path=%s", socketPath),
+		"--log", fmt.Sprintf("file=%s", filepath.Join(dir, "swtpm.log")),
+		"--terminate",
+	)
+	// Detach from parent process, like QEMU itself
+	command.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+
+	if startErr := command.Start(); startErr != nil {
+		return nil, fmt.Errorf("failed to execute swtpm: %w", startErr)
+	}
+	go command.Wait()
+
+	deadline := time.Now().Add(swtpmWaitTimeout)
+	for {
+		if _, statErr := os.Stat(socketPath); statErr == nil {
+			slog.Debug("swtpm started", "pid", command.Process.Pid)
+			return command.Process, nil
+		}
+		if time.Now().After(deadline) {
+			command.Process.Kill()
+			return nil, fmt.Errorf("swtpm did not create %s in time", socketPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,61 @@
+package qemu
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTpmConfig_Model(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   TpmConfig
+		arch     utils.Arch
+		expected string
+		err      bool
+	}{
+		{name: "x86_64", arch: utils.ArchX86_64, expected: "tpm-crb"},
+		{name: "aarch64", arch: utils.ArchAarch64, expected: "tpm-tis-device"},
+		{name: "ppc64le", arch: utils.ArchPpc64le, expected: "tpm-spapr"},
+		{name: "riscv64", arch: utils.ArchRiscv64, err: true},
+		{name: "s390x", arch: utils.ArchS390x, err: true},
+		{name: "explicit", config: TpmConfig{Model: "tpm-tis"}, arch: utils.ArchX86_64, expected: "tpm-tis"},
+		{name: "explicit on arch without default", config: TpmConfig{Model: "tpm-tis-device"}, arch: utils.ArchRiscv64, expected: "tpm-tis-device"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := tt.config.model(tt.arch)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, model)
+		})
+	}
+}
+
+func TestBuildTpmArgs(t *testing.T) {
+	tests := []struct {
+		model  string
+		device string
+	}{
+		{model: "tpm-crb", device: "tpm-crb,tpmdev=tpm0"},
+		{model: "tpm-tis-device", device: "tpm-tis-device,tpmdev=tpm0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			dir := t.TempDir()
+			assert.Equal(t, []string{
+				"-chardev", "socket,id=chrtpm,path=" + filepath.Join(dir, "swtpm.sock"),
+				"-tpmdev", "emulator,id=tpm0,chardev=chrtpm",
+				"-device", tt.device,
+			}, buildTpmArgs(dir, tt.model))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package qemu
+
+import (
+	"fmt"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+)
+
+// VsockConfig adds a virtio-vsock device for host-guest communication without networking.
+type VsockConfig struct {
+	CID   uint32 // guest context ID; 0 allocates a unique CID from Store
+	Store string // CID allocation file; defaults to utils.DefaultCIDStorePath
+}
+
+// VsockAddr is the address of a vsock endpoint.
+type VsockAddr struct {
+	CID  uint32
+	Port uint32
+}
+
+func (a VsockAddr) Network() string {
+	return "vsock"
+}
+
+func (a VsockAddr) String() string {
+	return fmt.Sprintf("%d:%d", a.CID, a.Port)
+}
+
+// allocate returns the configuration with the CID allocated or reserved for the instance.
+func (v *VsockConfig) allocate(instanceID string) (*VsockConfig, error) {
+	allocator, allocatorErr := v.allocator()
+	if allocatorErr != nil {
+		return nil, allocatorErr
+	}
+
+	allocated := *v
+	if allocated.CID == 0 {
+		cid, allocateErr := allocator.Allocate(instanceID)
+		if allocateErr != nil {
+			return nil, allocateErr
+		}
+		allocated.CID = cid
+	} else if reserveErr := allocator.Reserve(instanceID, allocated.CID); reserveErr != nil {
+		return nil, reserveErr
+	}
+
+	return &allocated, nil
+}
+
+func (v *VsockConfig) allocator() (*utils.CIDAllocator, error) {
+	store := v.Store
+	if store == "" {
+		defaultStore, storeErr := utils.DefaultCIDStorePath()
+		if storeErr != nil {
+			return nil, storeErr
+		}
+		store = defaultStore
+	}
+	return utils.NewCIDAllocator(store)
+}
+
+func buildVsockArgs(cid uint32, arch utils.Arch) ([]string, error) {
+	if cid < utils.MinGuestCID || cid > utils.MaxGuestCID {
+		return nil, fmt.Errorf("vsock: invalid guest CID %d", cid)
+	}
+	if supportedErr := vsockSupported(); supportedErr != nil {
+		return nil, supportedErr
+	}
+
+	device := "vhost-vsock-pci"
+	if arch == utils.ArchS390x {
+		device = "vhost-vsock-ccw"
+	}
+	return []string{"-device", fmt.Sprintf("%s,id=vsock0,guest-cid=%d", device, cid)}, nil
+}
@@ -0,0 +1,23 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+var errVsockUnsupported = fmt.Errorf("vsock is not supported on darwin")
+
+func vsockSupported() error {
+	return errVsockUnsupported
+}
+
+// DialVsock connects to a port of the guest over vsock.
+func (i *Instance) DialVsock(ctx context.Context, port uint32) (net.Conn, error) {
+	return nil, errVsockUnsupported
+}
+
+// ListenVsock accepts connections from guests to a port of the host.
+func ListenVsock(port uint32) (net.Listener, error) {
+	return nil, errVsockUnsupported
+}
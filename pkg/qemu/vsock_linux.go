@@ -0,0 +1,238 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The syscall package has no vsock support, so sockets are driven with raw syscalls.
+const (
+	afVsock      = 40
+	vmaddrCidAny = 0xffffffff
+)
+
+// rawSockaddrVM is struct sockaddr_vm from <linux/vm_sockets.h>.
+type rawSockaddrVM struct {
+	Family    uint16
+	Reserved1 uint16
+	Port      uint32
+	Cid       uint32
+	Flags     uint8
+	Zero      [3]uint8
+}
+
+func vsockSupported() error {
+	if _, statErr := os.Stat("/dev/vhost-vsock"); statErr != nil {
+		return fmt.Errorf("vsock: /dev/vhost-vsock is unavailable (is the vhost_vsock module loaded?): %w", statErr)
+	}
+	return nil
+}
+
+// DialVsock connects to a port of the guest over vsock.
+func (i *Instance) DialVsock(ctx context.Context, port uint32) (net.Conn, error) {
+	if i.Cid == 0 {
+		return nil, fmt.Errorf("instance %s has no vsock device", i.Name)
+	}
+
+	file, socketErr := vsockSocket()
+	if socketErr != nil {
+		return nil, socketErr
+	}
+
+	rawConn, rawConnErr := file.SyscallConn()
+	if rawConnErr != nil {
+		file.Close()
+		return nil, rawConnErr
+	}
+
+	remote := rawSockaddrVM{Family: afVsock, Port: port, Cid: i.Cid}
+	var connectErr error
+	if controlErr := rawConn.Control(func(fd uintptr) {
+		connectErr = sockaddrSyscall(syscall.SYS_CONNECT, fd, &remote)
+	}); controlErr != nil {
+		file.Close()
+		return nil, controlErr
+	}
+
+	if errors.Is(connectErr, syscall.EINPROGRESS) {
+		connectErr = waitConnected(ctx, file, rawConn)
+	}
+	if connectErr != nil {
+		file.Close()
+		return nil, fmt.Errorf("vsock: failed to connect to %d:%d: %w", i.Cid, port, connectErr)
+	}
+
+	local := VsockAddr{}
+	rawConn.Control(func(fd uintptr) {
+		var sa rawSockaddrVM
+		if getsocknameErr := getsockname(fd, &sa); getsocknameErr == nil {
+			local = VsockAddr{CID: sa.Cid, Port: sa.Port}
+		}
+	})
+
+	return &vsockConn{File: file, local: local, remote: VsockAddr{CID: i.Cid, Port: port}}, nil
+}
+
+// waitConnected waits for a non-blocking connect to complete.
+func waitConnected(ctx context.Context, file *os.File, rawConn syscall.RawConn) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		file.SetWriteDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		file.SetWriteDeadline(time.Now())
+	})
+	defer func() {
+		stop()
+		file.SetWriteDeadline(time.Time{})
+	}()
+
+	var connectErr error
+	waited := false
+	writeErr := rawConn.Write(func(fd uintptr) bool {
+		// The first call happens before waiting for the socket to become writable.
+		if !waited {
+			waited = true
+			return false
+		}
+		soErr, getsockoptErr := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_ERROR)
+		if getsockoptErr != nil {
+			connectErr = getsockoptErr
+		} else if soErr != 0 {
+			connectErr = syscall.Errno(soErr)
+		}
+		return true
+	})
+	if writeErr != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return writeErr
+	}
+	return connectErr
+}
+
+// ListenVsock accepts connections from guests to a port of the host.
+func ListenVsock(port uint32) (net.Listener, error) {
+	fd, socketErr := syscall.Socket(afVsock, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if socketErr != nil {
+		return nil, fmt.Errorf("vsock: %w", socketErr)
+	}
+
+	local := rawSockaddrVM{Family: afVsock, Port: port, Cid: vmaddrCidAny}
+	if bindErr := sockaddrSyscall(syscall.SYS_BIND, uintptr(fd), &local); bindErr != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("vsock: failed to bind port %d: %w", port, bindErr)
+	}
+	if listenErr := syscall.Listen(fd, syscall.SOMAXCONN); listenErr != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("vsock: %w", listenErr)
+	}
+
+	file := os.NewFile(uintptr(fd), "vsock")
+	rawConn, rawConnErr := file.SyscallConn()
+	if rawConnErr != nil {
+		file.Close()
+		return nil, rawConnErr
+	}
+
+	return &vsockListener{file: file, rawConn: rawConn, addr: VsockAddr{CID: vmaddrCidAny, Port: port}}, nil
+}
+
+type vsockListener struct {
+	file    *os.File
+	rawConn syscall.RawConn
+	addr    VsockAddr
+	closed  atomic.Bool
+}
+
+// Accept waits for the next guest connection. The remote address carries the guest's
+// CID, which identifies the instance.
+func (l *vsockListener) Accept() (net.Conn, error) {
+	var nfd int
+	var remote rawSockaddrVM
+	var acceptErr error
+	readErr := l.rawConn.Read(func(fd uintptr) bool {
+		nfd, acceptErr = accept4(fd, &remote)
+		return !errors.Is(acceptErr, syscall.EAGAIN)
+	})
+	if readErr != nil {
+		if l.closed.Load() {
+			return nil, net.ErrClosed
+		}
+		return nil, readErr
+	}
+	if acceptErr != nil {
+		return nil, fmt.Errorf("vsock: %w", acceptErr)
+	}
+
+	return &vsockConn{
+		File:   os.NewFile(uintptr(nfd), "vsock"),
+		local:  l.addr,
+		remote: VsockAddr{CID: remote.Cid, Port: remote.Port},
+	}, nil
+}
+
+func (l *vsockListener) Close() error {
+	l.closed.Store(true)
+	return l.file.Close()
+}
+
+func (l *vsockListener) Addr() net.Addr {
+	return l.addr
+}
+
+type vsockConn struct {
+	*os.File
+	local  VsockAddr
+	remote VsockAddr
+}
+
+func (c *vsockConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *vsockConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func vsockSocket() (*os.File, error) {
+	fd, socketErr := syscall.Socket(afVsock, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if socketErr != nil {
+		return nil, fmt.Errorf("vsock: %w", socketErr)
+	}
+	// Non-blocking descriptors are registered with the runtime poller.
+	return os.NewFile(uintptr(fd), "vsock"), nil
+}
+
+func sockaddrSyscall(trap uintptr, fd uintptr, sa *rawSockaddrVM) error {
+	_, _, errno := syscall.Syscall(trap, fd, uintptr(unsafe.Pointer(sa)), unsafe.Sizeof(*sa))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func getsockname(fd uintptr, sa *rawSockaddrVM) error {
+	length := uint32(unsafe.Sizeof(*sa))
+	_, _, errno := syscall.Syscall(syscall.SYS_GETSOCKNAME, fd, uintptr(unsafe.Pointer(sa)), uintptr(unsafe.Pointer(&length)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func accept4(fd uintptr, sa *rawSockaddrVM) (int, error) {
+	length := uint32(unsafe.Sizeof(*sa))
+	nfd, _, errno := syscall.Syscall6(syscall.SYS_ACCEPT4, fd, uintptr(unsafe.Pointer(sa)), uintptr(unsafe.Pointer(&length)), syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(nfd), nil
+}
@@ -0,0 +1,29 @@
+package qemu
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/q-controller/qemu-client/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVsockConfigAllocate(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "cids.json")
+
+	first, err := (&VsockConfig{Store: store}).allocate("vm1")
+	require.NoError(t, err)
+	assert.Equal(t, utils.MinGuestCID, first.CID)
+
+	restarted, err := (&VsockConfig{Store: store}).allocate("vm1")
+	require.NoError(t, err)
+	assert.Equal(t, first.CID, restarted.CID, "an instance keeps its CID across restarts")
+
+	_, err = (&VsockConfig{Store: store, CID: first.CID}).allocate("vm2")
+	assert.Error(t, err, "a CID must not be shared by two instances")
+
+	explicit, err := (&VsockConfig{Store: store, CID: 42}).allocate("vm2")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(42), explicit.CID)
+}
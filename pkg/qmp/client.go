@@ -0,0 +1,250 @@
+package qmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// Error is an error returned by QEMU in response to a command.
+type Error struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Class, e.Desc)
+}
+
+type command struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type response struct {
+	Return json.RawMessage `json:"return"`
+	Error  *Error          `json:"error"`
+	Event  string          `json:"event"`
+	Data   json.RawMessage `json:"data"`
+	QMP    json.RawMessage `json:"QMP"`
+}
+
+// maxPendingEvents bounds the events buffered while no one waits for them.
+const maxPendingEvents = 64
+
+// Event is an asynchronous notification sent by QEMU, e.g., DEVICE_DELETED.
+type Event struct {
+	Name string
+	Data json.RawMessage
+}
+
+// Client speaks the JSON protocol shared by the QEMU monitor (QMP) and the
+// QEMU guest agent (QGA). Commands are executed one at a time.
+type Client struct {
+	conn    net.Conn
+	decoder *json.Decoder
+	mu      sync.Mutex
+	events  []Event // received while reading command responses, see WaitEvent
+}
+
+// Dial connects to a QMP socket and negotiates capabilities.
+func Dial(ctx context.Context, path string) (*Client, error) {
+	client, dialErr := dial(ctx, path)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+
+	if greetingErr := client.readGreeting(ctx); greetingErr != nil {
+		client.Close()
+		return nil, greetingErr
+	}
+
+	if capErr := client.Execute(ctx, "qmp_capabilities", nil, nil); capErr != nil {
+		client.Close()
+		return nil, fmt.Errorf("qmp: capabilities negotiation failed: %w", capErr)
+	}
+
+	return client, nil
+}
+
+// DialAgent connects to a guest agent socket. The agent has no greeting, so the
+// stream is synchronised with guest-sync to discard stale responses.
+func DialAgent(ctx context.Context, path string) (*Client, error) {
+	client, dialErr := dial(ctx, path)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+
+	if syncErr := client.sync(ctx); syncErr != nil {
+		client.Close()
+		return nil, fmt.Errorf("qga: %w", syncErr)
+	}
+
+	return client, nil
+}
+
+func dial(ctx context.Context, path string) (*Client, error) {
+	var dialer net.Dialer
+	conn, dialErr := dialer.DialContext(ctx, "unix", path)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+
+	return &Client{
+		conn:    conn,
+		decoder: json.NewDecoder(bufio.NewReader(conn)),
+	}, nil
+}
+
+// Execute runs a command with optional arguments and decodes its return value into result.
+func (c *Client) Execute(ctx context.Context, name string, args interface{}, result interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp, execErr := c.execute(ctx, command{Execute: name, Arguments: args})
+	if execErr != nil {
+		return execErr
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %w", name, resp.Error)
+	}
+	if result == nil || len(resp.Return) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Return, result)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) execute(ctx context.Context, cmd command) (*response, error) {
+	defer c.watch(ctx)()
+
+	data, marshalErr := json.Marshal(cmd)
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	if _, writeErr := c.conn.Write(data); writeErr != nil {
+		return nil, writeErr
+	}
+
+	for {
+		var resp response
+		if decodeErr := c.decoder.Decode(&resp); decodeErr != nil {
+			return nil, decodeErr
+		}
+		if resp.Event != "" {
+			c.buffer(Event{Name: resp.Event, Data: resp.Data})
+			continue
+		}
+		return &resp, nil
+	}
+}
+
+// WaitEvent returns the first event with the given name for which match returns true,
+// including events received since the client connected. A nil match accepts any event.
+func (c *Client) WaitEvent(ctx context.Context, name string, match func(data json.RawMessage) bool) (*Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	matches := func(event Event) bool {
+		return event.Name == name && (match == nil || match(event.Data))
+	}
+
+	for index, event := range c.events {
+		if matches(event) {
+			c.events = append(c.events[:index], c.events[index+1:]...)
+			return &event, nil
+		}
+	}
+
+	defer c.watch(ctx)()
+
+	for {
+		var resp response
+		if decodeErr := c.decoder.Decode(&resp); decodeErr != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("waiting for %s: %w", name, ctx.Err())
+			}
+			return nil, decodeErr
+		}
+		if resp.Event == "" {
+			continue
+		}
+		event := Event{Name: resp.Event, Data: resp.Data}
+		if matches(event) {
+			return &event, nil
+		}
+		c.buffer(event)
+	}
+}
+
+func (c *Client) buffer(event Event) {
+	if len(c.events) == maxPendingEvents {
+		c.events = c.events[1:]
+	}
+	c.events = append(c.events, event)
+}
+
+func (c *Client) readGreeting(ctx context.Context) error {
+	defer c.watch(ctx)()
+
+	var greeting response
+	if decodeErr := c.decoder.Decode(&greeting); decodeErr != nil {
+		return fmt.Errorf("qmp: failed to read greeting: %w", decodeErr)
+	}
+	if greeting.QMP == nil {
+		return fmt.Errorf("qmp: unexpected greeting")
+	}
+	return nil
+}
+
+func (c *Client) sync(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := rand.Int32()
+	defer c.watch(ctx)()
+
+	data, marshalErr := json.Marshal(command{Execute: "guest-sync", Arguments: map[string]int32{"id": id}})
+	if marshalErr != nil {
+		return marshalErr
+	}
+	if _, writeErr := c.conn.Write(data); writeErr != nil {
+		return writeErr
+	}
+
+	// Responses to commands issued by a previous client may still be queued.
+	for {
+		var resp response
+		if decodeErr := c.decoder.Decode(&resp); decodeErr != nil {
+			return fmt.Errorf("guest-sync failed: %w", decodeErr)
+		}
+		var got int32
+		if json.Unmarshal(resp.Return, &got) == nil && got == id {
+			return nil
+		}
+	}
+}
+
+// watch applies the context deadline to the connection and interrupts pending I/O
+// when the context is cancelled. The returned function must be called once I/O is done.
+func (c *Client) watch(ctx context.Context) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Now())
+	})
+	return func() {
+		stop()
+		c.conn.SetDeadline(time.Time{})
+	}
+}
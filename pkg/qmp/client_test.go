@@ -0,0 +1,168 @@
+package qmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMonitor serves a single connection, answering each command with handler.
+func fakeMonitor(t *testing.T, greeting string, handler func(cmd map[string]interface{}) []string) string {
+	path := filepath.Join(t.TempDir(), "qmp.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer conn.Close()
+
+		if greeting != "" {
+			conn.Write([]byte(greeting + "\n"))
+		}
+
+		decoder := json.NewDecoder(bufio.NewReader(conn))
+		for {
+			var cmd map[string]interface{}
+			if decoder.Decode(&cmd) != nil {
+				return
+			}
+			for _, line := range handler(cmd) {
+				conn.Write([]byte(line + "\n"))
+			}
+		}
+	}()
+
+	return path
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestDial_NegotiatesAndExecutes(t *testing.T) {
+	path := fakeMonitor(t, `{"QMP": {"version": {}, "capabilities": []}}`, func(cmd map[string]interface{}) []string {
+		switch cmd["execute"] {
+		case "qmp_capabilities":
+			return []string{`{"return": {}}`}
+		case "query-status":
+			return []string{
+				`{"event": "RESUME", "timestamp": {"seconds": 1, "microseconds": 0}}`,
+				`{"return": {"running": true, "status": "running"}}`,
+			}
+		}
+		return []string{`{"error": {"class": "CommandNotFound", "desc": "unknown"}}`}
+	})
+
+	client, err := Dial(testContext(t), path)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var status struct {
+		Running bool   `json:"running"`
+		Status  string `json:"status"`
+	}
+	require.NoError(t, client.Execute(testContext(t), "query-status", nil, &status))
+	assert.True(t, status.Running)
+	assert.Equal(t, "running", status.Status)
+
+	execErr := client.Execute(testContext(t), "bogus", nil, nil)
+	var qmpErr *Error
+	require.ErrorAs(t, execErr, &qmpErr)
+	assert.Equal(t, "CommandNotFound", qmpErr.Class)
+}
+
+func TestDialAgent_DiscardsStaleResponses(t *testing.T) {
+	path := fakeMonitor(t, "", func(cmd map[string]interface{}) []string {
+		switch cmd["execute"] {
+		case "guest-sync":
+			id := cmd["arguments"].(map[string]interface{})["id"].(float64)
+			stale, _ := json.Marshal(map[string]interface{}{"return": 42})
+			current, _ := json.Marshal(map[string]interface{}{"return": int64(id)})
+			return []string{string(stale), string(current)}
+		case "guest-ping":
+			return []string{`{"return": {}}`}
+		}
+		return nil
+	})
+
+	client, err := DialAgent(testContext(t), path)
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.NoError(t, client.Execute(testContext(t), "guest-ping", nil, nil))
+}
+
+func TestExecute_HonoursContextCancellation(t *testing.T) {
+	path := fakeMonitor(t, `{"QMP": {}}`, func(cmd map[string]interface{}) []string {
+		if cmd["execute"] == "qmp_capabilities" {
+			return []string{`{"return": {}}`}
+		}
+		return nil // never answer
+	})
+
+	client, err := Dial(testContext(t), path)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, client.Execute(ctx, "query-status", nil, nil))
+}
+
+func TestWaitEvent_ReturnsBufferedAndLaterEvents(t *testing.T) {
+	path := fakeMonitor(t, `{"QMP": {"version": {}, "capabilities": []}}`, func(cmd map[string]interface{}) []string {
+		switch cmd["execute"] {
+		case "qmp_capabilities":
+			return []string{`{"return": {}}`}
+		case "device_del":
+			return []string{
+				`{"event": "DEVICE_DELETED", "data": {"path": "/machine/peripheral/disk1/virtio-backend"}}`,
+				`{"return": {}}`,
+				`{"event": "DEVICE_DELETED", "data": {"device": "disk1", "path": "/machine/peripheral/disk1"}}`,
+			}
+		}
+		return []string{`{"error": {"class": "CommandNotFound", "desc": "unknown"}}`}
+	})
+
+	client, err := Dial(testContext(t), path)
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.Execute(testContext(t), "device_del", map[string]string{"id": "disk1"}, nil))
+
+	deviceIs := func(id string) func(json.RawMessage) bool {
+		return func(data json.RawMessage) bool {
+			var deleted struct {
+				Device string `json:"device"`
+			}
+			return json.Unmarshal(data, &deleted) == nil && deleted.Device == id
+		}
+	}
+
+	event, err := client.WaitEvent(testContext(t), "DEVICE_DELETED", deviceIs("disk1"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"device": "disk1", "path": "/machine/peripheral/disk1"}`, string(event.Data))
+
+	// The event without a device ID was buffered while waiting.
+	event, err = client.WaitEvent(testContext(t), "DEVICE_DELETED", nil)
+	require.NoError(t, err)
+	assert.Contains(t, string(event.Data), "virtio-backend")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.WaitEvent(ctx, "DEVICE_DELETED", deviceIs("disk2"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -1,9 +1,16 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
 	"runtime"
+	"strings"
 )
 
+const TCG = "tcg"
+
 func GetAccelerator() string {
 	switch runtime.GOOS {
 	case "darwin":
@@ -13,3 +20,68 @@ func GetAccelerator() string {
 	}
 	return ""
 }
+
+// Accelerator is the result of probing for hardware acceleration.
+type Accelerator struct {
+	Name       string // "kvm", "hvf" or "tcg"
+	Diagnostic string // why hardware acceleration is unavailable; empty when it is used
+}
+
+// Arg returns the value for QEMU's -accel option. TCG runs one host thread per vCPU.
+func (a Accelerator) Arg() string {
+	if a.Name == TCG {
+		return "tcg,thread=multi"
+	}
+	return a.Name
+}
+
+// DetectAccelerator checks whether the host and the given QEMU binary support hardware
+// acceleration, falling back to TCG with a diagnostic explaining why.
+func DetectAccelerator(qemuBinary string) Accelerator {
+	preferred := GetAccelerator()
+	if preferred == "" {
+		return Accelerator{Name: TCG, Diagnostic: fmt.Sprintf("no hardware accelerator is known for %s", runtime.GOOS)}
+	}
+
+	if availableErr := hardwareAccelerationAvailable(); availableErr != nil {
+		return Accelerator{Name: TCG, Diagnostic: fmt.Sprintf("%s unavailable: %v", preferred, availableErr)}
+	}
+
+	supported, queryErr := queryAccelerators(qemuBinary)
+	if queryErr != nil {
+		// Old binaries may not support the query; assume the accelerator is built in.
+		return Accelerator{Name: preferred}
+	}
+	for _, accel := range supported {
+		if accel == preferred {
+			return Accelerator{Name: preferred}
+		}
+	}
+
+	return Accelerator{Name: TCG, Diagnostic: fmt.Sprintf("%s does not support %s (supported: %s)", qemuBinary, preferred, strings.Join(supported, ", "))}
+}
+
+// queryAccelerators lists the accelerators compiled into a QEMU binary.
+func queryAccelerators(qemuBinary string) ([]string, error) {
+	output, outputErr := exec.Command(qemuBinary, "-accel", "help").Output()
+	if outputErr != nil {
+		return nil, fmt.Errorf("%s -accel help failed: %w", qemuBinary, outputErr)
+	}
+	return parseAccelHelp(output), nil
+}
+
+// parseAccelHelp parses output such as "Accelerators supported in QEMU binary:\ntcg\nkvm\n".
+func parseAccelHelp(output []byte) []string {
+	accelerators := []string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		accelerators = append(accelerators, line)
+	}
+
+	return accelerators
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// hardwareAccelerationAvailable checks that Hypervisor.framework is supported.
+func hardwareAccelerationAvailable() error {
+	output, sysctlErr := exec.Command("sysctl", "-n", "kern.hv_support").Output()
+	if sysctlErr != nil {
+		return fmt.Errorf("failed to query kern.hv_support: %w", sysctlErr)
+	}
+	if strings.TrimSpace(string(output)) != "1" {
+		return fmt.Errorf("Hypervisor.framework is not supported on this host")
+	}
+	return nil
+}
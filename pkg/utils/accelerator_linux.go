@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// hardwareAccelerationAvailable checks that /dev/kvm exists and can be opened by the
+// current user, which is commonly not the case in containers and nested CI runners.
+func hardwareAccelerationAvailable() error {
+	file, openErr := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if openErr != nil {
+		if os.IsNotExist(openErr) {
+			return fmt.Errorf("/dev/kvm does not exist; KVM is not enabled on this host")
+		}
+		if os.IsPermission(openErr) {
+			return fmt.Errorf("no permission to open /dev/kvm; add the user to the kvm group")
+		}
+		return openErr
+	}
+	return file.Close()
+}
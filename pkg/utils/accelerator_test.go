@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccelHelp(t *testing.T) {
+	output := []byte("Accelerators supported in QEMU binary:\ntcg\nkvm\n")
+	assert.Equal(t, []string{"tcg", "kvm"}, parseAccelHelp(output))
+}
+
+func TestAccelerator_Arg(t *testing.T) {
+	assert.Equal(t, "kvm", Accelerator{Name: "kvm"}.Arg())
+	assert.Equal(t, "tcg,thread=multi", Accelerator{Name: TCG}.Arg())
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Arch is a guest architecture, named after the QEMU target.
+type Arch string
+
+const (
+	ArchX86_64  Arch = "x86_64"
+	ArchAarch64 Arch = "aarch64"
+	ArchRiscv64 Arch = "riscv64"
+	ArchPpc64le Arch = "ppc64le"
+	ArchS390x   Arch = "s390x"
+)
+
+// HostArch returns the architecture of the host, which guests of the same
+// architecture can run on with hardware acceleration.
+func HostArch() (Arch, error) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return ArchX86_64, nil
+	case "arm64":
+		return ArchAarch64, nil
+	case "riscv64":
+		return ArchRiscv64, nil
+	case "ppc64le":
+		return ArchPpc64le, nil
+	case "s390x":
+		return ArchS390x, nil
+	}
+	return "", fmt.Errorf("unsupported architecture: %s", runtime.GOARCH)
+}
+
+// GetCpuModelForArch returns the CPU model exposing the most features that TCG
+// can emulate for the architecture.
+func GetCpuModelForArch(arch Arch) (string, error) {
+	switch arch {
+	case ArchX86_64, ArchAarch64, ArchS390x:
+		return "max", nil
+	case ArchRiscv64:
+		return "rv64", nil
+	case ArchPpc64le:
+		return "power9", nil
+	}
+	return "", fmt.Errorf("unsupported architecture: %s", arch)
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var allArchs = []Arch{ArchX86_64, ArchAarch64, ArchRiscv64, ArchPpc64le, ArchS390x}
+
+func TestHostArch(t *testing.T) {
+	expected, known := map[string]Arch{"amd64": ArchX86_64, "arm64": ArchAarch64}[runtime.GOARCH]
+	if !known {
+		t.Skipf("no expectation for %s", runtime.GOARCH)
+	}
+	arch, err := HostArch()
+	require.NoError(t, err)
+	assert.Equal(t, expected, arch)
+}
+
+func TestArchHelpers(t *testing.T) {
+	tests := []struct {
+		arch    Arch
+		machine string
+		cpu     string
+		binary  string
+	}{
+		{arch: ArchX86_64, machine: "q35", cpu: "max", binary: "qemu-system-x86_64"},
+		{arch: ArchAarch64, machine: "virt", cpu: "max", binary: "qemu-system-aarch64"},
+		{arch: ArchRiscv64, machine: "virt", cpu: "rv64", binary: "qemu-system-riscv64"},
+		{arch: ArchPpc64le, machine: "pseries", cpu: "power9", binary: "qemu-system-ppc64"},
+		{arch: ArchS390x, machine: "s390-ccw-virtio", cpu: "max", binary: "qemu-system-s390x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.arch), func(t *testing.T) {
+			machine, err := GetMachineTypeForArch(tt.arch)
+			require.NoError(t, err)
+			assert.Equal(t, tt.machine, machine)
+
+			cpu, err := GetCpuModelForArch(tt.arch)
+			require.NoError(t, err)
+			assert.Equal(t, tt.cpu, cpu)
+
+			binary, err := GetQemuBinaryForArch(tt.arch)
+			require.NoError(t, err)
+			assert.Equal(t, tt.binary, binary)
+		})
+	}
+	assert.Len(t, tests, len(allArchs))
+
+	for _, helper := range []func(Arch) (string, error){GetMachineTypeForArch, GetCpuModelForArch, GetQemuBinaryForArch, GetBiosForArch} {
+		_, err := helper("mips")
+		assert.Error(t, err)
+	}
+}
+
+func TestFindQemuBinary(t *testing.T) {
+	dir := t.TempDir()
+	explicit := filepath.Join(dir, "qemu-explicit")
+	fromEnv := filepath.Join(dir, "qemu-env")
+	for _, path := range []string{explicit, fromEnv} {
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0755))
+	}
+	t.Setenv(QemuBinaryEnv, fromEnv)
+	t.Setenv("PATH", dir)
+
+	binary, err := FindQemuBinary(ArchX86_64, explicit)
+	require.NoError(t, err)
+	assert.Equal(t, explicit, binary, "an explicit binary takes precedence")
+
+	binary, err = FindQemuBinary(ArchX86_64, "")
+	require.NoError(t, err)
+	assert.Equal(t, fromEnv, binary)
+
+	t.Setenv(QemuBinaryEnv, "")
+	_, err = FindQemuBinary(ArchX86_64, "")
+	assert.ErrorContains(t, err, "qemu-system-x86_64 is not available")
+}
@@ -2,15 +2,25 @@ package utils
 
 import (
 	"fmt"
-	"runtime"
 )
 
 func GetBios() (string, error) {
-	switch runtime.GOARCH {
-	case "arm64":
+	arch, archErr := HostArch()
+	if archErr != nil {
+		return "", archErr
+	}
+	return GetBiosForArch(arch)
+}
+
+// GetBiosForArch returns the firmware to pass with -bios, or an empty string when the
+// machine's built-in firmware (SeaBIOS, OpenSBI, SLOF, s390-ccw) is used. aarch64 guests
+// only fall back to it when no UEFI firmware descriptor is installed.
+func GetBiosForArch(arch Arch) (string, error) {
+	switch arch {
+	case ArchAarch64:
 		return "edk2-aarch64-code.fd", nil
-	case "amd64":
+	case ArchX86_64, ArchRiscv64, ArchPpc64le, ArchS390x:
 		return "", nil
 	}
-	return "", fmt.Errorf("unsupported architecture: %s", runtime.GOARCH)
+	return "", fmt.Errorf("unsupported architecture: %s", arch)
 }
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Guest CIDs 0 to 2 are reserved (hypervisor, local and host) and 0xffffffff means any.
+const (
+	MinGuestCID uint32 = 3
+	MaxGuestCID uint32 = 0xfffffffe
+)
+
+// CIDAllocator assigns vsock context IDs to instances. Allocations are persisted and
+// shared by all instances using the same store, so no two instances get the same CID.
+type CIDAllocator struct {
+	store *jsonStore[uint32, string] // CID -> instance ID
+}
+
+// DefaultCIDStorePath returns the allocation store shared by all instances of the user.
+func DefaultCIDStorePath() (string, error) {
+	configDir, configDirErr := os.UserConfigDir()
+	if configDirErr != nil {
+		return "", configDirErr
+	}
+	return filepath.Join(configDir, "qemu-client", "vsock-cids.json"), nil
+}
+
+// NewCIDAllocator creates an allocator. When path is set, allocations are loaded from
+// and saved to it.
+func NewCIDAllocator(path string) (*CIDAllocator, error) {
+	store, storeErr := newJSONStore[uint32, string](path)
+	if storeErr != nil {
+		return nil, storeErr
+	}
+	return &CIDAllocator{store: store}, nil
+}
+
+// Allocate returns the CID of an instance, assigning the lowest free CID on first use.
+func (a *CIDAllocator) Allocate(instanceID string) (uint32, error) {
+	var allocated uint32
+	updateErr := a.store.update(func(owners map[uint32]string) (bool, error) {
+		for cid, owner := range owners {
+			if owner == instanceID {
+				allocated = cid
+				return false, nil
+			}
+		}
+
+		for cid := MinGuestCID; cid <= MaxGuestCID; cid++ {
+			if _, taken := owners[cid]; !taken {
+				owners[cid] = instanceID
+				allocated = cid
+				return true, nil
+			}
+		}
+
+		return false, fmt.Errorf("failed to allocate a CID for %s", instanceID)
+	})
+
+	return allocated, updateErr
+}
+
+// Reserve records a user-supplied CID for the instance. It fails if the CID is reserved
+// or already assigned to a different instance.
+func (a *CIDAllocator) Reserve(instanceID string, cid uint32) error {
+	if cid < MinGuestCID || cid > MaxGuestCID {
+		return fmt.Errorf("CID %d is reserved", cid)
+	}
+
+	return a.store.update(func(owners map[uint32]string) (bool, error) {
+		if existing, taken := owners[cid]; taken {
+			if existing != instanceID {
+				return false, fmt.Errorf("CID %d is already assigned to %s", cid, existing)
+			}
+			return false, nil
+		}
+
+		for existingCid, owner := range owners {
+			if owner == instanceID {
+				delete(owners, existingCid)
+			}
+		}
+		owners[cid] = instanceID
+		return true, nil
+	})
+}
+
+// Release frees the CID allocated to the instance.
+func (a *CIDAllocator) Release(instanceID string) error {
+	return a.store.update(func(owners map[uint32]string) (bool, error) {
+		changed := false
+		for cid, owner := range owners {
+			if owner == instanceID {
+				delete(owners, cid)
+				changed = true
+			}
+		}
+		return changed, nil
+	})
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCIDAllocator_PersistsAllocations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cids.json")
+
+	allocator, err := NewCIDAllocator(path)
+	require.NoError(t, err)
+
+	first, err := allocator.Allocate("vm1")
+	require.NoError(t, err)
+	assert.Equal(t, MinGuestCID, first)
+	require.NoError(t, allocator.Reserve("vm2", 4))
+
+	reloaded, err := NewCIDAllocator(path)
+	require.NoError(t, err)
+
+	again, err := reloaded.Allocate("vm1")
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	third, err := reloaded.Allocate("vm3")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), third, "CIDs taken by other instances must be skipped")
+
+	assert.Error(t, reloaded.Reserve("vm3", 4), "a CID owned by another instance must not be reserved twice")
+	assert.Error(t, reloaded.Reserve("vm3", 2), "the host CID is reserved")
+
+	require.NoError(t, reloaded.Release("vm1"))
+	reused, err := reloaded.Allocate("vm4")
+	require.NoError(t, err)
+	assert.Equal(t, first, reused)
+}
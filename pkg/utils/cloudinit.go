@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"log/slog"
+	"mime/multipart"
+	"net/textproto"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,10 +15,15 @@ import (
 
 func CreateCloudInitISO(userData, networkConfig, dir, instanceID string) (string, error) {
 	userDataPath := filepath.Join(dir, "user-data")
-	mergedUserData, mergeErr := mergeCloudConfig(userData)
-	if mergeErr != nil {
-		slog.Error("Failed to merge cloud-init config.Using the original userdata", "error", mergeErr)
-		mergedUserData = userData
+	mergedUserData := userData
+	// The parts of a multipart message are passed on as they are.
+	if !isMultipart(userData) {
+		var mergeErr error
+		mergedUserData, mergeErr = mergeCloudConfig(userData)
+		if mergeErr != nil {
+			slog.Error("Failed to merge cloud-init config.Using the original userdata", "error", mergeErr)
+			mergedUserData = userData
+		}
 	}
 
 	if err := os.WriteFile(userDataPath, []byte(mergedUserData), 0644); err != nil {
@@ -73,3 +81,91 @@ func mergeCloudConfig(userdata string) (string, error) {
 
 	return "#cloud-config\n" + string(out), nil
 }
+
+func isCloudConfig(userdata string) bool {
+	return strings.HasPrefix(strings.TrimSpace(userdata), "#cloud-config")
+}
+
+func isMultipart(userdata string) bool {
+	return strings.HasPrefix(strings.TrimSpace(userdata), "Content-Type: multipart/")
+}
+
+// MergeCloudInitMounts adds entries to the "mounts" list of a cloud-config. Each entry is
+// an fstab line split into fields, e.g., ["share", "/mnt/share", "virtiofs", "nofail"].
+// Entries whose mount point is already listed in the userdata are left untouched.
+// Empty userdata becomes a cloud-config. Userdata without a "#cloud-config" header, such
+// as a shell script, is combined with a cloud-config part listing the mounts into a MIME
+// multipart message.
+func MergeCloudInitMounts(userdata string, mounts [][]string) (string, error) {
+	if len(mounts) == 0 {
+		return userdata, nil
+	}
+	if strings.TrimSpace(userdata) != "" && !isCloudConfig(userdata) {
+		return multipartCloudInitMounts(userdata, mounts)
+	}
+
+	var config map[string]interface{}
+	if err := yaml.Unmarshal([]byte(strings.TrimSpace(userdata)), &config); err != nil {
+		return "", fmt.Errorf("invalid cloud-config provided: %v", err)
+	}
+
+	if config == nil {
+		config = make(map[string]interface{})
+	}
+
+	existing, _ := config["mounts"].([]interface{})
+	mountPoints := map[string]bool{}
+	for _, entry := range existing {
+		if fields, ok := entry.([]interface{}); ok && len(fields) > 1 {
+			mountPoints[fmt.Sprint(fields[1])] = true
+		}
+	}
+
+	for _, mount := range mounts {
+		if len(mount) > 1 && !mountPoints[mount[1]] {
+			existing = append(existing, mount)
+		}
+	}
+	config["mounts"] = existing
+
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return "#cloud-config\n" + string(out), nil
+}
+
+func multipartCloudInitMounts(userdata string, mounts [][]string) (string, error) {
+	out, marshalErr := yaml.Marshal(map[string]interface{}{"mounts": mounts})
+	if marshalErr != nil {
+		return "", marshalErr
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	// cloud-init detects the type of text/plain parts from their first line, e.g., "#!".
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain", userdata},
+		{"text/cloud-config", "#cloud-config\n" + string(out)},
+	} {
+		partWriter, partErr := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {part.contentType + `; charset="utf-8"`},
+		})
+		if partErr != nil {
+			return "", partErr
+		}
+		if _, writeErr := partWriter.Write([]byte(part.content)); writeErr != nil {
+			return "", writeErr
+		}
+	}
+	if closeErr := writer.Close(); closeErr != nil {
+		return "", closeErr
+	}
+
+	header := fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\nMIME-Version: 1.0\n\n", writer.Boundary())
+	return header + body.String(), nil
+}
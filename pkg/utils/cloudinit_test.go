@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
 	"strings"
 	"testing"
 
@@ -188,3 +192,69 @@ resize_rootfs: false`
 	require.True(t, ok, "growpart should be a map")
 	assert.Equal(t, "auto", growpart["mode"])
 }
+
+func TestMergeCloudInitMounts(t *testing.T) {
+	userdata := `#cloud-config
+mounts:
+  - [data, /mnt/data, virtiofs, "defaults,nofail"]`
+
+	result, err := MergeCloudInitMounts(userdata, [][]string{
+		{"other", "/mnt/data", "virtiofs", "defaults,nofail"},
+		{"src", "/mnt/src", "9p", "trans=virtio,version=9p2000.L,nofail"},
+	})
+	require.NoError(t, err)
+
+	config := parseCloudConfig(t, result)
+	mounts, ok := config["mounts"].([]interface{})
+	require.True(t, ok, "mounts should be an array")
+	require.Len(t, mounts, 2)
+	assert.Equal(t, []interface{}{"data", "/mnt/data", "virtiofs", "defaults,nofail"}, mounts[0])
+	assert.Equal(t, []interface{}{"src", "/mnt/src", "9p", "trans=virtio,version=9p2000.L,nofail"}, mounts[1])
+}
+
+func TestMergeCloudInitMounts_ScriptUserdata(t *testing.T) {
+	// A script made only of comments is valid YAML, but must not be taken for a cloud-config.
+	for _, script := range []string{"#!/bin/bash\necho hello > /tmp/hello\n", "#!/bin/sh\n# nothing\n"} {
+		result, err := MergeCloudInitMounts(script, [][]string{
+			{"src", "/mnt/src", "virtiofs", "defaults,nofail"},
+		})
+		require.NoError(t, err)
+		assert.True(t, isMultipart(result), "the cloud-config defaults must not be merged into the message")
+
+		message, err := mail.ReadMessage(strings.NewReader(result))
+		require.NoError(t, err)
+		mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/mixed", mediaType)
+
+		reader := multipart.NewReader(message.Body, params["boundary"])
+
+		part, err := reader.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, `text/plain; charset="utf-8"`, part.Header.Get("Content-Type"))
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, script, string(content))
+
+		part, err = reader.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, `text/cloud-config; charset="utf-8"`, part.Header.Get("Content-Type"))
+		content, err = io.ReadAll(part)
+		require.NoError(t, err)
+		config := parseCloudConfig(t, string(content))
+		assert.Equal(t, []interface{}{[]interface{}{"src", "/mnt/src", "virtiofs", "defaults,nofail"}}, config["mounts"])
+
+		_, err = reader.NextPart()
+		assert.ErrorIs(t, err, io.EOF)
+	}
+}
+
+func TestMergeCloudInitMounts_EmptyUserdata(t *testing.T) {
+	result, err := MergeCloudInitMounts("", [][]string{{"src", "/mnt/src", "virtiofs", "defaults,nofail"}})
+	require.NoError(t, err)
+	assert.True(t, isCloudConfig(result))
+	assert.Equal(t, []interface{}{[]interface{}{"src", "/mnt/src", "virtiofs", "defaults,nofail"}}, parseCloudConfig(t, result)["mounts"])
+
+	_, err = MergeCloudInitMounts("#cloud-config\n: invalid", [][]string{{"src", "/mnt/src", "virtiofs", "defaults,nofail"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Firmware mapping modes, see QEMU's docs/interop/firmware.json.
+const (
+	FirmwareModeSplit     = "split"    // read-only code and a separate NVRAM (vars) file
+	FirmwareModeCombined  = "combined" // code and vars in a single writable file
+	FirmwareModeStateless = "stateless"
+)
+
+// Firmware features used for selection.
+const (
+	FirmwareSecureBoot   = "secure-boot"
+	FirmwareEnrolledKeys = "enrolled-keys"
+	FirmwareRequiresSMM  = "requires-smm"
+	FirmwareAmdSev       = "amd-sev"
+)
+
+type FirmwareFile struct {
+	Filename string `json:"filename"`
+	Format   string `json:"format"`
+}
+
+type FirmwareMapping struct {
+	Device        string        `json:"device"` // "flash", "memory" or "kernel"
+	Mode          string        `json:"mode"`
+	Executable    FirmwareFile  `json:"executable"`
+	NvramTemplate *FirmwareFile `json:"nvram-template"`
+	Filename      string        `json:"filename"` // for "memory" devices
+}
+
+type FirmwareTarget struct {
+	Architecture string   `json:"architecture"`
+	Machines     []string `json:"machines"` // glob patterns, e.g., "pc-q35-*"
+}
+
+// FirmwareDescriptor is a firmware metadata file as shipped with QEMU and distro
+// firmware packages.
+type FirmwareDescriptor struct {
+	Path           string           `json:"-"`
+	Description    string           `json:"description"`
+	InterfaceTypes []string         `json:"interface-types"`
+	Mapping        FirmwareMapping  `json:"mapping"`
+	Targets        []FirmwareTarget `json:"targets"`
+	Features       []string         `json:"features"`
+}
+
+func (d *FirmwareDescriptor) HasFeature(feature string) bool {
+	return slices.Contains(d.Features, feature)
+}
+
+// Supports reports whether the firmware runs on the given architecture and machine.
+func (d *FirmwareDescriptor) Supports(arch Arch, machine string) bool {
+	for _, target := range d.Targets {
+		if target.Architecture != string(arch) {
+			continue
+		}
+		for _, pattern := range target.Machines {
+			if matchMachine(pattern, machine) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchMachine matches a descriptor machine pattern against a machine name or alias.
+// Descriptors list versioned types such as "pc-q35-*", while callers usually pass
+// the alias "q35".
+func matchMachine(pattern, machine string) bool {
+	if matched, _ := filepath.Match(pattern, machine); matched {
+		return true
+	}
+	base := strings.TrimSuffix(pattern, "-*")
+	return base == machine || base == "pc-"+machine
+}
+
+// FirmwareSearchPaths returns the directories searched for firmware descriptors, in
+// increasing order of priority: a descriptor in a later directory overrides one with
+// the same file name in an earlier directory.
+func FirmwareSearchPaths() []string {
+	paths := []string{
+		"/usr/share/qemu/firmware",
+		"/usr/local/share/qemu/firmware",
+		"/opt/homebrew/share/qemu/firmware",
+		"/etc/qemu/firmware",
+	}
+	if configDir, configDirErr := os.UserConfigDir(); configDirErr == nil {
+		paths = append(paths, filepath.Join(configDir, "qemu", "firmware"))
+	}
+	return paths
+}
+
+// DiscoverFirmware loads all descriptors from the given directories, ordered by file name
+// as QEMU's firmware selection specifies.
+func DiscoverFirmware(dirs ...string) ([]FirmwareDescriptor, error) {
+	byName := map[string]string{}
+	for _, dir := range dirs {
+		matches, globErr := filepath.Glob(filepath.Join(dir, "*.json"))
+		if globErr != nil {
+			return nil, globErr
+		}
+		for _, match := range matches {
+			byName[filepath.Base(match)] = match
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	descriptors := []FirmwareDescriptor{}
+	for _, name := range names {
+		path := byName[name]
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return nil, readErr
+		}
+		// An empty file masks a descriptor of a lower priority directory.
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		var descriptor FirmwareDescriptor
+		if unmarshalErr := json.Unmarshal(data, &descriptor); unmarshalErr != nil {
+			slog.Warn("Ignoring invalid firmware descriptor", "path", path, "error", unmarshalErr)
+			continue
+		}
+		descriptor.Path = path
+		descriptors = append(descriptors, descriptor)
+	}
+
+	return descriptors, nil
+}
+
+// MismatchedFeatures returns the required features the descriptor lacks and the excluded
+// ones, prefixed with "-", it has.
+func (d *FirmwareDescriptor) MismatchedFeatures(features []string) []string {
+	mismatched := []string{}
+	for _, feature := range features {
+		if excluded, ok := strings.CutPrefix(feature, "-"); ok {
+			if d.HasFeature(excluded) {
+				mismatched = append(mismatched, feature)
+			}
+		} else if !d.HasFeature(feature) {
+			mismatched = append(mismatched, feature)
+		}
+	}
+	return mismatched
+}
+
+// SelectFirmware returns the first UEFI descriptor supporting arch and machine that has
+// all of the required features. Features prefixed with "-" must be absent, e.g.,
+// "-secure-boot" selects firmware without Secure Boot.
+func SelectFirmware(descriptors []FirmwareDescriptor, arch Arch, machine string, features []string) (*FirmwareDescriptor, error) {
+	for i := range descriptors {
+		descriptor := &descriptors[i]
+		if !slices.Contains(descriptor.InterfaceTypes, "uefi") || !descriptor.Supports(arch, machine) {
+			continue
+		}
+
+		if len(descriptor.MismatchedFeatures(features)) == 0 {
+			return descriptor, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no UEFI firmware for %s/%s with features %v", arch, machine, features)
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ovmfDescriptor = `{
+  "description": "OVMF without SB",
+  "interface-types": ["uefi"],
+  "mapping": {
+    "device": "flash",
+    "mode": "split",
+    "executable": {"filename": "/usr/share/OVMF/OVMF_CODE_4M.fd", "format": "raw"},
+    "nvram-template": {"filename": "/usr/share/OVMF/OVMF_VARS_4M.fd", "format": "raw"}
+  },
+  "targets": [{"architecture": "x86_64", "machines": ["pc-i440fx-*", "pc-q35-*"]}],
+  "features": ["acpi-s3", "verbose-dynamic"]
+}`
+
+const ovmfSecureBootDescriptor = `{
+  "description": "OVMF with SB+SMM, SB enabled, MS certs enrolled",
+  "interface-types": ["uefi"],
+  "mapping": {
+    "device": "flash",
+    "mode": "split",
+    "executable": {"filename": "/usr/share/OVMF/OVMF_CODE_4M.secboot.fd", "format": "raw"},
+    "nvram-template": {"filename": "/usr/share/OVMF/OVMF_VARS_4M.ms.fd", "format": "raw"}
+  },
+  "targets": [{"architecture": "x86_64", "machines": ["pc-q35-*"]}],
+  "features": ["acpi-s3", "enrolled-keys", "requires-smm", "secure-boot", "verbose-dynamic"]
+}`
+
+const aavmfDescriptor = `{
+  "interface-types": ["uefi"],
+  "mapping": {
+    "device": "flash",
+    "executable": {"filename": "/usr/share/AAVMF/AAVMF_CODE.fd", "format": "raw"},
+    "nvram-template": {"filename": "/usr/share/AAVMF/AAVMF_VARS.fd", "format": "raw"}
+  },
+  "targets": [{"architecture": "aarch64", "machines": ["virt-*"]}],
+  "features": []
+}`
+
+func writeDescriptor(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func TestDiscoverFirmware_PriorityAndMasking(t *testing.T) {
+	system := filepath.Join(t.TempDir(), "share")
+	override := filepath.Join(t.TempDir(), "etc")
+
+	writeDescriptor(t, system, "40-ovmf.json", ovmfDescriptor)
+	writeDescriptor(t, system, "30-ovmf-sb.json", ovmfSecureBootDescriptor)
+	writeDescriptor(t, system, "60-aavmf.json", aavmfDescriptor)
+	// An empty file in a higher priority directory masks the descriptor.
+	writeDescriptor(t, override, "60-aavmf.json", "")
+
+	descriptors, err := DiscoverFirmware(system, override)
+	require.NoError(t, err)
+	require.Len(t, descriptors, 2)
+	assert.Equal(t, filepath.Join(system, "30-ovmf-sb.json"), descriptors[0].Path)
+	assert.Equal(t, filepath.Join(system, "40-ovmf.json"), descriptors[1].Path)
+}
+
+func TestSelectFirmware(t *testing.T) {
+	dir := t.TempDir()
+	writeDescriptor(t, dir, "30-ovmf-sb.json", ovmfSecureBootDescriptor)
+	writeDescriptor(t, dir, "40-ovmf.json", ovmfDescriptor)
+	writeDescriptor(t, dir, "60-aavmf.json", aavmfDescriptor)
+
+	descriptors, err := DiscoverFirmware(dir)
+	require.NoError(t, err)
+
+	secure, err := SelectFirmware(descriptors, ArchX86_64, "q35", []string{FirmwareSecureBoot})
+	require.NoError(t, err)
+	assert.True(t, secure.HasFeature(FirmwareRequiresSMM))
+
+	plain, err := SelectFirmware(descriptors, ArchX86_64, "q35", []string{"-" + FirmwareSecureBoot})
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/share/OVMF/OVMF_CODE_4M.fd", plain.Mapping.Executable.Filename)
+
+	arm, err := SelectFirmware(descriptors, ArchAarch64, "virt", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/share/AAVMF/AAVMF_CODE.fd", arm.Mapping.Executable.Filename)
+
+	_, err = SelectFirmware(descriptors, ArchX86_64, "q35", []string{FirmwareAmdSev})
+	assert.Error(t, err)
+}
@@ -2,7 +2,13 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 func GenerateRandomMAC() (string, error) {
@@ -13,5 +19,259 @@ func GenerateRandomMAC() (string, error) {
 	}
 	// Set locally administered bit (2nd bit of 1st byte) and clear multicast bit (1st bit)
 	buf[0] = (buf[0] | 0x02) & 0xFE
-	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", buf[0], buf[1], buf[2], buf[3], buf[4], buf[5]), nil
+	return formatMAC(buf), nil
+}
+
+// NormalizeMAC returns mac in lower-case, zero-padded, colon-separated form.
+// Octets without leading zeros (as printed by macOS tools, e.g., "52:54:0:12:34:56")
+// and dash separators are accepted.
+func NormalizeMAC(mac string) (string, error) {
+	octets := strings.Split(strings.ReplaceAll(strings.TrimSpace(mac), "-", ":"), ":")
+	if len(octets) != 6 {
+		return "", fmt.Errorf("invalid MAC address: %q", mac)
+	}
+
+	buf := make([]byte, 6)
+	for i, octet := range octets {
+		if len(octet) == 0 || len(octet) > 2 {
+			return "", fmt.Errorf("invalid MAC address: %q", mac)
+		}
+		value, parseErr := strconv.ParseUint(octet, 16, 8)
+		if parseErr != nil {
+			return "", fmt.Errorf("invalid MAC address: %q", mac)
+		}
+		buf[i] = byte(value)
+	}
+
+	return formatMAC(buf), nil
+}
+
+func formatMAC(buf []byte) string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", buf[0], buf[1], buf[2], buf[3], buf[4], buf[5])
+}
+
+// ValidateMAC normalises mac and checks that it can be assigned to a NIC,
+// i.e., it is neither a multicast nor the all-zero address.
+func ValidateMAC(mac string) (string, error) {
+	normalized, normalizeErr := NormalizeMAC(mac)
+	if normalizeErr != nil {
+		return "", normalizeErr
+	}
+
+	hwAddr, _ := net.ParseMAC(normalized)
+	if hwAddr[0]&0x01 != 0 {
+		return "", fmt.Errorf("MAC address %s is a multicast address", normalized)
+	}
+	if normalized == "00:00:00:00:00:00" {
+		return "", fmt.Errorf("MAC address %s is not assignable", normalized)
+	}
+
+	return normalized, nil
+}
+
+// DefaultMACPrefix is the prefix QEMU uses for its own generated MAC addresses.
+const DefaultMACPrefix = "52:54:00"
+
+// DefaultMACStorePath returns the allocation store shared by all instances of the user.
+func DefaultMACStorePath() (string, error) {
+	configDir, configDirErr := os.UserConfigDir()
+	if configDirErr != nil {
+		return "", configDirErr
+	}
+	return filepath.Join(configDir, "qemu-client", "macs.json"), nil
+}
+
+// MACAllocator derives stable MAC addresses from instance IDs and NIC indexes,
+// so restarted instances keep their addresses (and DHCP leases). Allocations are
+// persisted and shared by all instances using the same store, which is used to
+// detect collisions.
+type MACAllocator struct {
+	prefix []byte
+	store  *jsonStore[string, string] // MAC -> owner, see macOwner
+}
+
+// NewMACAllocator creates an allocator generating MACs that start with prefix
+// (1 to 5 octets). When path is set, allocations are loaded from and saved to it.
+func NewMACAllocator(prefix, path string) (*MACAllocator, error) {
+	prefixBytes := []byte{}
+	for _, octet := range strings.Split(prefix, ":") {
+		value, parseErr := strconv.ParseUint(octet, 16, 8)
+		if parseErr != nil || len(octet) > 2 {
+			return nil, fmt.Errorf("invalid MAC prefix: %q", prefix)
+		}
+		prefixBytes = append(prefixBytes, byte(value))
+	}
+	if len(prefixBytes) == 0 || len(prefixBytes) > 5 {
+		return nil, fmt.Errorf("MAC prefix must have between 1 and 5 octets: %q", prefix)
+	}
+	if prefixBytes[0]&0x01 != 0 {
+		return nil, fmt.Errorf("MAC prefix %q has the multicast bit set", prefix)
+	}
+
+	store, storeErr := newJSONStore[string, string](path)
+	if storeErr != nil {
+		return nil, storeErr
+	}
+
+	return &MACAllocator{
+		prefix: prefixBytes,
+		store:  store,
+	}, nil
+}
+
+// Allocate returns the MAC for the given NIC of an instance. The same instance and NIC
+// always get the same MAC; if the derived MAC is taken by another NIC, the next candidate
+// in a deterministic sequence is used instead.
+func (a *MACAllocator) Allocate(instanceID string, nic int) (string, error) {
+	var allocated string
+	updateErr := a.store.update(func(owners map[string]string) (bool, error) {
+		var changed bool
+		var allocateErr error
+		allocated, changed, allocateErr = a.allocate(owners, macOwner(instanceID, nic))
+		return changed, allocateErr
+	})
+
+	return allocated, updateErr
+}
+
+func (a *MACAllocator) allocate(owners map[string]string, owner string) (string, bool, error) {
+	for mac, existing := range owners {
+		if existing == owner {
+			return mac, false, nil
+		}
+	}
+
+	for attempt := 0; attempt < 1024; attempt++ {
+		mac := a.derive(owner, attempt)
+		if _, taken := owners[mac]; taken {
+			continue
+		}
+		owners[mac] = owner
+		return mac, true, nil
+	}
+
+	return "", false, fmt.Errorf("failed to allocate a MAC address for %s", owner)
+}
+
+// Reserve validates and normalises a user-supplied MAC and records it for the given NIC.
+// It fails if the MAC is already assigned to a different NIC.
+func (a *MACAllocator) Reserve(instanceID string, nic int, mac string) (string, error) {
+	normalized, validateErr := ValidateMAC(mac)
+	if validateErr != nil {
+		return "", validateErr
+	}
+
+	updateErr := a.store.update(func(owners map[string]string) (bool, error) {
+		return reserve(owners, macOwner(instanceID, nic), normalized)
+	})
+	if updateErr != nil {
+		return "", updateErr
+	}
+
+	return normalized, nil
+}
+
+func reserve(owners map[string]string, owner, mac string) (bool, error) {
+	if existing, taken := owners[mac]; taken {
+		if existing != owner {
+			return false, fmt.Errorf("MAC address %s is already assigned to %s", mac, existing)
+		}
+		return false, nil
+	}
+
+	for reserved, existing := range owners {
+		if existing == owner {
+			delete(owners, reserved)
+		}
+	}
+	owners[mac] = owner
+	return true, nil
+}
+
+// AllocateNIC returns the MAC of an additional NIC of an instance, i.e., one with an index
+// of 1 or more. A set mac is kept if the instance already holds it for such a NIC and is
+// reserved otherwise; an empty mac is allocated. New allocations and reservations use the
+// lowest NIC index the instance does not hold yet, so the MACs of detached NICs are reused.
+func (a *MACAllocator) AllocateNIC(instanceID, mac string) (string, error) {
+	normalized := ""
+	if mac != "" {
+		var validateErr error
+		if normalized, validateErr = ValidateMAC(mac); validateErr != nil {
+			return "", validateErr
+		}
+	}
+
+	updateErr := a.store.update(func(owners map[string]string) (bool, error) {
+		if owner, taken := owners[normalized]; taken && strings.HasPrefix(owner, instanceID+"/") && owner != macOwner(instanceID, 0) {
+			return false, nil
+		}
+
+		held := map[string]bool{}
+		for _, owner := range owners {
+			held[owner] = true
+		}
+		nic := 1
+		for held[macOwner(instanceID, nic)] {
+			nic++
+		}
+
+		if normalized != "" {
+			return reserve(owners, macOwner(instanceID, nic), normalized)
+		}
+		var changed bool
+		var allocateErr error
+		normalized, changed, allocateErr = a.allocate(owners, macOwner(instanceID, nic))
+		return changed, allocateErr
+	})
+	if updateErr != nil {
+		return "", updateErr
+	}
+
+	return normalized, nil
+}
+
+// ReleaseMAC frees mac if it is allocated to the instance.
+func (a *MACAllocator) ReleaseMAC(instanceID, mac string) error {
+	normalized, normalizeErr := NormalizeMAC(mac)
+	if normalizeErr != nil {
+		return normalizeErr
+	}
+
+	return a.store.update(func(owners map[string]string) (bool, error) {
+		if owner, taken := owners[normalized]; taken && strings.HasPrefix(owner, instanceID+"/") {
+			delete(owners, normalized)
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// Release frees all MACs allocated to the instance.
+func (a *MACAllocator) Release(instanceID string) error {
+	prefix := instanceID + "/"
+	return a.store.update(func(owners map[string]string) (bool, error) {
+		changed := false
+		for mac, owner := range owners {
+			if strings.HasPrefix(owner, prefix) {
+				delete(owners, mac)
+				changed = true
+			}
+		}
+		return changed, nil
+	})
+}
+
+// derive hashes the owner into the octets following the prefix.
+func (a *MACAllocator) derive(owner string, attempt int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", owner, attempt)))
+
+	buf := make([]byte, 6)
+	copy(buf, a.prefix)
+	copy(buf[len(a.prefix):], sum[:])
+
+	return formatMAC(buf)
+}
+
+func macOwner(instanceID string, nic int) string {
+	return fmt.Sprintf("%s/%d", instanceID, nic)
 }
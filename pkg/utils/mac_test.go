@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeMAC(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{name: "canonical", input: "52:54:00:12:34:56", expected: "52:54:00:12:34:56"},
+		{name: "upper case", input: "52:54:00:AB:CD:EF", expected: "52:54:00:ab:cd:ef"},
+		{name: "macOS short octets", input: "52:54:0:1:34:56", expected: "52:54:00:01:34:56"},
+		{name: "dashes", input: "52-54-00-12-34-56", expected: "52:54:00:12:34:56"},
+		{name: "too short", input: "52:54:00:12:34", wantErr: true},
+		{name: "invalid octet", input: "52:54:00:12:34:zz", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NormalizeMAC(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestValidateMAC(t *testing.T) {
+	_, err := ValidateMAC("01:00:5e:00:00:01")
+	assert.Error(t, err, "multicast MAC must be rejected")
+
+	_, err = ValidateMAC("00:00:00:00:00:00")
+	assert.Error(t, err, "all-zero MAC must be rejected")
+
+	mac, err := ValidateMAC("52:54:00:AB:CD:EF")
+	require.NoError(t, err)
+	assert.Equal(t, "52:54:00:ab:cd:ef", mac)
+}
+
+func TestMACAllocator_IsDeterministic(t *testing.T) {
+	first, err := NewMACAllocator(DefaultMACPrefix, "")
+	require.NoError(t, err)
+	second, err := NewMACAllocator(DefaultMACPrefix, "")
+	require.NoError(t, err)
+
+	a, err := first.Allocate("vm1", 0)
+	require.NoError(t, err)
+	b, err := second.Allocate("vm1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.True(t, strings.HasPrefix(a, DefaultMACPrefix+":"))
+
+	other, err := first.Allocate("vm1", 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, other)
+
+	again, err := first.Allocate("vm1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, a, again)
+}
+
+func TestMACAllocator_PersistsAllocations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macs.json")
+
+	allocator, err := NewMACAllocator("02:aa", path)
+	require.NoError(t, err)
+	reserved, err := allocator.Reserve("vm1", 0, "02:AA:00:00:00:01")
+	require.NoError(t, err)
+	assert.Equal(t, "02:aa:00:00:00:01", reserved)
+
+	reloaded, err := NewMACAllocator("02:aa", path)
+	require.NoError(t, err)
+	mac, err := reloaded.Allocate("vm1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, reserved, mac)
+
+	_, err = reloaded.Reserve("vm2", 0, reserved)
+	assert.Error(t, err, "a MAC owned by another NIC must not be reserved twice")
+}
+
+func TestMACAllocator_AvoidsCollisions(t *testing.T) {
+	allocator, err := NewMACAllocator("02:00:00:00:00", "")
+	require.NoError(t, err)
+
+	// With a single free octet, collisions are frequent; every NIC must still be unique.
+	seen := map[string]bool{}
+	for nic := 0; nic < 64; nic++ {
+		mac, allocErr := allocator.Allocate("vm1", nic)
+		require.NoError(t, allocErr)
+		assert.False(t, seen[mac], "duplicate MAC %s", mac)
+		seen[mac] = true
+	}
+
+	require.NoError(t, allocator.Release("vm1"))
+	assert.Empty(t, allocator.store.entries)
+}
+
+func TestNewMACAllocator_InvalidPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "01:00", "52:54:00:00:00:00", "zz"} {
+		_, err := NewMACAllocator(prefix, "")
+		assert.Error(t, err, "prefix %q", prefix)
+	}
+}
+
+func TestMACAllocator_ConcurrentAllocatorsShareTheStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macs.json")
+
+	// A single free octet makes collisions between allocators likely.
+	first, err := NewMACAllocator("02:00:00:00:00", path)
+	require.NoError(t, err)
+	second, err := NewMACAllocator("02:00:00:00:00", path)
+	require.NoError(t, err)
+
+	macs := make(chan string, 32)
+	var wg sync.WaitGroup
+	for i, allocator := range []*MACAllocator{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for nic := 0; nic < 16; nic++ {
+				mac, allocErr := allocator.Allocate(fmt.Sprintf("vm%d", i), nic)
+				assert.NoError(t, allocErr)
+				macs <- mac
+			}
+		}()
+	}
+	wg.Wait()
+	close(macs)
+
+	seen := map[string]bool{}
+	for mac := range macs {
+		assert.False(t, seen[mac], "duplicate MAC %s", mac)
+		seen[mac] = true
+	}
+	assert.Len(t, seen, 32)
+}
+
+func TestMACAllocator_AllocateNIC(t *testing.T) {
+	allocator, err := NewMACAllocator(DefaultMACPrefix, "")
+	require.NoError(t, err)
+
+	primary, err := allocator.Allocate("vm1", 0)
+	require.NoError(t, err)
+	first, err := allocator.AllocateNIC("vm1", "")
+	require.NoError(t, err)
+	nic1, err := allocator.Allocate("vm1", 1)
+	require.NoError(t, err)
+	assert.Equal(t, nic1, first)
+
+	reserved, err := allocator.AllocateNIC("vm1", "52:54:00:AA:BB:CC")
+	require.NoError(t, err)
+	assert.Equal(t, "52:54:00:aa:bb:cc", reserved)
+	kept, err := allocator.AllocateNIC("vm1", reserved)
+	require.NoError(t, err)
+	assert.Equal(t, reserved, kept, "a MAC the instance holds is kept")
+
+	_, err = allocator.AllocateNIC("vm1", primary)
+	assert.ErrorContains(t, err, "already assigned", "the primary MAC must not be reused")
+	_, err = allocator.AllocateNIC("vm2", reserved)
+	assert.ErrorContains(t, err, "already assigned")
+
+	require.NoError(t, allocator.ReleaseMAC("vm2", first), "MACs of other instances are left alone")
+	require.NoError(t, allocator.ReleaseMAC("vm1", first))
+	again, err := allocator.AllocateNIC("vm1", "")
+	require.NoError(t, err)
+	assert.Equal(t, first, again, "the lowest free NIC index is reused")
+}
@@ -2,15 +2,26 @@ package utils
 
 import (
 	"fmt"
-	"runtime"
 )
 
 func GetMachineType() (string, error) {
-	switch runtime.GOARCH {
-	case "arm64", "arm":
+	arch, archErr := HostArch()
+	if archErr != nil {
+		return "", archErr
+	}
+	return GetMachineTypeForArch(arch)
+}
+
+func GetMachineTypeForArch(arch Arch) (string, error) {
+	switch arch {
+	case ArchAarch64, ArchRiscv64:
 		return "virt", nil
-	case "amd64":
+	case ArchX86_64:
 		return "q35", nil
+	case ArchPpc64le:
+		return "pseries", nil
+	case ArchS390x:
+		return "s390-ccw-virtio", nil
 	}
-	return "", fmt.Errorf("unsupported architecture: %s", runtime.GOARCH)
+	return "", fmt.Errorf("unsupported architecture: %s", arch)
 }
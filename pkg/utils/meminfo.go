@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HostMemoryInfo describes the host's physical memory, in MB.
+type HostMemoryInfo struct {
+	Total     uint64
+	Available uint64 // memory that can be allocated without swapping
+}
+
+// parseProcMeminfo parses the Linux /proc/meminfo file.
+func parseProcMeminfo(r io.Reader) HostMemoryInfo {
+	info := HostMemoryInfo{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// MemAvailable:    8049572 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, parseErr := strconv.ParseUint(fields[1], 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			info.Total = value / 1024
+		case "MemAvailable:":
+			info.Available = value / 1024
+		}
+	}
+
+	return info
+}
+
+// parseVmStat parses the output of macOS `vm_stat`, counting free, inactive and
+// purgeable pages as available.
+func parseVmStat(output string) uint64 {
+	pageSize := uint64(4096)
+	pages := uint64(0)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Mach Virtual Memory Statistics: (page size of 16384 bytes)
+		if _, rest, found := strings.Cut(line, "page size of "); found {
+			if size, parseErr := strconv.ParseUint(strings.Fields(rest)[0], 10, 64); parseErr == nil {
+				pageSize = size
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Pages free", "Pages inactive", "Pages purgeable":
+			if count, parseErr := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), "."), 10, 64); parseErr == nil {
+				pages += count
+			}
+		}
+	}
+
+	return pages * pageSize / (1024 * 1024)
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// HostMemory returns the host's total and available memory.
+func HostMemory() (HostMemoryInfo, error) {
+	memsizeOutput, memsizeErr := exec.Command("sysctl", "-n", "hw.memsize").Output()
+	if memsizeErr != nil {
+		return HostMemoryInfo{}, fmt.Errorf("sysctl failed: %w", memsizeErr)
+	}
+	memsize, parseErr := strconv.ParseUint(strings.TrimSpace(string(memsizeOutput)), 10, 64)
+	if parseErr != nil {
+		return HostMemoryInfo{}, fmt.Errorf("unrecognised hw.memsize: %w", parseErr)
+	}
+
+	vmStatOutput, vmStatErr := exec.Command("vm_stat").Output()
+	if vmStatErr != nil {
+		return HostMemoryInfo{}, fmt.Errorf("vm_stat failed: %w", vmStatErr)
+	}
+
+	return HostMemoryInfo{
+		Total:     memsize / (1024 * 1024),
+		Available: parseVmStat(string(vmStatOutput)),
+	}, nil
+}
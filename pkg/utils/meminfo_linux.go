@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// HostMemory returns the host's total and available memory.
+func HostMemory() (HostMemoryInfo, error) {
+	file, openErr := os.Open("/proc/meminfo")
+	if openErr != nil {
+		return HostMemoryInfo{}, openErr
+	}
+	defer file.Close()
+
+	info := parseProcMeminfo(file)
+	if info.Total == 0 {
+		return HostMemoryInfo{}, fmt.Errorf("unrecognised /proc/meminfo")
+	}
+	return info, nil
+}
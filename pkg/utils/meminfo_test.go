@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcMeminfo(t *testing.T) {
+	info := parseProcMeminfo(strings.NewReader(`MemTotal:       16303432 kB
+MemFree:          613316 kB
+MemAvailable:    8049572 kB
+Buffers:          438420 kB
+`))
+	assert.Equal(t, HostMemoryInfo{Total: 15921, Available: 7860}, info)
+}
+
+func TestParseVmStat(t *testing.T) {
+	available := parseVmStat(`Mach Virtual Memory Statistics: (page size of 16384 bytes)
+Pages free:                               12800.
+Pages active:                            400000.
+Pages inactive:                           51200.
+Pages speculative:                         1000.
+Pages purgeable:                             0.
+`)
+	assert.Equal(t, uint64(1000), available)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// Neighbor is an entry of the host ARP or NDP neighbor table.
+type Neighbor struct {
+	IP  netip.Addr
+	Mac string
+}
+
+// parseProcNetArp parses the Linux /proc/net/arp table.
+func parseProcNetArp(r io.Reader) []Neighbor {
+	neighbors := []Neighbor{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // skip the header
+	for scanner.Scan() {
+		// IP address  HW type  Flags  HW address  Mask  Device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] == "0x0" {
+			continue
+		}
+		if neighbor, ok := newNeighbor(fields[0], fields[3]); ok {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+
+	return neighbors
+}
+
+func newNeighbor(ip, mac string) (Neighbor, bool) {
+	// Drop the zone of link-local addresses, e.g., "fe80::1%bridge100".
+	ip, _, _ = strings.Cut(ip, "%")
+	addr, parseErr := netip.ParseAddr(ip)
+	if parseErr != nil {
+		return Neighbor{}, false
+	}
+
+	mac, macErr := NormalizeMAC(mac)
+	if macErr != nil || mac == "00:00:00:00:00:00" {
+		return Neighbor{}, false
+	}
+
+	return Neighbor{IP: addr, Mac: mac}, true
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Neighbors returns the host's IPv4 ARP and IPv6 neighbor tables.
+func Neighbors() ([]Neighbor, error) {
+	arpOutput, arpErr := exec.Command("arp", "-an").Output()
+	if arpErr != nil {
+		return nil, fmt.Errorf("arp failed: %w", arpErr)
+	}
+
+	neighbors := parseArp(arpOutput)
+
+	if ndpOutput, ndpErr := exec.Command("ndp", "-an").Output(); ndpErr == nil {
+		neighbors = append(neighbors, parseNdp(ndpOutput)...)
+	}
+
+	return neighbors, nil
+}
+
+// parseArp parses the output of `arp -an`, e.g.,
+// "? (192.168.64.2) at 52:54:0:12:34:56 on bridge100 ifscope [ethernet]".
+func parseArp(output []byte) []Neighbor {
+	neighbors := []Neighbor{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] != "at" {
+			continue
+		}
+		ip := strings.Trim(fields[1], "()")
+		if neighbor, ok := newNeighbor(ip, fields[3]); ok {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+
+	return neighbors
+}
+
+// parseNdp parses the output of `ndp -an`, e.g.,
+// "fe80::5054:ff:fe12:3456%bridge100 52:54:0:12:34:56 bridge100 23h59m58s S".
+func parseNdp(output []byte) []Neighbor {
+	neighbors := []Neighbor{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Scan() // skip the header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if neighbor, ok := newNeighbor(fields[0], fields[1]); ok {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+
+	return neighbors
+}
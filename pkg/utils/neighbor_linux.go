@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Neighbors returns the host's IPv4 ARP and IPv6 neighbor tables.
+func Neighbors() ([]Neighbor, error) {
+	file, openErr := os.Open("/proc/net/arp")
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+
+	neighbors := parseProcNetArp(file)
+
+	// The IPv6 table is not exposed through procfs; skip it if iproute2 is missing.
+	if output, ipErr := exec.Command("ip", "-6", "neigh", "show").Output(); ipErr == nil {
+		neighbors = append(neighbors, parseIpNeigh(output)...)
+	}
+
+	return neighbors, nil
+}
+
+// parseIpNeigh parses the output of `ip neigh show`, e.g.,
+// "fe80::5054:ff:fe12:3456 dev br0 lladdr 52:54:00:12:34:56 REACHABLE".
+func parseIpNeigh(output []byte) []Neighbor {
+	neighbors := []Neighbor{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i := 1; i < len(fields)-1; i++ {
+			if fields[i] != "lladdr" {
+				continue
+			}
+			if neighbor, ok := newNeighbor(fields[0], fields[i+1]); ok {
+				neighbors = append(neighbors, neighbor)
+			}
+			break
+		}
+	}
+
+	return neighbors
+}
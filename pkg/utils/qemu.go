@@ -2,16 +2,59 @@ package utils
 
 import (
 	"fmt"
-	"runtime"
+	"os"
+	"os/exec"
 )
 
 func GetQemuBinary() (string, error) {
-	switch runtime.GOARCH {
-	case "arm64":
-		return "qemu-system-aarch64", nil
-	case "amd64":
-		return "qemu-system-x86_64", nil
+	arch, archErr := HostArch()
+	if archErr != nil {
+		return "", archErr
+	}
+	return GetQemuBinaryForArch(arch)
+}
+
+func GetQemuBinaryForArch(arch Arch) (string, error) {
+	target, targetErr := QemuTarget(arch)
+	if targetErr != nil {
+		return "", targetErr
+	}
+	return fmt.Sprintf("qemu-system-%s", target), nil
+}
+
+// QemuTarget returns the QEMU target emulating arch, as reported by query-target.
+func QemuTarget(arch Arch) (string, error) {
+	switch arch {
+	case ArchX86_64, ArchAarch64, ArchRiscv64, ArchS390x:
+		return string(arch), nil
+	case ArchPpc64le:
+		// The ppc64 target covers both endiannesses.
+		return "ppc64", nil
+	}
+	return "", fmt.Errorf("unsupported architecture: %s", arch)
+}
+
+// QemuBinaryEnv names the environment variable that overrides the QEMU binary.
+const QemuBinaryEnv = "QEMU_BINARY"
+
+// FindQemuBinary locates the QEMU system emulator for arch. An explicit path takes
+// precedence, followed by the QEMU_BINARY environment variable and a PATH lookup.
+func FindQemuBinary(arch Arch, explicit string) (string, error) {
+	candidate := explicit
+	if candidate == "" {
+		candidate = os.Getenv(QemuBinaryEnv)
+	}
+	if candidate == "" {
+		binary, binaryErr := GetQemuBinaryForArch(arch)
+		if binaryErr != nil {
+			return "", binaryErr
+		}
+		candidate = binary
 	}
 
-	return "", fmt.Errorf("unsupported architecture: %s", runtime.GOARCH)
+	path, lookErr := exec.LookPath(candidate)
+	if lookErr != nil {
+		return "", fmt.Errorf("%s is not available; please install %s", candidate, candidate)
+	}
+	return path, nil
 }
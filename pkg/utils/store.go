@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// jsonStore keeps a map in a JSON file shared by all processes using the same path.
+// Every access holds an exclusive lock on a sidecar lock file and re-reads the file, so
+// concurrent writers never drop each other's entries. With an empty path, entries are
+// kept in memory only.
+type jsonStore[K comparable, V any] struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[K]V // used without a path
+}
+
+// newJSONStore opens a store, failing if an existing file cannot be parsed.
+func newJSONStore[K comparable, V any](path string) (*jsonStore[K, V], error) {
+	store := &jsonStore[K, V]{
+		path:    path,
+		entries: map[K]V{},
+	}
+	if loadErr := store.update(func(map[K]V) (bool, error) { return false, nil }); loadErr != nil {
+		return nil, loadErr
+	}
+	return store, nil
+}
+
+// update runs fn on the current entries and saves them when fn reports a change.
+func (s *jsonStore[K, V]) update(fn func(entries map[K]V) (bool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" {
+		_, fnErr := fn(s.entries)
+		return fnErr
+	}
+
+	if mkdirErr := os.MkdirAll(filepath.Dir(s.path), 0755); mkdirErr != nil {
+		return mkdirErr
+	}
+
+	lock, lockErr := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if lockErr != nil {
+		return lockErr
+	}
+	// Closing the file releases the lock.
+	defer lock.Close()
+	if flockErr := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); flockErr != nil {
+		return fmt.Errorf("failed to lock %s: %w", s.path, flockErr)
+	}
+
+	entries, loadErr := s.load()
+	if loadErr != nil {
+		return loadErr
+	}
+
+	changed, fnErr := fn(entries)
+	if fnErr != nil || !changed {
+		return fnErr
+	}
+	return s.save(entries)
+}
+
+func (s *jsonStore[K, V]) load() (map[K]V, error) {
+	entries := map[K]V{}
+
+	data, readErr := os.ReadFile(s.path)
+	if errors.Is(readErr, os.ErrNotExist) {
+		return entries, nil
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if unmarshalErr := json.Unmarshal(data, &entries); unmarshalErr != nil {
+		return nil, fmt.Errorf("invalid store %s: %w", s.path, unmarshalErr)
+	}
+	return entries, nil
+}
+
+func (s *jsonStore[K, V]) save(entries map[K]V) error {
+	data, marshalErr := json.MarshalIndent(entries, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	tmp, tmpErr := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if tmpErr != nil {
+		return tmpErr
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, writeErr := tmp.Write(data); writeErr != nil {
+		tmp.Close()
+		return writeErr
+	}
+	if closeErr := tmp.Close(); closeErr != nil {
+		return closeErr
+	}
+	if chmodErr := os.Chmod(tmp.Name(), 0644); chmodErr != nil {
+		return chmodErr
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONStore_ConcurrentWritersKeepAllEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	// Separate stores stand in for separate processes sharing the file.
+	var wg sync.WaitGroup
+	for writer := 0; writer < 4; writer++ {
+		store, err := newJSONStore[string, int](path)
+		require.NoError(t, err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				assert.NoError(t, store.update(func(entries map[string]int) (bool, error) {
+					entries[fmt.Sprintf("%d/%d", writer, i)] = i
+					return true, nil
+				}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	store, err := newJSONStore[string, int](path)
+	require.NoError(t, err)
+	require.NoError(t, store.update(func(entries map[string]int) (bool, error) {
+		assert.Len(t, entries, 40)
+		return false, nil
+	}))
+}
+
+func TestJSONStore_RejectsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0644))
+
+	_, err := newJSONStore[string, string](path)
+	assert.ErrorContains(t, err, "invalid store")
+}
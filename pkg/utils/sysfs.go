@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const VfioPciDriver = "vfio-pci"
+
+// pciBridgeClass is the class code prefix of PCI bridges, which may share an IOMMU group
+// with passed through devices without being bound to vfio-pci.
+const pciBridgeClass = "0x0604"
+
+var pciAddressPattern = regexp.MustCompile(`^(?:([0-9a-f]{4}):)?([0-9a-f]{2}):([0-9a-f]{2})\.([0-7])$`)
+
+// Sysfs gives access to PCI devices through a sysfs tree. HostSysfs is the host's
+// tree; tests can point Root at a tree created with WriteFakeSysfs.
+type Sysfs struct {
+	Root string
+}
+
+var HostSysfs = Sysfs{Root: "/sys"}
+
+// PciDevice is a host PCI device as seen in sysfs.
+type PciDevice struct {
+	Address    string // e.g., "0000:03:00.0"
+	Vendor     string // e.g., "0x8086"
+	Device     string
+	Class      string // e.g., "0x020000"
+	Driver     string // bound driver; empty when unbound
+	IommuGroup string // empty without an IOMMU
+}
+
+// NormalizePciAddress returns the full form of a PCI address, adding the default
+// domain, e.g., "03:00.0" becomes "0000:03:00.0".
+func NormalizePciAddress(address string) (string, error) {
+	match := pciAddressPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(address)))
+	if match == nil {
+		return "", fmt.Errorf("invalid PCI address: %q", address)
+	}
+	domain := match[1]
+	if domain == "" {
+		domain = "0000"
+	}
+	return fmt.Sprintf("%s:%s:%s.%s", domain, match[2], match[3], match[4]), nil
+}
+
+func (s Sysfs) devicePath(address string, elem ...string) string {
+	return filepath.Join(append([]string{s.Root, "bus", "pci", "devices", address}, elem...)...)
+}
+
+// PciDevice reads a device by address.
+func (s Sysfs) PciDevice(address string) (*PciDevice, error) {
+	normalized, normalizeErr := NormalizePciAddress(address)
+	if normalizeErr != nil {
+		return nil, normalizeErr
+	}
+
+	if _, statErr := os.Stat(s.devicePath(normalized)); statErr != nil {
+		return nil, fmt.Errorf("PCI device %s not found: %w", normalized, statErr)
+	}
+
+	device := &PciDevice{Address: normalized}
+	for field, name := range map[*string]string{&device.Vendor: "vendor", &device.Device: "device", &device.Class: "class"} {
+		data, readErr := os.ReadFile(s.devicePath(normalized, name))
+		if readErr != nil {
+			return nil, readErr
+		}
+		*field = strings.TrimSpace(string(data))
+	}
+	if driver, linkErr := os.Readlink(s.devicePath(normalized, "driver")); linkErr == nil {
+		device.Driver = filepath.Base(driver)
+	}
+	if group, linkErr := os.Readlink(s.devicePath(normalized, "iommu_group")); linkErr == nil {
+		device.IommuGroup = filepath.Base(group)
+	}
+
+	return device, nil
+}
+
+// IommuGroupDevices returns the addresses of all devices in an IOMMU group.
+func (s Sysfs) IommuGroupDevices(group string) ([]string, error) {
+	entries, readErr := os.ReadDir(filepath.Join(s.Root, "kernel", "iommu_groups", group, "devices"))
+	if readErr != nil {
+		return nil, readErr
+	}
+	addresses := []string{}
+	for _, entry := range entries {
+		addresses = append(addresses, entry.Name())
+	}
+	return addresses, nil
+}
+
+// ValidateIommuGroup checks that a device can be passed through: it must be in an IOMMU
+// group whose devices, except bridges, are all bound to vfio-pci or to no driver. Devices
+// listed in binding are about to be bound to vfio-pci and are accepted regardless.
+func (s Sysfs) ValidateIommuGroup(address string, binding ...string) error {
+	device, deviceErr := s.PciDevice(address)
+	if deviceErr != nil {
+		return deviceErr
+	}
+	if device.IommuGroup == "" {
+		return fmt.Errorf("PCI device %s has no IOMMU group; is the IOMMU enabled (intel_iommu=on or amd_iommu=on)?", device.Address)
+	}
+
+	viable := map[string]bool{}
+	for _, other := range binding {
+		if normalized, normalizeErr := NormalizePciAddress(other); normalizeErr == nil {
+			viable[normalized] = true
+		}
+	}
+
+	members, membersErr := s.IommuGroupDevices(device.IommuGroup)
+	if membersErr != nil {
+		return membersErr
+	}
+	for _, member := range members {
+		memberDevice, memberErr := s.PciDevice(member)
+		if memberErr != nil {
+			return memberErr
+		}
+		if viable[memberDevice.Address] || strings.HasPrefix(memberDevice.Class, pciBridgeClass) {
+			continue
+		}
+		if memberDevice.Driver == VfioPciDriver {
+			continue
+		}
+		if memberDevice.Address == device.Address {
+			return fmt.Errorf("PCI device %s is bound to %q instead of %s", device.Address, device.Driver, VfioPciDriver)
+		}
+		if memberDevice.Driver != "" {
+			return fmt.Errorf("PCI device %s shares IOMMU group %s with %s, which is bound to %s", device.Address, device.IommuGroup, member, memberDevice.Driver)
+		}
+	}
+
+	return nil
+}
+
+// BindVfio rebinds a device from its current driver to vfio-pci.
+func (s Sysfs) BindVfio(address string) error {
+	device, deviceErr := s.PciDevice(address)
+	if deviceErr != nil {
+		return deviceErr
+	}
+	if device.Driver == VfioPciDriver {
+		return nil
+	}
+	if _, statErr := os.Stat(filepath.Join(s.Root, "bus", "pci", "drivers", VfioPciDriver)); statErr != nil {
+		return fmt.Errorf("%s driver is not loaded; please run modprobe %s", VfioPciDriver, VfioPciDriver)
+	}
+
+	// driver_override makes the next probe pick vfio-pci regardless of device IDs.
+	if writeErr := s.write(s.devicePath(device.Address, "driver_override"), VfioPciDriver); writeErr != nil {
+		return writeErr
+	}
+	if device.Driver != "" {
+		if writeErr := s.write(s.devicePath(device.Address, "driver", "unbind"), device.Address); writeErr != nil {
+			return writeErr
+		}
+	}
+	return s.write(filepath.Join(s.Root, "bus", "pci", "drivers_probe"), device.Address)
+}
+
+// UnbindVfio releases a device from vfio-pci and lets the kernel probe its default driver.
+func (s Sysfs) UnbindVfio(address string) error {
+	device, deviceErr := s.PciDevice(address)
+	if deviceErr != nil {
+		return deviceErr
+	}
+
+	if writeErr := s.write(s.devicePath(device.Address, "driver_override"), "\n"); writeErr != nil {
+		return writeErr
+	}
+	if device.Driver == VfioPciDriver {
+		if writeErr := s.write(s.devicePath(device.Address, "driver", "unbind"), device.Address); writeErr != nil {
+			return writeErr
+		}
+	}
+	return s.write(filepath.Join(s.Root, "bus", "pci", "drivers_probe"), device.Address)
+}
+
+func (s Sysfs) write(path, value string) error {
+	if writeErr := os.WriteFile(path, []byte(value), 0200); writeErr != nil {
+		return fmt.Errorf("failed to write %s: %w", path, writeErr)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFakeSysfs creates a sysfs tree under root holding the given PCI devices, e.g., for
+// testing passthrough without host devices. Drivers and IOMMU groups are created as the
+// devices reference them; devices without a Driver are unbound.
+func WriteFakeSysfs(root string, devices ...PciDevice) (Sysfs, error) {
+	sysfs := Sysfs{Root: root}
+
+	if mkdirErr := os.MkdirAll(filepath.Join(root, "bus", "pci", "drivers", VfioPciDriver), 0755); mkdirErr != nil {
+		return sysfs, mkdirErr
+	}
+	if writeErr := os.WriteFile(filepath.Join(root, "bus", "pci", "drivers_probe"), nil, 0644); writeErr != nil {
+		return sysfs, writeErr
+	}
+
+	for _, device := range devices {
+		address, normalizeErr := NormalizePciAddress(device.Address)
+		if normalizeErr != nil {
+			return sysfs, normalizeErr
+		}
+
+		path := sysfs.devicePath(address)
+		if mkdirErr := os.MkdirAll(path, 0755); mkdirErr != nil {
+			return sysfs, mkdirErr
+		}
+		// The kernel reports an unset driver override as "(null)".
+		for name, value := range map[string]string{"vendor": device.Vendor, "device": device.Device, "class": device.Class, "driver_override": "(null)"} {
+			if writeErr := os.WriteFile(filepath.Join(path, name), []byte(value+"\n"), 0644); writeErr != nil {
+				return sysfs, writeErr
+			}
+		}
+
+		if device.Driver != "" {
+			driverPath := filepath.Join(root, "bus", "pci", "drivers", device.Driver)
+			if mkdirErr := os.MkdirAll(driverPath, 0755); mkdirErr != nil {
+				return sysfs, mkdirErr
+			}
+			if linkErr := os.Symlink(driverPath, filepath.Join(path, "driver")); linkErr != nil {
+				return sysfs, linkErr
+			}
+		}
+
+		if device.IommuGroup != "" {
+			groupPath := filepath.Join(root, "kernel", "iommu_groups", device.IommuGroup)
+			if mkdirErr := os.MkdirAll(filepath.Join(groupPath, "devices", address), 0755); mkdirErr != nil {
+				return sysfs, mkdirErr
+			}
+			if linkErr := os.Symlink(groupPath, filepath.Join(path, "iommu_group")); linkErr != nil {
+				return sysfs, linkErr
+			}
+		}
+	}
+
+	return sysfs, nil
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSysfs builds a sysfs tree with the given PCI devices.
+func fakeSysfs(t *testing.T, devices ...PciDevice) Sysfs {
+	sysfs, err := WriteFakeSysfs(t.TempDir(), devices...)
+	require.NoError(t, err)
+	return sysfs
+}
+
+func TestNormalizePciAddress(t *testing.T) {
+	address, err := NormalizePciAddress("03:00.0")
+	require.NoError(t, err)
+	assert.Equal(t, "0000:03:00.0", address)
+
+	_, err = NormalizePciAddress("03:00")
+	assert.Error(t, err)
+}
+
+func TestSysfs_PciDevice(t *testing.T) {
+	sysfs := fakeSysfs(t, PciDevice{Address: "0000:03:00.0", Vendor: "0x8086", Device: "0x1533", Class: "0x020000", Driver: "igb", IommuGroup: "14"})
+
+	device, err := sysfs.PciDevice("03:00.0")
+	require.NoError(t, err)
+	assert.Equal(t, &PciDevice{Address: "0000:03:00.0", Vendor: "0x8086", Device: "0x1533", Class: "0x020000", Driver: "igb", IommuGroup: "14"}, device)
+}
+
+func TestSysfs_BindVfio(t *testing.T) {
+	sysfs := fakeSysfs(t, PciDevice{Address: "0000:03:00.0", Vendor: "0x8086", Device: "0x1533", Class: "0x020000", Driver: "igb", IommuGroup: "14"})
+	root := sysfs.Root
+
+	require.NoError(t, sysfs.BindVfio("0000:03:00.0"))
+
+	read := func(elem ...string) string {
+		data, err := os.ReadFile(filepath.Join(append([]string{root}, elem...)...))
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, VfioPciDriver, read("bus", "pci", "devices", "0000:03:00.0", "driver_override"))
+	assert.Equal(t, "0000:03:00.0", read("bus", "pci", "drivers", "igb", "unbind"))
+	assert.Equal(t, "0000:03:00.0", read("bus", "pci", "drivers_probe"))
+}
+
+func TestSysfs_ValidateIommuGroup(t *testing.T) {
+	sysfs := fakeSysfs(t,
+		PciDevice{Address: "0000:00:01.0", Vendor: "0x8086", Device: "0x1901", Class: "0x060400", Driver: "pcieport", IommuGroup: "1"},
+		PciDevice{Address: "0000:01:00.0", Vendor: "0x10de", Device: "0x1b80", Class: "0x030000", Driver: VfioPciDriver, IommuGroup: "1"},
+		PciDevice{Address: "0000:01:00.1", Vendor: "0x10de", Device: "0x10f0", Class: "0x040300", IommuGroup: "1"},
+		PciDevice{Address: "0000:02:00.0", Vendor: "0x8086", Device: "0x1521", Class: "0x020000", Driver: VfioPciDriver, IommuGroup: "2"},
+		PciDevice{Address: "0000:02:00.1", Vendor: "0x8086", Device: "0x1521", Class: "0x020000", Driver: "igb", IommuGroup: "2"},
+		PciDevice{Address: "0000:03:00.0", Vendor: "0x8086", Device: "0x1533", Class: "0x020000", Driver: VfioPciDriver},
+	)
+
+	assert.NoError(t, sysfs.ValidateIommuGroup("0000:01:00.0"), "bridges and unbound devices may share the group")
+	assert.ErrorContains(t, sysfs.ValidateIommuGroup("0000:02:00.0"), "bound to igb")
+	assert.ErrorContains(t, sysfs.ValidateIommuGroup("0000:02:00.1"), "instead of vfio-pci")
+	assert.ErrorContains(t, sysfs.ValidateIommuGroup("0000:03:00.0"), "no IOMMU group")
+	assert.NoError(t, sysfs.ValidateIommuGroup("0000:02:00.0", "02:00.1"), "group members being bound are viable")
+}